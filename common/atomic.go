@@ -0,0 +1,62 @@
+package common
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// atomicFile is an output file written under a temporary name in the
+// directory of its target, and renamed over the target only once it has
+// been written in full, so that the target never holds partial output.
+type atomicFile struct {
+	*os.File
+	target string
+}
+
+// createAtomic creates the temporary file for target.  It is given the
+// permissions of target if that exists, and 0644 otherwise.
+func createAtomic(target string) (*atomicFile, error) {
+	f, err := os.CreateTemp(filepath.Dir(target), "."+filepath.Base(target)+".tmp-")
+	if err != nil {
+		return nil, err
+	}
+	perm := os.FileMode(0644)
+	if info, err := os.Stat(target); err == nil {
+		perm = info.Mode().Perm()
+	}
+	if err := f.Chmod(perm); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return nil, err
+	}
+	return &atomicFile{f, target}, nil
+}
+
+// commit flushes the file to disk, closes it and renames it over its
+// target.  If any of these fails, the file is removed instead.
+func (af *atomicFile) commit() error {
+	err := af.Sync()
+	if cerr := af.File.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(af.Name(), af.target)
+	}
+	if err != nil {
+		os.Remove(af.Name())
+		return err
+	}
+	// The rename is only durable once the directory is synced too.  Not
+	// every system can sync a directory, so failing to is not an error.
+	if dir, err := os.Open(filepath.Dir(af.target)); err == nil {
+		dir.Sync()
+		dir.Close()
+	}
+	return nil
+}
+
+// abort closes and removes the file, leaving the target as it was.
+func (af *atomicFile) abort() error {
+	af.File.Close()
+	return os.Remove(af.Name())
+}
@@ -0,0 +1,64 @@
+package common
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+)
+
+// utf8BOM is the UTF-8 encoding of the byte order mark, which some programs,
+// notably Excel, need at the start of a file to recognize it as UTF-8.
+const utf8BOM = "\xef\xbb\xbf"
+
+// bomWriter writes a UTF-8 byte order mark before the first bytes written to
+// it.
+type bomWriter struct {
+	w       io.Writer
+	written bool
+}
+
+func (bw *bomWriter) Write(p []byte) (int, error) {
+	if !bw.written && len(p) > 0 {
+		if _, err := io.WriteString(bw.w, utf8BOM); err != nil {
+			return 0, err
+		}
+		bw.written = true
+	}
+	return bw.w.Write(p)
+}
+
+// bomStripReader drops a UTF-8 byte order mark from the start of the input
+// and from the start of every line, where input concatenated from several
+// files, each with its own mark, has one at the start of each file.
+type bomStripReader struct {
+	br        *bufio.Reader
+	lineStart bool
+}
+
+func newBOMStripReader(r io.Reader) *bomStripReader {
+	return &bomStripReader{bufio.NewReader(r), true}
+}
+
+// Read reads no further than the end of a line, so that the start of the
+// next can be checked for a mark.
+func (bs *bomStripReader) Read(p []byte) (int, error) {
+	if bs.lineStart {
+		if b, _ := bs.br.Peek(len(utf8BOM)); string(b) == utf8BOM {
+			bs.br.Discard(len(utf8BOM))
+		}
+		bs.lineStart = false
+	}
+	if bs.br.Buffered() == 0 {
+		if _, err := bs.br.Peek(1); err != nil {
+			return 0, err
+		}
+	}
+	buf, _ := bs.br.Peek(min(bs.br.Buffered(), len(p)))
+	if i := bytes.IndexByte(buf, '\n'); i >= 0 {
+		buf = buf[:i+1]
+		bs.lineStart = true
+	}
+	n := copy(p, buf)
+	bs.br.Discard(n)
+	return n, nil
+}
@@ -0,0 +1,79 @@
+package common
+
+import (
+	"strings"
+	"unicode"
+)
+
+// latinAccents lists the accented Latin letters that collationKey knows,
+// each with the letter it is a form of, by accent.  The accents are numbered
+// from 1 in this order.
+var latinAccents = []struct {
+	letters, bases string
+}{
+	{"àèìòùỳÀÈÌÒÙỲ", "aeiouyAEIOUY"},                         // grave
+	{"áéíóúýćĺńŕśźÁÉÍÓÚÝĆĹŃŔŚŹ", "aeiouyclnrszAEIOUYCLNRSZ"}, // acute
+	{"âêîôûĉĝĥĵŝŵŷÂÊÎÔÛĈĜĤĴŜŴŶ", "aeioucghjswyAEIOUCGHJSWY"}, // circumflex
+	{"ãñõĩũÃÑÕĨŨ", "anoiuANOIU"},                             // tilde
+	{"äëïöüÿÄËÏÖÜŸ", "aeiouyAEIOUY"},                         // diaeresis
+	{"åůÅŮ", "auAU"}, // ring
+	{"çģķļņŗşţÇĢĶĻŅŖŞŢ", "cgklnrstCGKLNRST"},                 // cedilla
+	{"čďěňřšťžǎǐǒǔČĎĚŇŘŠŤŽǍǏǑǓ", "cdenrstzaiouCDENRSTZAIOU"}, // caron
+	{"āēīōūĀĒĪŌŪ", "aeiouAEIOU"},                             // macron
+	{"ăĕğĭŏŭĂĔĞĬŎŬ", "aegiouAEGIOU"},                         // breve
+	{"ąęįųĄĘĮŲ", "aeiuAEIU"},                                 // ogonek
+	{"ċėġżĊĖĠŻ", "cegzCEGZ"},                                 // dot above
+	{"đłøħŧĐŁØĦŦ", "dlohtDLOHT"},                             // stroke
+	{"őűŐŰ", "ouOU"},                                         // double acute
+}
+
+// latinLigatures are the letters that collationKey sorts as two letters.
+var latinLigatures = map[rune]string{
+	'æ': "ae", 'Æ': "AE", 'œ': "oe", 'Œ': "OE", 'ß': "ss", 'ẞ': "SS",
+}
+
+type latinLetter struct {
+	base   string
+	accent byte
+}
+
+var latinLetters = make(map[rune]latinLetter)
+
+func init() {
+	for i, a := range latinAccents {
+		bases := []rune(a.bases)
+		for j, r := range []rune(a.letters) {
+			latinLetters[r] = latinLetter{string(bases[j]), byte(i + 1)}
+		}
+	}
+	for r, base := range latinLigatures {
+		latinLetters[r] = latinLetter{base, byte(len(latinAccents) + 1)}
+	}
+}
+
+// collationKey returns a key for s such that the keys of two strings compare
+// byte by byte in the order of a dictionary of Latin text: first by their
+// letters, ignoring accents and case, then by their accents, and last by
+// their case, lower case first.  So "cote" < "côte" < "Côte" < "coter".
+// Accented letters are known from the Latin-1 Supplement and Latin
+// Extended-A blocks, and a few others, and the order is the same for every
+// language.
+func collationKey(s string) string {
+	var primary, secondary, tertiary strings.Builder
+	for _, r := range s {
+		letter, ok := latinLetters[r]
+		if !ok {
+			letter.base = string(r)
+		}
+		for _, b := range letter.base {
+			primary.WriteRune(unicode.ToLower(b))
+			secondary.WriteByte(letter.accent + 1)
+			if unicode.IsUpper(b) {
+				tertiary.WriteByte(2)
+			} else {
+				tertiary.WriteByte(1)
+			}
+		}
+	}
+	return primary.String() + "\x00" + secondary.String() + "\x00" + tertiary.String()
+}
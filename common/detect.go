@@ -0,0 +1,128 @@
+package common
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"math"
+)
+
+// delimiterCandidates are the separators InferDelimiter chooses between
+// unless given others, in order of preference when they fit the input
+// equally well.
+var delimiterCandidates = []rune{',', '\t', ';', '|'}
+
+// detectLines is the number of lines InferDelimiter looks at unless given
+// another.
+const detectLines = 20
+
+// InferDelimiter chooses the separator of the CSV data read from r among
+// candidates, the comma, tab, semicolon and bar if nil, from its first
+// sampleLines lines, 20 if not positive.  Each candidate is scored by how
+// consistently it splits the lines into the same number of fields, as
+// 1/(1+d), where d is the standard deviation of the number of fields of
+// each line, so that 1 is a perfect score.  A candidate that does not occur
+// at all scores 0.  Between candidates scoring the same, the one giving more
+// fields is chosen, and then the earlier.  InferDelimiter returns the chosen
+// candidate with its score; if none occurs, it returns the first with a
+// score of 0.
+func InferDelimiter(r io.Reader, candidates []rune, sampleLines int) (rune, float64, error) {
+	if candidates == nil {
+		candidates = delimiterCandidates
+	}
+	if sampleLines <= 0 {
+		sampleLines = detectLines
+	}
+	var lines [][]byte
+	br := bufio.NewReader(r)
+	for len(lines) < sampleLines {
+		line, err := readLogicalLine(br)
+		line = bytes.TrimRight(line, "\r\n")
+		if len(line) > 0 {
+			lines = append(lines, line)
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return 0, 0, err
+		}
+	}
+	var best rune
+	bestScore, bestMean := 0.0, 0.0
+	for i, c := range candidates {
+		score, mean := delimiterScore(lines, c)
+		if i == 0 || score > bestScore || (score == bestScore && mean > bestMean) {
+			best, bestScore, bestMean = c, score, mean
+		}
+	}
+	return best, bestScore, nil
+}
+
+// delimiterScore returns the score InferDelimiter gives c on lines, and the
+// mean number of fields c splits them into.
+func delimiterScore(lines [][]byte, c rune) (score, mean float64) {
+	if len(lines) == 0 {
+		return 0, 0
+	}
+	counts := make([]float64, len(lines))
+	found := false
+	for i, line := range lines {
+		n := countUnquoted(line, c)
+		found = found || n > 0
+		counts[i] = float64(n + 1)
+		mean += counts[i]
+	}
+	if !found {
+		return 0, 0
+	}
+	mean /= float64(len(lines))
+	variance := 0.0
+	for _, n := range counts {
+		variance += (n - mean) * (n - mean)
+	}
+	variance /= float64(len(lines))
+	return 1 / (1 + math.Sqrt(variance)), mean
+}
+
+// countUnquoted counts the occurrences of c in line outside of quoted fields.
+func countUnquoted(line []byte, c rune) int {
+	count := 0
+	quoted := false
+	for _, r := range string(line) {
+		switch {
+		case r == '"':
+			quoted = !quoted
+		case !quoted && r == c:
+			count++
+		}
+	}
+	return count
+}
+
+// DetectLineEnding returns the first line ending in data outside of any
+// quoted field, as one of the -newline flag values "lf", "crlf" or "cr", or
+// "" if there is none.
+func DetectLineEnding(data []byte) string {
+	quoted := false
+	for i, b := range data {
+		switch {
+		case b == '"':
+			quoted = !quoted
+		case quoted:
+		case b == '\n':
+			return "lf"
+		case b == '\r':
+			if i+1 < len(data) && data[i+1] == '\n' {
+				return "crlf"
+			}
+			return "cr"
+		}
+	}
+	return ""
+}
+
+// HasBOM reports whether data begins with a UTF-8 byte order mark.
+func HasBOM(data []byte) bool {
+	return bytes.HasPrefix(data, []byte(utf8BOM))
+}
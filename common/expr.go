@@ -0,0 +1,541 @@
+package common
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Value is the result of evaluating an expression.  Every value has a string
+// form; numeric values also carry their number.
+type Value struct {
+	Str   string
+	Num   float64
+	IsNum bool
+}
+
+func stringValue(s string) Value {
+	return Value{Str: s}
+}
+
+func numberValue(f float64) Value {
+	return Value{Str: strconv.FormatFloat(f, 'g', -1, 64), Num: f, IsNum: true}
+}
+
+func boolValue(b bool) Value {
+	if b {
+		return numberValue(1)
+	}
+	return numberValue(0)
+}
+
+// Number returns the numeric value of v, parsing its string form if needed.
+func (v Value) Number() (float64, bool) {
+	if v.IsNum {
+		return v.Num, true
+	}
+	f, err := strconv.ParseFloat(strings.TrimSpace(v.Str), 64)
+	return f, err == nil
+}
+
+// Truth reports whether v counts as true: non-zero numbers and non-empty
+// strings are true.
+func (v Value) Truth() bool {
+	if f, ok := v.Number(); ok {
+		return f != 0
+	}
+	return v.Str != ""
+}
+
+// CompareValues compares a and b numerically if both are numbers, and as
+// strings otherwise.  When only one is a number, it sorts first.
+func CompareValues(a, b Value) int {
+	fa, aok := a.Number()
+	fb, bok := b.Number()
+	switch {
+	case aok && bok:
+		switch {
+		case fa < fb:
+			return -1
+		case fa > fb:
+			return 1
+		}
+		return 0
+	case aok:
+		return -1
+	case bok:
+		return 1
+	}
+	return strings.Compare(a.Str, b.Str)
+}
+
+// compareOperands compares the operands of a comparison operator.  Unlike
+// CompareValues, a number and a string are compared as strings, so that an
+// empty field is neither less nor greater than a number.
+func compareOperands(a, b Value) int {
+	fa, aok := a.Number()
+	fb, bok := b.Number()
+	if aok && bok {
+		switch {
+		case fa < fb:
+			return -1
+		case fa > fb:
+			return 1
+		}
+		return 0
+	}
+	return strings.Compare(a.Str, b.Str)
+}
+
+// Expr is a parsed expression that is evaluated against each record.  Field
+// values are referred to by bare column names, or with col(N), col(name) or
+// col("name"), where N is a field number starting at 1.  Names are resolved
+// against the header by Bind.
+//
+// The operators are, in increasing order of precedence: "||" (or "or"), "&&"
+// (or "and"), the comparisons "==", "!=", "<", "<=", ">", ">=", and the unary
+// "!" (or "not") and "-".  Comparisons are numeric when both sides are
+// numbers, and otherwise compare the string forms.  The functions are len(s),
+// lower(s), upper(s), substr(s, start[, length]) with start counting from 1,
+// and num(s), which converts s to a number.
+type Expr struct {
+	root    exprNode
+	columns []*columnNode
+}
+
+type exprNode interface {
+	eval(record []string) Value
+}
+
+// ParseExpr parses src into an expression.
+func ParseExpr(src string) (*Expr, error) {
+	p := &exprParser{src: src}
+	p.next()
+	root, err := p.parseOr()
+	if err == nil {
+		err = p.err
+	}
+	if err != nil {
+		return nil, err
+	}
+	if p.tok != "" {
+		return nil, fmt.Errorf("%s: unexpected %q in expression", src, p.tok)
+	}
+	return &Expr{root, p.columns}, nil
+}
+
+// Bind resolves the column names used in the expression against header.
+func (e *Expr) Bind(header []string) error {
+	for _, c := range e.columns {
+		if c.name == "" {
+			continue
+		}
+		c.index = -1
+		for i, h := range header {
+			if h == c.name {
+				c.index = i
+				break
+			}
+		}
+		if c.index < 0 {
+			return fmt.Errorf("%s: no such column", c.name)
+		}
+	}
+	return nil
+}
+
+// Eval evaluates the expression against record.  Fields missing from the
+// record evaluate to the empty string.
+func (e *Expr) Eval(record []string) Value {
+	return e.root.eval(record)
+}
+
+type literalNode struct {
+	v Value
+}
+
+func (n *literalNode) eval(record []string) Value {
+	return n.v
+}
+
+type columnNode struct {
+	name  string
+	index int
+}
+
+func (n *columnNode) eval(record []string) Value {
+	if n.index < 0 || n.index >= len(record) {
+		return stringValue("")
+	}
+	return stringValue(record[n.index])
+}
+
+type notNode struct {
+	x exprNode
+}
+
+func (n *notNode) eval(record []string) Value {
+	return boolValue(!n.x.eval(record).Truth())
+}
+
+// negNode negates a number.  The negation of a value that is not a number is
+// the empty string.
+type negNode struct {
+	x exprNode
+}
+
+func (n *negNode) eval(record []string) Value {
+	if f, ok := n.x.eval(record).Number(); ok {
+		return numberValue(-f)
+	}
+	return stringValue("")
+}
+
+type binaryNode struct {
+	op   string
+	l, r exprNode
+}
+
+func (n *binaryNode) eval(record []string) Value {
+	switch n.op {
+	case "||":
+		return boolValue(n.l.eval(record).Truth() || n.r.eval(record).Truth())
+	case "&&":
+		return boolValue(n.l.eval(record).Truth() && n.r.eval(record).Truth())
+	}
+	c := compareOperands(n.l.eval(record), n.r.eval(record))
+	switch n.op {
+	case "==":
+		return boolValue(c == 0)
+	case "!=":
+		return boolValue(c != 0)
+	case "<":
+		return boolValue(c < 0)
+	case "<=":
+		return boolValue(c <= 0)
+	case ">":
+		return boolValue(c > 0)
+	default:
+		return boolValue(c >= 0)
+	}
+}
+
+type callNode struct {
+	fn   func(args []Value) Value
+	args []exprNode
+}
+
+func (n *callNode) eval(record []string) Value {
+	args := make([]Value, len(n.args))
+	for i, a := range n.args {
+		args[i] = a.eval(record)
+	}
+	return n.fn(args)
+}
+
+type exprFunc struct {
+	minArgs, maxArgs int
+	fn               func(args []Value) Value
+}
+
+var exprFuncs = map[string]exprFunc{
+	"len": {1, 1, func(args []Value) Value {
+		return numberValue(float64(utf8.RuneCountInString(args[0].Str)))
+	}},
+	"lower": {1, 1, func(args []Value) Value {
+		return stringValue(strings.ToLower(args[0].Str))
+	}},
+	"upper": {1, 1, func(args []Value) Value {
+		return stringValue(strings.ToUpper(args[0].Str))
+	}},
+	"num": {1, 1, func(args []Value) Value {
+		if f, ok := args[0].Number(); ok {
+			return numberValue(f)
+		}
+		return args[0]
+	}},
+	"substr": {2, 3, func(args []Value) Value {
+		s := []rune(args[0].Str)
+		start, _ := args[1].Number()
+		i := int(start) - 1
+		if i < 0 {
+			i = 0
+		}
+		if i > len(s) {
+			i = len(s)
+		}
+		j := len(s)
+		if len(args) == 3 {
+			length, _ := args[2].Number()
+			if i+int(length) < j {
+				j = i + int(length)
+			}
+		}
+		if j < i {
+			j = i
+		}
+		return stringValue(string(s[i:j]))
+	}},
+}
+
+type exprParser struct {
+	src     string
+	pos     int
+	tok     string
+	kind    byte // 'n'umber, 's'tring, 'i'dentifier, 'o'perator, or 0 at the end
+	err     error
+	columns []*columnNode
+}
+
+var exprKeywords = map[string]string{"and": "&&", "or": "||", "not": "!"}
+
+// next advances to the next token.
+func (p *exprParser) next() {
+	for p.pos < len(p.src) && (p.src[p.pos] == ' ' || p.src[p.pos] == '\t') {
+		p.pos++
+	}
+	start := p.pos
+	if p.pos >= len(p.src) {
+		p.tok, p.kind = "", 0
+		return
+	}
+	c := p.src[p.pos]
+	switch {
+	case c >= '0' && c <= '9' || c == '.':
+		for p.pos < len(p.src) && (p.src[p.pos] >= '0' && p.src[p.pos] <= '9' || p.src[p.pos] == '.') {
+			p.pos++
+		}
+		p.kind = 'n'
+	case c == '"' || c == '\'':
+		p.pos++
+		for p.pos < len(p.src) && p.src[p.pos] != c {
+			if p.src[p.pos] == '\\' {
+				p.pos++
+			}
+			p.pos++
+		}
+		if p.pos >= len(p.src) {
+			p.err = fmt.Errorf("%s: unterminated string in expression", p.src)
+			p.tok, p.kind = "", 0
+			return
+		}
+		p.pos++
+		p.kind = 's'
+	case isIdentStart(p.src[p.pos:]):
+		for p.pos < len(p.src) {
+			r, size := utf8.DecodeRuneInString(p.src[p.pos:])
+			if r != '_' && !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+				break
+			}
+			p.pos += size
+		}
+		p.kind = 'i'
+		if op, ok := exprKeywords[strings.ToLower(p.src[start:p.pos])]; ok {
+			p.tok, p.kind = op, 'o'
+			return
+		}
+	default:
+		_, size := utf8.DecodeRuneInString(p.src[p.pos:])
+		p.pos += size
+		if size == 1 && p.pos < len(p.src) {
+			switch p.src[start : p.pos+1] {
+			case "==", "!=", "<=", ">=", "&&", "||":
+				p.pos++
+			}
+		}
+		p.kind = 'o'
+	}
+	p.tok = p.src[start:p.pos]
+}
+
+func isIdentStart(s string) bool {
+	r, _ := utf8.DecodeRuneInString(s)
+	return r == '_' || unicode.IsLetter(r)
+}
+
+func (p *exprParser) parseOr() (exprNode, error) {
+	return p.parseBinary(p.parseAnd, "||")
+}
+
+func (p *exprParser) parseAnd() (exprNode, error) {
+	return p.parseBinary(p.parseComparison, "&&")
+}
+
+func (p *exprParser) parseComparison() (exprNode, error) {
+	return p.parseBinary(p.parseUnary, "==", "!=", "<", "<=", ">", ">=")
+}
+
+func (p *exprParser) parseBinary(operand func() (exprNode, error), ops ...string) (exprNode, error) {
+	l, err := operand()
+	if err != nil {
+		return nil, err
+	}
+	for p.kind == 'o' && contains(ops, p.tok) {
+		op := p.tok
+		p.next()
+		r, err := operand()
+		if err != nil {
+			return nil, err
+		}
+		l = &binaryNode{op, l, r}
+	}
+	return l, nil
+}
+
+func (p *exprParser) parseUnary() (exprNode, error) {
+	if p.kind == 'o' && p.tok == "!" {
+		p.next()
+		x, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &notNode{x}, nil
+	}
+	if p.kind == 'o' && p.tok == "-" {
+		p.next()
+		x, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		if l, ok := x.(*literalNode); ok && l.v.IsNum {
+			return &literalNode{numberValue(-l.v.Num)}, nil
+		}
+		return &negNode{x}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *exprParser) parsePrimary() (exprNode, error) {
+	if p.err != nil {
+		return nil, p.err
+	}
+	tok := p.tok
+	switch p.kind {
+	case 'n':
+		p.next()
+		f, err := strconv.ParseFloat(tok, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s: invalid number in expression", tok)
+		}
+		return &literalNode{numberValue(f)}, nil
+	case 's':
+		p.next()
+		s, err := unquote(tok)
+		if err != nil {
+			return nil, err
+		}
+		return &literalNode{stringValue(s)}, nil
+	case 'i':
+		p.next()
+		if p.tok != "(" {
+			return p.column(tok, -1), nil
+		}
+		p.next()
+		if tok == "col" {
+			return p.parseCol()
+		}
+		return p.parseCall(tok)
+	case 'o':
+		if tok == "(" {
+			p.next()
+			x, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			if p.tok != ")" {
+				return nil, fmt.Errorf("%s: missing ')' in expression", p.src)
+			}
+			p.next()
+			return x, nil
+		}
+	}
+	if tok == "" {
+		return nil, fmt.Errorf("%s: unexpected end of expression", p.src)
+	}
+	return nil, fmt.Errorf("%s: unexpected %q in expression", p.src, tok)
+}
+
+// parseCol parses the argument of col(), after the opening parenthesis.
+func (p *exprParser) parseCol() (exprNode, error) {
+	var c *columnNode
+	switch p.kind {
+	case 'n':
+		i, err := strconv.Atoi(p.tok)
+		if err != nil || i <= 0 {
+			return nil, fmt.Errorf("%s: field specifiers must be greater than 0", p.tok)
+		}
+		c = p.column("", i-1)
+	case 'i':
+		c = p.column(p.tok, -1)
+	case 's':
+		name, err := unquote(p.tok)
+		if err != nil {
+			return nil, err
+		}
+		c = p.column(name, -1)
+	default:
+		return nil, fmt.Errorf("%s: col() requires a field number or name", p.src)
+	}
+	p.next()
+	if p.tok != ")" {
+		return nil, fmt.Errorf("%s: missing ')' in expression", p.src)
+	}
+	p.next()
+	return c, nil
+}
+
+// parseCall parses the arguments of a function call, after the opening
+// parenthesis.
+func (p *exprParser) parseCall(name string) (exprNode, error) {
+	f, ok := exprFuncs[name]
+	if !ok {
+		return nil, fmt.Errorf("%s: unknown function", name)
+	}
+	var args []exprNode
+	for p.tok != ")" {
+		if len(args) > 0 {
+			if p.tok != "," {
+				return nil, fmt.Errorf("%s: missing ')' in expression", p.src)
+			}
+			p.next()
+		}
+		arg, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+	}
+	p.next()
+	if len(args) < f.minArgs || len(args) > f.maxArgs {
+		return nil, fmt.Errorf("%s: wrong number of arguments", name)
+	}
+	return &callNode{f.fn, args}, nil
+}
+
+func (p *exprParser) column(name string, index int) *columnNode {
+	c := &columnNode{name, index}
+	p.columns = append(p.columns, c)
+	return c
+}
+
+func unquote(tok string) (string, error) {
+	if tok[0] == '\'' {
+		return strings.Replace(tok[1:len(tok)-1], `\'`, `'`, -1), nil
+	}
+	s, err := strconv.Unquote(tok)
+	if err != nil {
+		return "", fmt.Errorf("%s: invalid string in expression", tok)
+	}
+	return s, nil
+}
+
+func contains(list []string, s string) bool {
+	for _, l := range list {
+		if l == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,280 @@
+package common
+
+import (
+	"bufio"
+	"container/heap"
+	"encoding/csv"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// recordSize estimates the memory taken by record when held in a [][]string:
+// its slice header, a string header for each field, and the bytes of the
+// fields.
+func recordSize(record []string) int64 {
+	size := int64(24 + 16*cap(record))
+	for _, field := range record {
+		size += int64(len(field))
+	}
+	return size
+}
+
+// readSortRecords reads the input for Sort.  If MaxMemory is set, it stops
+// reading, and returns more as true, once the records read take more than
+// MaxMemory, or at the trailer, which it leaves out.
+func (proc *CSVProcessor) readSortRecords(reader *csv.Reader) (records [][]string, more bool, err error) {
+	if proc.MaxMemory <= 0 {
+		records, err = proc.readRecords(reader)
+		return records, false, err
+	}
+	var size int64
+	for {
+		record, err := proc.read(reader)
+		if err == io.EOF {
+			return records, false, nil
+		}
+		if err != nil {
+			return nil, false, err
+		}
+		if proc.isTrailer(record, len(records) == 0 && !proc.NoHeader) {
+			return records, false, nil
+		}
+		records = append(records, record)
+		size += recordSize(record)
+		if size > proc.MaxMemory && len(records) > 2 {
+			return records, true, nil
+		}
+	}
+}
+
+// sortRecord is a record in a sorted run, with its position in the input.
+type sortRecord struct {
+	Fields []string
+	Index  int
+}
+
+// externalSort sorts input that does not fit in MaxMemory.  The input is
+// read in runs of about MaxMemory, each of which is sorted and written to a
+// temporary file, and the runs are then merged.  first holds the records
+// already read, beginning with the header unless NoHeader is set.
+func (proc *CSVProcessor) externalSort(reader *csv.Reader, writer RecordWriter, first [][]string, f CSVCompareFunc, reverse bool) error {
+	if proc.DetectHeader {
+		proc.NoHeader = !LooksLikeHeader(first[0], first[1])
+	}
+	var header []string
+	if proc.NoHeader {
+		header = createHeaderRecord(len(first[0]))
+	} else {
+		header, first = first[0], first[1:]
+	}
+	if proc.HeaderFunc != nil {
+		if err := proc.HeaderFunc(header); err != nil {
+			return err
+		}
+	}
+
+	var runs []*os.File
+	defer func() {
+		for _, run := range runs {
+			run.Close()
+			os.Remove(run.Name())
+		}
+	}()
+	var records [][]string
+	var index []int
+	var size int64
+	flushRun := func() error {
+		proc.sortRecords(records, index, f, reverse)
+		run, err := os.CreateTemp("", "csvsort-")
+		if err != nil {
+			return err
+		}
+		runs = append(runs, run)
+		w := bufio.NewWriter(run)
+		enc := gob.NewEncoder(w)
+		for i, record := range records {
+			if err := enc.Encode(sortRecord{record, index[i]}); err != nil {
+				return err
+			}
+		}
+		records, index, size = records[:0], index[:0], 0
+		return w.Flush()
+	}
+
+	// The last IgnoreEnd records are held back, and dropped at the end.
+	var held [][]string
+	n := 0
+	add := func(record []string) error {
+		if proc.IgnoreEnd > 0 {
+			held = append(held, record)
+			if len(held) <= proc.IgnoreEnd {
+				return nil
+			}
+			record, held = held[0], held[1:]
+		}
+		records = append(records, record)
+		index = append(index, n)
+		n++
+		size += recordSize(record) + 8
+		if size > proc.MaxMemory {
+			return flushRun()
+		}
+		return nil
+	}
+	for i, record := range first {
+		if err := add(record); err != nil {
+			return err
+		}
+		first[i] = nil
+	}
+	for {
+		record, err := proc.read(reader)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if proc.isTrailer(record, false) {
+			break
+		}
+		if err := add(record); err != nil {
+			return err
+		}
+	}
+	if n == 0 {
+		return errors.New("entire file was ignored because of value of 'ignore end'")
+	}
+	if len(records) > 0 {
+		if err := flushRun(); err != nil {
+			return err
+		}
+	}
+	if proc.Verbose {
+		fmt.Fprintf(os.Stderr, "sorted on disk in %d runs\n", len(runs))
+	}
+
+	if proc.LineNumbers {
+		header = append([]string{"N"}, header...)
+	}
+	if err := writer.Write(header); err != nil {
+		return err
+	}
+	merge, err := newRunMerger(runs, f, reverse)
+	if err != nil {
+		return err
+	}
+	var prev []string
+	i := 0
+	for {
+		record, err := merge.next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if proc.DuplicateFunc != nil && prev != nil && proc.DuplicateFunc(prev, record) {
+			continue
+		}
+		prev = record
+		if proc.LineNumbers {
+			record = append([]string{proc.formatLineNumber(i)}, record...)
+		}
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+		i++
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// runMerger merges sorted runs, reading one record at a time from each.  A
+// heap holds the next record of each run, ordered as the runs were sorted.
+// Records are written to runs with their positions in the input, which
+// order records that compare equal, so that the output is as stable as
+// that of a sort in memory.
+type runMerger struct {
+	decoders []*gob.Decoder
+	heads    []sortRecord
+	runs     []int
+	less     func(a, b sortRecord) bool
+}
+
+func newRunMerger(runs []*os.File, f CSVCompareFunc, reverse bool) (*runMerger, error) {
+	m := &runMerger{
+		less: func(a, b sortRecord) bool {
+			if reverse {
+				a, b = b, a
+			}
+			if f(a.Fields, b.Fields) {
+				return true
+			}
+			if f(b.Fields, a.Fields) {
+				return false
+			}
+			return (a.Index < b.Index) != reverse
+		},
+	}
+	for i, run := range runs {
+		if _, err := run.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+		m.decoders = append(m.decoders, gob.NewDecoder(bufio.NewReader(run)))
+		if err := m.push(i); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// push reads the next record of run i onto the heap, unless it is done.
+func (m *runMerger) push(i int) error {
+	var record sortRecord
+	err := m.decoders[i].Decode(&record)
+	if err == io.EOF {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	m.heads = append(m.heads, record)
+	m.runs = append(m.runs, i)
+	heap.Fix(m, len(m.heads)-1)
+	return nil
+}
+
+// next returns the least of the records at the head of the runs.
+func (m *runMerger) next() ([]string, error) {
+	if len(m.heads) == 0 {
+		return nil, io.EOF
+	}
+	record, run := m.heads[0], m.runs[0]
+	heap.Pop(m)
+	return record.Fields, m.push(run)
+}
+
+func (m *runMerger) Len() int {
+	return len(m.heads)
+}
+
+func (m *runMerger) Less(i, j int) bool {
+	return m.less(m.heads[i], m.heads[j])
+}
+
+func (m *runMerger) Swap(i, j int) {
+	m.heads[i], m.heads[j] = m.heads[j], m.heads[i]
+	m.runs[i], m.runs[j] = m.runs[j], m.runs[i]
+}
+
+func (m *runMerger) Push(x interface{}) {}
+
+func (m *runMerger) Pop() interface{} {
+	n := len(m.heads) - 1
+	m.heads, m.runs = m.heads[:n], m.runs[:n]
+	return nil
+}
@@ -0,0 +1,54 @@
+package common
+
+// FieldIndices expands field ranges into the list of field indices they
+// cover, in order.
+func FieldIndices(ranges []*FieldRange) []int {
+	var indices []int
+	for _, r := range ranges {
+		if r.End < 0 {
+			indices = append(indices, r.Start)
+			continue
+		}
+		for i := r.Start; i <= r.End; i++ {
+			indices = append(indices, i)
+		}
+	}
+	return indices
+}
+
+// PadFields returns record with empty fields appended to make it n fields
+// long, or record itself if it is that long already.
+func PadFields(record []string, n int) []string {
+	for len(record) < n {
+		record = append(record, "")
+	}
+	return record
+}
+
+// RemoveFields returns a copy of record without the fields at indices.
+func RemoveFields(record []string, indices []int) []string {
+	drop := make(map[int]bool, len(indices))
+	for _, i := range indices {
+		drop[i] = true
+	}
+	kept := make([]string, 0, len(record))
+	for i, field := range record {
+		if !drop[i] {
+			kept = append(kept, field)
+		}
+	}
+	return kept
+}
+
+// InsertFields returns a copy of record with values inserted before the field
+// at index at.  If at is negative or beyond the end of the record, the values
+// are appended.
+func InsertFields(record []string, at int, values ...string) []string {
+	if at < 0 || at > len(record) {
+		at = len(record)
+	}
+	inserted := make([]string, 0, len(record)+len(values))
+	inserted = append(inserted, record[:at]...)
+	inserted = append(inserted, values...)
+	return append(inserted, record[at:]...)
+}
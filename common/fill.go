@@ -0,0 +1,50 @@
+package common
+
+import (
+	"fmt"
+	"strings"
+)
+
+// FieldFill replaces the empty fields of a record, in some or all of its
+// columns, with a value.
+type FieldFill struct {
+	// Fields are the indices of the fields to fill, or nil for all fields.
+	Fields []int
+	Value  string
+}
+
+// ParseFieldFill parses a fill given as "ranges:value", where ranges is a
+// comma-separated list of field ranges.  The value is everything after the
+// first colon, and may be empty.
+func ParseFieldFill(spec string) (*FieldFill, error) {
+	i := strings.Index(spec, ":")
+	if i < 0 {
+		return nil, fmt.Errorf("%s: fill must be given as ranges:value", spec)
+	}
+	frs, err := ParseFieldRanges(spec[:i])
+	if err != nil {
+		return nil, err
+	}
+	if len(frs) == 0 {
+		return nil, fmt.Errorf("%s: no fields to fill", spec)
+	}
+	return &FieldFill{Fields: FieldIndices(frs), Value: spec[i+1:]}, nil
+}
+
+// Apply fills the empty fields of record in place.  Fields beyond the end of
+// the record are ignored.
+func (f *FieldFill) Apply(record []string) {
+	if f.Fields == nil {
+		for i := range record {
+			if record[i] == "" {
+				record[i] = f.Value
+			}
+		}
+		return
+	}
+	for _, i := range f.Fields {
+		if i < len(record) && record[i] == "" {
+			record[i] = f.Value
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package common
+
+import (
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// FlagSet reports whether the named flag was given on the command line.
+func FlagSet(name string) bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
+
+// StringList is a flag.Value that collects the values of a flag which may be
+// given more than once.
+type StringList []string
+
+func (sl *StringList) String() string {
+	return strings.Join(*sl, ",")
+}
+
+func (sl *StringList) Set(value string) error {
+	*sl = append(*sl, value)
+	return nil
+}
+
+// FieldsPerLine is a flag.Value for the number of fields expected on each
+// input line: a number, -1 for any number, or "strict" for the number on the
+// first line, which is the header unless there is none.  Strict is stored as
+// 0, which is what csv.Reader takes it to mean.
+type FieldsPerLine int
+
+func (f *FieldsPerLine) String() string {
+	if *f == 0 {
+		return "strict"
+	}
+	return strconv.Itoa(int(*f))
+}
+
+func (f *FieldsPerLine) Set(value string) error {
+	if value == "strict" {
+		*f = 0
+		return nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return err
+	}
+	if n < -1 {
+		return fmt.Errorf("%d: fields per line must be -1, strict or a positive number", n)
+	}
+	*f = FieldsPerLine(n)
+	return nil
+}
+
+// ByteSize is a flag.Value for a number of bytes, which may be followed by
+// one of the units K, M or G, optionally followed by B, for multiples of
+// 1024, as in 512MB.
+type ByteSize int64
+
+func (b *ByteSize) String() string {
+	return strconv.FormatInt(int64(*b), 10)
+}
+
+func (b *ByteSize) Set(value string) error {
+	s := strings.TrimSuffix(strings.ToUpper(strings.TrimSpace(value)), "B")
+	unit := int64(1)
+	if n := len(s); n > 0 {
+		switch s[n-1] {
+		case 'K':
+			unit = 1 << 10
+		case 'M':
+			unit = 1 << 20
+		case 'G':
+			unit = 1 << 30
+		}
+		if unit > 1 {
+			s = s[:n-1]
+		}
+	}
+	n, err := strconv.ParseInt(strings.TrimSpace(s), 10, 64)
+	if err != nil || n < 0 {
+		return fmt.Errorf("%s: size must be a number of bytes, such as 512MB", value)
+	}
+	*b = ByteSize(n * unit)
+	return nil
+}
@@ -0,0 +1,45 @@
+package common
+
+import "sort"
+
+// FrequencyCounter counts the number of times each value occurs.
+type FrequencyCounter struct {
+	counts map[string]int
+	total  int
+}
+
+// ValueCount is a value and the number of times it occurred.
+type ValueCount struct {
+	Value string
+	Count int
+}
+
+func NewFrequencyCounter() *FrequencyCounter {
+	return &FrequencyCounter{counts: make(map[string]int)}
+}
+
+func (fc *FrequencyCounter) Add(value string) {
+	fc.counts[value]++
+	fc.total++
+}
+
+// Total returns the number of values added.
+func (fc *FrequencyCounter) Total() int {
+	return fc.total
+}
+
+// Sorted returns the distinct values with their counts, most frequent first.
+// Values with equal counts are in ascending order.
+func (fc *FrequencyCounter) Sorted() []ValueCount {
+	counts := make([]ValueCount, 0, len(fc.counts))
+	for v, n := range fc.counts {
+		counts = append(counts, ValueCount{v, n})
+	}
+	sort.Slice(counts, func(i, j int) bool {
+		if counts[i].Count != counts[j].Count {
+			return counts[i].Count > counts[j].Count
+		}
+		return counts[i].Value < counts[j].Value
+	})
+	return counts
+}
@@ -0,0 +1,136 @@
+package common
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// NormalizeHeader returns a copy of header with every name trimmed, lower
+// cased and with each run of characters other than letters and digits
+// replaced by a single underscore.  Names that collide are made unique by
+// appending "_2", "_3" and so on.
+func NormalizeHeader(header []string) []string {
+	normalized := make([]string, len(header))
+	seen := make(map[string]bool, len(header))
+	for i, name := range header {
+		n := normalizeName(name)
+		if seen[n] {
+			suffix := 2
+			for seen[n+"_"+strconv.Itoa(suffix)] {
+				suffix++
+			}
+			n += "_" + strconv.Itoa(suffix)
+		}
+		seen[n] = true
+		normalized[i] = n
+	}
+	return normalized
+}
+
+func normalizeName(name string) string {
+	var b strings.Builder
+	pending := false
+	for _, r := range strings.ToLower(strings.TrimSpace(name)) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if pending && b.Len() > 0 {
+				b.WriteByte('_')
+			}
+			pending = false
+			b.WriteRune(r)
+		} else {
+			pending = true
+		}
+	}
+	if b.Len() == 0 {
+		return "column"
+	}
+	return b.String()
+}
+
+// FindColumn returns the index of the first column of header named name, or
+// -1 if there is none.  With foldCase, names also match regardless of case,
+// though a column named exactly name is still preferred, and ambiguous
+// reports whether names that differ only in case, such as "Email" and
+// "email", both matched.
+func FindColumn(header []string, name string, foldCase bool) (index int, ambiguous bool) {
+	index = -1
+	for i, n := range header {
+		if n == name {
+			index = i
+			break
+		}
+	}
+	if !foldCase {
+		return index, false
+	}
+	for i, n := range header {
+		if n == name || !strings.EqualFold(n, name) {
+			continue
+		}
+		if index < 0 {
+			index = i
+		} else if header[index] != n {
+			ambiguous = true
+		}
+	}
+	return index, ambiguous
+}
+
+// FindColumns returns the index in header of each of names, found with
+// FindColumn.  A name that is not in the header may be a column number,
+// starting at 1.  If a name matches more than one column ignoring case, a
+// warning naming the one used is written to standard error.
+func FindColumns(header []string, names []string, foldCase bool) ([]int, error) {
+	indices := make([]int, 0, len(names))
+	for _, name := range names {
+		index, ambiguous := FindColumn(header, name, foldCase)
+		if ambiguous {
+			fmt.Fprintf(os.Stderr, "warning: %s: more than one column matches ignoring case, using %s\n", name, header[index])
+		}
+		if index < 0 {
+			n, err := strconv.Atoi(name)
+			if err != nil || n < 1 || n > len(header) {
+				return nil, fmt.Errorf("%s: no such column in header", name)
+			}
+			index = n - 1
+		}
+		indices = append(indices, index)
+	}
+	return indices, nil
+}
+
+// LooksLikeHeader guesses whether first, the first row of a file, is a
+// header, given second, the row after it.  It is taken to be a header if
+// none of its fields is a number while at least one field of second is.
+// With no second row there is nothing to compare, and it is not a header.
+func LooksLikeHeader(first, second []string) bool {
+	if len(first) == 0 || second == nil {
+		return false
+	}
+	for _, field := range first {
+		if isNumber(field) {
+			return false
+		}
+	}
+	for _, field := range second {
+		if isNumber(field) {
+			return true
+		}
+	}
+	return false
+}
+
+// isNumber reports whether field, ignoring surrounding space, is a decimal
+// number.  Words that ParseFloat accepts, such as "Inf" and "NaN", are not
+// numbers here, since they are also plausible column names.
+func isNumber(field string) bool {
+	field = strings.TrimSpace(field)
+	if field == "" || !strings.ContainsAny(field[:1], "+-.0123456789") {
+		return false
+	}
+	_, err := strconv.ParseFloat(field, 64)
+	return err == nil && !strings.ContainsAny(field, "nN")
+}
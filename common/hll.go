@@ -0,0 +1,90 @@
+package common
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math"
+	"math/bits"
+)
+
+// HyperLogLog estimates the number of distinct values added to it in a fixed
+// amount of memory: 2^precision bytes.  The relative standard error of the
+// estimate is about 1.04/sqrt(2^precision), which is 0.8% for a precision
+// of 14.
+type HyperLogLog struct {
+	precision uint
+	registers []uint8
+}
+
+// NewHyperLogLog returns an empty estimator with the given precision, which
+// must be from 4 to 18.
+func NewHyperLogLog(precision int) (*HyperLogLog, error) {
+	if precision < 4 || precision > 18 {
+		return nil, fmt.Errorf("%d: precision must be from 4 to 18", precision)
+	}
+	return &HyperLogLog{precision: uint(precision), registers: make([]uint8, 1<<uint(precision))}, nil
+}
+
+// Add adds a value.  Adding a value again does not change the estimate.
+func (h *HyperLogLog) Add(value string) {
+	x := hash64(value)
+	index := x >> (64 - h.precision)
+	// The bit set after the remaining bits bounds the count of leading
+	// zeros when they are all zero.
+	rest := x<<h.precision | 1<<(h.precision-1)
+	rank := uint8(bits.LeadingZeros64(rest)) + 1
+	if rank > h.registers[index] {
+		h.registers[index] = rank
+	}
+}
+
+// Estimate returns the estimated number of distinct values added.
+func (h *HyperLogLog) Estimate() float64 {
+	m := float64(len(h.registers))
+	sum := 0.0
+	zeros := 0
+	for _, r := range h.registers {
+		sum += math.Ldexp(1, -int(r))
+		if r == 0 {
+			zeros++
+		}
+	}
+	estimate := h.alpha() * m * m / sum
+	if estimate <= 2.5*m && zeros > 0 {
+		// Linear counting is more accurate for small numbers of values.
+		estimate = m * math.Log(m/float64(zeros))
+	}
+	return estimate
+}
+
+// StandardError returns the relative standard error of Estimate.
+func (h *HyperLogLog) StandardError() float64 {
+	return 1.04 / math.Sqrt(float64(len(h.registers)))
+}
+
+func (h *HyperLogLog) alpha() float64 {
+	switch m := len(h.registers); m {
+	case 16:
+		return 0.673
+	case 32:
+		return 0.697
+	case 64:
+		return 0.709
+	default:
+		return 0.7213 / (1 + 1.079/float64(m))
+	}
+}
+
+// hash64 hashes s with FNV-1a and then mixes the bits, since HyperLogLog
+// needs every bit of the hash to be evenly distributed.
+func hash64(s string) uint64 {
+	f := fnv.New64a()
+	f.Write([]byte(s))
+	x := f.Sum64()
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
@@ -0,0 +1,182 @@
+package common
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// retryBackoff is the delay before the first retry of a failed request; it
+// doubles with every further attempt.
+var retryBackoff = 500 * time.Millisecond
+
+// openURL performs a GET request for rawurl and returns the response body.
+// Requests failing with a transient error are retried up to InputURLRetries
+// times, each attempt waiting at most InputURLTimeout for a response.  Bodies
+// that are gzipped, according to the URL path or the content type, are
+// decompressed.
+func (proc *CSVProcessor) openURL(rawurl string) (io.Reader, error) {
+	req, err := http.NewRequest("GET", rawurl, nil)
+	if err != nil {
+		return nil, err
+	}
+	err = addHeaders(req, proc.InputURLHeaders)
+	if err != nil {
+		return nil, err
+	}
+	timeout := proc.InputURLTimeout
+	client := &http.Client{
+		Transport: &http.Transport{
+			Proxy:                 http.ProxyFromEnvironment,
+			DialContext:           (&net.Dialer{Timeout: timeout}).DialContext,
+			TLSHandshakeTimeout:   timeout,
+			ResponseHeaderTimeout: timeout,
+		},
+	}
+	var resp *http.Response
+	for attempt := 0; ; attempt++ {
+		resp, err = client.Do(req)
+		if attempt >= proc.InputURLRetries || !isTransient(resp, err) {
+			break
+		}
+		if err == nil {
+			resp.Body.Close()
+		}
+		time.Sleep(retryBackoff << uint(attempt))
+	}
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("%s: unexpected response %s", rawurl, resp.Status)
+	}
+	body := &urlBody{resp.Body, rawurl}
+	if !isGzipped(req.URL, resp.Header.Get("Content-Type")) {
+		return body, nil
+	}
+	gz, err := gzip.NewReader(body)
+	if err != nil {
+		body.Close()
+		return nil, err
+	}
+	return &gzipBody{gz, body}, nil
+}
+
+// isTransient reports whether a request that ended with resp and err is worth
+// retrying.
+func isTransient(resp *http.Response, err error) bool {
+	if err == nil {
+		return resp.StatusCode >= 500
+	}
+	var netErr net.Error
+	return errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF) ||
+		(errors.As(err, &netErr) && netErr.Timeout())
+}
+
+// urlBody adds the URL to errors that occur while reading a response body.
+type urlBody struct {
+	io.ReadCloser
+	url string
+}
+
+func (ub *urlBody) Read(p []byte) (int, error) {
+	n, err := ub.ReadCloser.Read(p)
+	if err != nil && err != io.EOF {
+		err = fmt.Errorf("%s: error reading response: %w", ub.url, err)
+	}
+	return n, err
+}
+
+// gzipBody decompresses a response body, and closes it when closed.
+type gzipBody struct {
+	*gzip.Reader
+	body io.Closer
+}
+
+func (gb *gzipBody) Close() error {
+	gb.Reader.Close()
+	return gb.body.Close()
+}
+
+// isURL reports whether name should be fetched over HTTP rather than opened
+// as a file.
+func isURL(name string) bool {
+	return strings.HasPrefix(name, "http://") || strings.HasPrefix(name, "https://")
+}
+
+func addHeaders(req *http.Request, headers []string) error {
+	for _, h := range headers {
+		key, value, ok := strings.Cut(h, ":")
+		if !ok {
+			return fmt.Errorf("%s: invalid header, must be Key:Value", h)
+		}
+		req.Header.Add(strings.TrimSpace(key), strings.TrimSpace(value))
+	}
+	return nil
+}
+
+func isGzipped(u *url.URL, contentType string) bool {
+	switch contentType {
+	case "application/gzip", "application/x-gzip":
+		return true
+	}
+	return strings.HasSuffix(u.Path, ".gz")
+}
+
+// urlWriter streams everything written to it as the body of an HTTP request.
+type urlWriter struct {
+	*io.PipeWriter
+	done chan error
+}
+
+// Close ends the request body and waits for the response.
+func (uw *urlWriter) Close() error {
+	uw.PipeWriter.Close()
+	return <-uw.done
+}
+
+// createURL starts an HTTP request with the given method for rawurl, and
+// returns a writer for its body.  The request completes when the writer is
+// closed.
+func createURL(rawurl, method string, headers []string) (io.WriteCloser, error) {
+	switch method {
+	case "POST", "PUT":
+	default:
+		return nil, fmt.Errorf("%s: invalid method, must be POST or PUT", method)
+	}
+	pr, pw := io.Pipe()
+	req, err := http.NewRequest(method, rawurl, pr)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "text/csv")
+	err = addHeaders(req, headers)
+	if err != nil {
+		return nil, err
+	}
+	done := make(chan error, 1)
+	go func() {
+		resp, err := http.DefaultClient.Do(req)
+		if err == nil {
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+			if resp.StatusCode/100 != 2 {
+				err = fmt.Errorf("%s: unexpected response %s", rawurl, resp.Status)
+			}
+		}
+		if err != nil {
+			pr.CloseWithError(err)
+		}
+		done <- err
+	}()
+	return &urlWriter{pw, done}, nil
+}
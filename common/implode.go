@@ -0,0 +1,103 @@
+package common
+
+import "fmt"
+
+// ImplodeProcessor is a RecordWriter that merges runs of consecutive records
+// which are equal in every field except ImplodeColumn, joining the values of
+// that field with ImplodeSeparator.  The first record written is the header,
+// and is passed through unchanged.
+type ImplodeProcessor struct {
+	ImplodeColumn    int
+	ImplodeSeparator string
+	// SkipFirst excludes the first field, such as a line number, from the
+	// comparison; each merged record keeps the value from the first record
+	// of its run.
+	SkipFirst bool
+
+	Writer RecordWriter
+
+	seenHeader bool
+	group      []string
+	err        error
+}
+
+func (ip *ImplodeProcessor) Write(record []string) error {
+	if ip.err != nil {
+		return ip.err
+	}
+	if !ip.seenHeader {
+		ip.seenHeader = true
+		if ip.ImplodeColumn >= len(record) {
+			ip.err = ip.noSuchField("header", record)
+			return ip.err
+		}
+		return ip.Writer.Write(record)
+	}
+	if ip.ImplodeColumn >= len(record) {
+		ip.err = ip.noSuchField("record", record)
+		return ip.err
+	}
+	if ip.group != nil && ip.sameGroup(record) {
+		ip.group[ip.ImplodeColumn] += ip.ImplodeSeparator + record[ip.ImplodeColumn]
+		return nil
+	}
+	if ip.group != nil {
+		ip.err = ip.Writer.Write(ip.group)
+	}
+	ip.group = append([]string(nil), record...)
+	return ip.err
+}
+
+func (ip *ImplodeProcessor) WriteAll(records [][]string) error {
+	for _, record := range records {
+		if err := ip.Write(record); err != nil {
+			return err
+		}
+	}
+	ip.Flush()
+	return ip.Error()
+}
+
+// Flush writes the pending run of records before flushing the underlying
+// writer.
+func (ip *ImplodeProcessor) Flush() {
+	if ip.group != nil && ip.err == nil {
+		ip.err = ip.Writer.Write(ip.group)
+	}
+	ip.group = nil
+	ip.Writer.Flush()
+}
+
+func (ip *ImplodeProcessor) Error() error {
+	if ip.err != nil {
+		return ip.err
+	}
+	return ip.Writer.Error()
+}
+
+func (ip *ImplodeProcessor) sameGroup(record []string) bool {
+	if len(record) != len(ip.group) {
+		return false
+	}
+	for i := range record {
+		if i == ip.ImplodeColumn || (i == 0 && ip.SkipFirst) {
+			continue
+		}
+		if record[i] != ip.group[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// noSuchField returns the error for a record too short to have the implode
+// column, numbering the column from 1 as it was given, and not counting the
+// skipped first field.
+func (ip *ImplodeProcessor) noSuchField(what string, record []string) error {
+	column, length := ip.ImplodeColumn+1, len(record)
+	if ip.SkipFirst {
+		column--
+		length--
+	}
+	return fmt.Errorf("%d: no such field in %s of length %d", column, what, length)
+}
@@ -0,0 +1,133 @@
+package common
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// jsonLinesWriter writes each record as a JSON object on a line of its own.
+// The first record written is taken as the header, and supplies the keys of
+// the objects that follow.
+type jsonLinesWriter struct {
+	w       *bufio.Writer
+	keys    []string
+	newline string
+	// typed writes values that parse as numbers or booleans unquoted.
+	typed bool
+	// array keeps the objects instead, and writes them as an indented JSON
+	// array when the writer is first flushed, which must be after the last
+	// record is written.
+	array   bool
+	objects [][]byte
+	flushed bool
+	err     error
+}
+
+func newJSONLinesWriter(output io.Writer, useCRLF, typed, array bool) *jsonLinesWriter {
+	newline := "\n"
+	if useCRLF {
+		newline = "\r\n"
+	}
+	return &jsonLinesWriter{w: bufio.NewWriter(output), newline: newline, typed: typed, array: array}
+}
+
+func (jw *jsonLinesWriter) Write(record []string) error {
+	if jw.err != nil {
+		return jw.err
+	}
+	if jw.keys == nil {
+		jw.keys = append([]string{}, record...)
+		return nil
+	}
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, field := range record {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key := fmt.Sprintf("C%d", i+1)
+		if i < len(jw.keys) {
+			key = jw.keys[i]
+		}
+		writeJSONString(&buf, key)
+		buf.WriteByte(':')
+		jw.writeValue(&buf, field)
+	}
+	buf.WriteByte('}')
+	if jw.array {
+		jw.objects = append(jw.objects, buf.Bytes())
+		return nil
+	}
+	buf.WriteString(jw.newline)
+	_, jw.err = jw.w.Write(buf.Bytes())
+	return jw.err
+}
+
+// writeArray writes the objects kept with array as a JSON array indented by
+// two spaces.  It uses json.Indent, the formatting of json.MarshalIndent,
+// which leaves the strings as writeJSONString wrote them.
+func (jw *jsonLinesWriter) writeArray() error {
+	compact := append([]byte{'['}, bytes.Join(jw.objects, []byte{','})...)
+	compact = append(compact, ']')
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, compact, "", "  "); err != nil {
+		return err
+	}
+	s := strings.Replace(buf.String(), "\n", jw.newline, -1)
+	_, err := jw.w.WriteString(s + jw.newline)
+	return err
+}
+
+func (jw *jsonLinesWriter) writeValue(buf *bytes.Buffer, field string) {
+	if jw.typed {
+		if field == "true" || field == "false" {
+			buf.WriteString(field)
+			return
+		}
+		// ParseFloat accepts forms such as "Inf" and "0x1p4" that are not
+		// JSON numbers, so the field must satisfy both.
+		if _, err := strconv.ParseFloat(field, 64); err == nil && json.Valid([]byte(field)) {
+			buf.WriteString(field)
+			return
+		}
+	}
+	writeJSONString(buf, field)
+}
+
+func (jw *jsonLinesWriter) WriteAll(records [][]string) error {
+	for _, record := range records {
+		if err := jw.Write(record); err != nil {
+			return err
+		}
+	}
+	jw.Flush()
+	return jw.Error()
+}
+
+func (jw *jsonLinesWriter) Flush() {
+	if jw.array && !jw.flushed && jw.err == nil {
+		jw.flushed = true
+		jw.err = jw.writeArray()
+	}
+	if err := jw.w.Flush(); err != nil && jw.err == nil {
+		jw.err = err
+	}
+}
+
+func (jw *jsonLinesWriter) Error() error {
+	return jw.err
+}
+
+// writeJSONString writes s as a JSON string, without escaping the HTML
+// characters that encoding/json escapes by default.
+func writeJSONString(buf *bytes.Buffer, s string) {
+	enc := json.NewEncoder(buf)
+	enc.SetEscapeHTML(false)
+	enc.Encode(s)
+	buf.Truncate(buf.Len() - 1)
+}
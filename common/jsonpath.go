@@ -0,0 +1,233 @@
+package common
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// jsonPathStep is one step of a JSON path: a member name, an array index, or
+// a wildcard selecting every member or element.
+type jsonPathStep struct {
+	name     string
+	index    int
+	isIndex  bool
+	wildcard bool
+}
+
+// parseJSONPath parses a restricted JSONPath: an optional leading "$"
+// followed by any of ".name", ".*", "[N]", "[*]" and "['name']" or
+// "["name"]".
+func parseJSONPath(path string) ([]jsonPathStep, error) {
+	rest := strings.TrimPrefix(strings.TrimSpace(path), "$")
+	var steps []jsonPathStep
+	for rest != "" {
+		switch rest[0] {
+		case '.':
+			rest = rest[1:]
+			end := strings.IndexAny(rest, ".[")
+			if end < 0 {
+				end = len(rest)
+			}
+			name := rest[:end]
+			rest = rest[end:]
+			if name == "" {
+				return nil, fmt.Errorf("%s: empty member name in JSON path", path)
+			}
+			if name == "*" {
+				steps = append(steps, jsonPathStep{wildcard: true})
+			} else {
+				steps = append(steps, jsonPathStep{name: name})
+			}
+		case '[':
+			end := strings.IndexByte(rest, ']')
+			if end < 0 {
+				return nil, fmt.Errorf("%s: missing ] in JSON path", path)
+			}
+			sel := rest[1:end]
+			rest = rest[end+1:]
+			switch {
+			case sel == "*":
+				steps = append(steps, jsonPathStep{wildcard: true})
+			case len(sel) >= 2 && (sel[0] == '\'' || sel[0] == '"') && sel[len(sel)-1] == sel[0]:
+				steps = append(steps, jsonPathStep{name: sel[1 : len(sel)-1]})
+			default:
+				i, err := strconv.Atoi(sel)
+				if err != nil || i < 0 {
+					return nil, fmt.Errorf("%s: invalid index %q in JSON path", path, sel)
+				}
+				steps = append(steps, jsonPathStep{index: i, isIndex: true})
+			}
+		default:
+			return nil, fmt.Errorf("%s: unexpected %q in JSON path", path, rest[0])
+		}
+	}
+	return steps, nil
+}
+
+// EvalJSONPath returns the values in data selected by path, which is a
+// restricted JSONPath as described by parseJSONPath.  Members and elements
+// that do not exist select nothing.
+func EvalJSONPath(data json.RawMessage, path string) ([]json.RawMessage, error) {
+	steps, err := parseJSONPath(path)
+	if err != nil {
+		return nil, err
+	}
+	values := []json.RawMessage{data}
+	for _, step := range steps {
+		var next []json.RawMessage
+		for _, v := range values {
+			selected, err := step.apply(v)
+			if err != nil {
+				return nil, err
+			}
+			next = append(next, selected...)
+		}
+		values = next
+	}
+	return values, nil
+}
+
+func (step jsonPathStep) apply(v json.RawMessage) ([]json.RawMessage, error) {
+	switch jsonKind(v) {
+	case '{':
+		if step.isIndex {
+			return nil, nil
+		}
+		_, members, err := decodeJSONObject(v)
+		if err != nil {
+			return nil, err
+		}
+		if step.wildcard {
+			return members, nil
+		}
+		var obj map[string]json.RawMessage
+		if err := json.Unmarshal(v, &obj); err != nil {
+			return nil, err
+		}
+		if m, ok := obj[step.name]; ok {
+			return []json.RawMessage{m}, nil
+		}
+	case '[':
+		if !step.isIndex && !step.wildcard {
+			return nil, nil
+		}
+		var elements []json.RawMessage
+		if err := json.Unmarshal(v, &elements); err != nil {
+			return nil, err
+		}
+		if step.wildcard {
+			return elements, nil
+		}
+		if step.index < len(elements) {
+			return []json.RawMessage{elements[step.index]}, nil
+		}
+	}
+	return nil, nil
+}
+
+// jsonKind returns the first non-space byte of v, which is '{' for an
+// object and '[' for an array.
+func jsonKind(v json.RawMessage) byte {
+	v = bytes.TrimLeft(v, " \t\r\n")
+	if len(v) == 0 {
+		return 0
+	}
+	return v[0]
+}
+
+// decodeJSONObject returns the member names and values of the object v, in
+// the order they appear.
+func decodeJSONObject(v json.RawMessage) ([]string, []json.RawMessage, error) {
+	dec := json.NewDecoder(bytes.NewReader(v))
+	if _, err := dec.Token(); err != nil {
+		return nil, nil, err
+	}
+	var names []string
+	var values []json.RawMessage
+	for dec.More() {
+		t, err := dec.Token()
+		if err != nil {
+			return nil, nil, err
+		}
+		var value json.RawMessage
+		if err := dec.Decode(&value); err != nil {
+			return nil, nil, err
+		}
+		names = append(names, t.(string))
+		values = append(values, value)
+	}
+	return names, values, nil
+}
+
+// JSONRecords converts values selected from a JSON document into records,
+// the first of which is a header.  Each object is a row, and an array adds
+// each of its elements as a row.  The header holds every member name, in
+// the order they are first seen.  Strings are unquoted, null is empty, and
+// numbers, booleans, objects and arrays are given as JSON.
+func JSONRecords(values []json.RawMessage) ([][]string, error) {
+	var rows []json.RawMessage
+	for _, v := range values {
+		if jsonKind(v) == '[' {
+			var elements []json.RawMessage
+			if err := json.Unmarshal(v, &elements); err != nil {
+				return nil, err
+			}
+			rows = append(rows, elements...)
+		} else {
+			rows = append(rows, v)
+		}
+	}
+	var header []string
+	columns := make(map[string]int)
+	var objects []map[string]string
+	for i, row := range rows {
+		if jsonKind(row) != '{' {
+			return nil, fmt.Errorf("%d: JSON row is not an object", i+1)
+		}
+		names, members, err := decodeJSONObject(row)
+		if err != nil {
+			return nil, err
+		}
+		obj := make(map[string]string, len(names))
+		for j, name := range names {
+			if _, ok := columns[name]; !ok {
+				columns[name] = len(header)
+				header = append(header, name)
+			}
+			obj[name], err = jsonField(members[j])
+			if err != nil {
+				return nil, err
+			}
+		}
+		objects = append(objects, obj)
+	}
+	records := [][]string{header}
+	for _, obj := range objects {
+		record := make([]string, len(header))
+		for i, name := range header {
+			record[i] = obj[name]
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+func jsonField(v json.RawMessage) (string, error) {
+	v = bytes.TrimSpace(v)
+	switch {
+	case len(v) > 0 && v[0] == '"':
+		var s string
+		err := json.Unmarshal(v, &s)
+		return s, err
+	case string(v) == "null":
+		return "", nil
+	}
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, v); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
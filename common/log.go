@@ -0,0 +1,49 @@
+package common
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"runtime/debug"
+)
+
+// logFile is the file opened by SetLogFile, if any.
+var logFile *os.File
+
+// SetLogFile sends the error and warning messages that the tools write to
+// os.Stderr, and the output of the log package, to the file at path instead,
+// appending to it.  Writes to the file are not buffered, so nothing is lost
+// when a tool exits with os.Exit.  An empty path leaves them on standard
+// error.  Usage messages and flag errors, written to the output of
+// flag.CommandLine, stay on standard error, where the user will see them.
+func SetLogFile(path string) error {
+	if path == "" {
+		return nil
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	logFile = f
+	flag.CommandLine.SetOutput(os.Stderr)
+	os.Stderr = f
+	log.SetOutput(f)
+	return nil
+}
+
+// CloseLogFile closes the file opened by SetLogFile, if any.  It is meant to
+// be deferred in main, where it also writes a panic and its stack to the file
+// before letting the panic go on, since the runtime reports panics on
+// standard error regardless of os.Stderr.
+func CloseLogFile() {
+	if logFile == nil {
+		return
+	}
+	if r := recover(); r != nil {
+		fmt.Fprintf(logFile, "panic: %v\n\n%s", r, debug.Stack())
+		logFile.Close()
+		panic(r)
+	}
+	logFile.Close()
+}
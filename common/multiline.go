@@ -0,0 +1,69 @@
+package common
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+)
+
+// multilineReader repairs input in which a field has been broken across
+// lines without being quoted properly.  A line with an odd number of quotes
+// is taken to continue on the next line, and the two are joined with a join
+// string in place of the line ending, until the quotes balance.  This is a
+// heuristic, so a warning is given if any lines were joined.
+type multilineReader struct {
+	r       *bufio.Reader
+	join    []byte
+	pending []byte
+	joined  int
+	err     error
+}
+
+func newMultilineReader(r io.Reader, join string) *multilineReader {
+	return &multilineReader{r: bufio.NewReader(r), join: []byte(join)}
+}
+
+func (mr *multilineReader) Read(p []byte) (int, error) {
+	for len(mr.pending) == 0 {
+		if mr.err != nil {
+			return 0, mr.err
+		}
+		mr.pending, mr.err = mr.readLogicalLine()
+		if mr.err == io.EOF && mr.joined > 0 {
+			fmt.Fprintf(os.Stderr, "warning: %d lines with unbalanced quotes were joined to the next line\n", mr.joined)
+		}
+	}
+	n := copy(p, mr.pending)
+	mr.pending = mr.pending[n:]
+	return n, nil
+}
+
+// readLogicalLine reads a line, joining the lines that follow it for as long
+// as its quotes are unbalanced.
+func (mr *multilineReader) readLogicalLine() ([]byte, error) {
+	line, err := mr.r.ReadBytes('\n')
+	for err == nil && bytes.Count(line, []byte{'"'})%2 == 1 {
+		var next []byte
+		next, err = mr.r.ReadBytes('\n')
+		if len(next) == 0 {
+			break
+		}
+		line = bytes.TrimSuffix(bytes.TrimSuffix(line, []byte{'\n'}), []byte{'\r'})
+		line = append(append(line, mr.join...), next...)
+		mr.joined++
+	}
+	return line, err
+}
+
+// ParseEscapes interprets the backslash escapes of a Go string literal in
+// s, so that a flag may be given as \n or \t.
+func ParseEscapes(s string) (string, error) {
+	unquoted, err := strconv.Unquote(`"` + s + `"`)
+	if err != nil {
+		return "", fmt.Errorf("%s: invalid escape", s)
+	}
+	return unquoted, nil
+}
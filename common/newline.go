@@ -0,0 +1,111 @@
+package common
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"unicode/utf8"
+)
+
+// crWriter replaces every line feed written to it with a bare carriage
+// return, for consumers that expect old Mac OS style line endings.
+type crWriter struct {
+	w io.Writer
+}
+
+func (cw *crWriter) Write(p []byte) (int, error) {
+	_, err := cw.w.Write(bytes.Replace(p, []byte{'\n'}, []byte{'\r'}, -1))
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// crReader replaces every carriage return read through it, outside of any
+// quoted field, with a line feed.  It reads back what crWriter writes, since
+// the csv package only recognizes lines ending with a line feed.
+type crReader struct {
+	r     io.Reader
+	quote quoteTracker
+}
+
+func (cr *crReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	for i, b := range p[:n] {
+		if b == '\r' && !cr.quote.quoted {
+			p[i] = '\n'
+		}
+		cr.quote.next(b)
+	}
+	return n, err
+}
+
+// quoteTracker follows whether a stream of bytes, fed to it one at a time,
+// is inside a quoted field.  The quote is the UTF-8 encoding of a single
+// character, so a byte of it cannot be part of any other character.
+type quoteTracker struct {
+	quote   []byte
+	matched int
+	quoted  bool
+}
+
+func newQuoteTracker(quote string) quoteTracker {
+	if quote == "" {
+		quote = `"`
+	}
+	r, _ := utf8.DecodeRuneInString(quote)
+	return quoteTracker{quote: []byte(string(r))}
+}
+
+func (qt *quoteTracker) next(b byte) {
+	if b != qt.quote[qt.matched] {
+		qt.matched = 0
+		return
+	}
+	qt.matched++
+	if qt.matched == len(qt.quote) {
+		qt.quoted = !qt.quoted
+		qt.matched = 0
+	}
+}
+
+// crPeekSize is the size of the buffer of the reader passed to
+// hasCRLineEndings, and so the longest first line whose ending it finds.
+const crPeekSize = 64 * 1024
+
+// hasCRLineEndings reports whether the first line ending in the buffered
+// input, outside of any field quoted with quote, is a bare carriage return.
+// It peeks only as far as that line ending, one byte past it at most, so
+// that input arriving slowly, such as from a pipe, is not held up until the
+// buffer is full.
+func hasCRLineEndings(br *bufio.Reader, quote string) bool {
+	qt := newQuoteTracker(quote)
+	for i := 0; ; i++ {
+		buf, _ := br.Peek(i + 1)
+		if len(buf) <= i {
+			// The input, or the buffer, ends before any line ending.
+			return false
+		}
+		b := buf[i]
+		if !qt.quoted {
+			switch b {
+			case '\n':
+				return false
+			case '\r':
+				buf, err := br.Peek(i + 2)
+				if len(buf) > i+1 {
+					return buf[i+1] != '\n'
+				}
+				return err == io.EOF
+			}
+		}
+		qt.next(b)
+	}
+}
+
+// NewCRReader returns a reader that replaces every carriage return in r with
+// a line feed, so that input with bare carriage return line endings can be
+// read with the csv package.
+func NewCRReader(r io.Reader) io.Reader {
+	return &crReader{r: r, quote: newQuoteTracker(`"`)}
+}
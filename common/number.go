@@ -0,0 +1,63 @@
+package common
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// NumberFormat gives the decimal mark and grouping separator of the numbers
+// in the input, for data written as 1.234,56 rather than 1,234.56.  The zero
+// value is the usual form, with a point as the decimal mark and no grouping.
+type NumberFormat struct {
+	Decimal string
+	Group   string
+}
+
+// NewNumberFormat returns the NumberFormat with the given decimal mark, "."
+// if empty, and grouping separator, none if empty.
+func NewNumberFormat(decimal, group string) (NumberFormat, error) {
+	if decimal == "" {
+		decimal = "."
+	}
+	for _, s := range []string{decimal, group} {
+		if strings.ContainsAny(s, "0123456789+-eE") {
+			return NumberFormat{}, fmt.Errorf("%s: a decimal mark or grouping separator may not contain digits, signs or exponents", s)
+		}
+	}
+	if decimal == group {
+		return NumberFormat{}, fmt.Errorf("%s: the decimal mark and grouping separator must differ", decimal)
+	}
+	return NumberFormat{decimal, group}, nil
+}
+
+// Parse parses s, less any white space around it, as a number in this
+// format.  Grouping separators are dropped wherever they appear, and a point
+// that is neither the decimal mark nor a grouping separator makes s not a
+// number.
+func (nf NumberFormat) Parse(s string) (float64, error) {
+	s = strings.TrimSpace(s)
+	decimal := nf.Decimal
+	if decimal == "" {
+		decimal = "."
+	}
+	if decimal == "." && nf.Group == "" {
+		return strconv.ParseFloat(s, 64)
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); {
+		switch {
+		case nf.Group != "" && strings.HasPrefix(s[i:], nf.Group):
+			i += len(nf.Group)
+		case strings.HasPrefix(s[i:], decimal):
+			b.WriteByte('.')
+			i += len(decimal)
+		case s[i] == '.':
+			return 0, &strconv.NumError{Func: "ParseFloat", Num: s, Err: strconv.ErrSyntax}
+		default:
+			b.WriteByte(s[i])
+			i++
+		}
+	}
+	return strconv.ParseFloat(b.String(), 64)
+}
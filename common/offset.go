@@ -0,0 +1,57 @@
+package common
+
+import (
+	"bytes"
+	"io"
+)
+
+// byteCounter counts the bytes read through it.
+type byteCounter struct {
+	r io.Reader
+	n int64
+}
+
+func (bc *byteCounter) Read(p []byte) (int, error) {
+	n, err := bc.r.Read(p)
+	bc.n += int64(n)
+	return n, err
+}
+
+// lineOffsets passes on what is read from r, keeping the byte offset at
+// which each line starts from the earliest line still wanted, so that the
+// offset of a record read by the csv package can be found from its line.
+// Lines are numbered from 1, as by the csv package, and offsets count from
+// base, the number of bytes of the input before r.
+type lineOffsets struct {
+	r      io.Reader
+	base   int64
+	n      int64
+	first  int
+	starts []int64
+}
+
+func newLineOffsets(r io.Reader, base int64) *lineOffsets {
+	return &lineOffsets{r: r, base: base, n: base, first: 1, starts: []int64{base}}
+}
+
+func (lo *lineOffsets) Read(p []byte) (int, error) {
+	n, err := lo.r.Read(p)
+	data := p[:n]
+	for i := bytes.IndexByte(data, '\n'); i >= 0; i = bytes.IndexByte(data, '\n') {
+		lo.n += int64(i + 1)
+		lo.starts = append(lo.starts, lo.n)
+		data = data[i+1:]
+	}
+	lo.n += int64(len(data))
+	return n, err
+}
+
+// start returns the offset of the start of line n, and forgets the lines
+// before it.  Lines must be asked for in order.
+func (lo *lineOffsets) start(n int) int64 {
+	if i := n - lo.first; i > 0 && i < len(lo.starts) {
+		lo.starts = lo.starts[i:]
+		lo.first = n
+	}
+	return lo.starts[0]
+}
@@ -0,0 +1,89 @@
+package common
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+)
+
+// previewKeep is the number of bytes of recent lines that a lineRecorder
+// keeps, which must be more than the csv package reads ahead of the record
+// it returns.
+const previewKeep = 64 * 1024
+
+// previewLength is the number of bytes of a line shown with an error.
+const previewLength = 200
+
+// lineRecorder passes on what is read from r, keeping the most recent lines
+// so that the line on which the csv package reports an error, which it has
+// already consumed, can be shown.  Lines are numbered from 1, as by the csv
+// package.
+type lineRecorder struct {
+	r       io.Reader
+	lines   [][]byte
+	first   int
+	size    int
+	partial []byte
+}
+
+func newLineRecorder(r io.Reader) *lineRecorder {
+	return &lineRecorder{r: r, first: 1}
+}
+
+func (lr *lineRecorder) Read(p []byte) (int, error) {
+	n, err := lr.r.Read(p)
+	data := p[:n]
+	for len(data) > 0 {
+		end := bytes.IndexByte(data, '\n')
+		if end < 0 {
+			lr.partial = append(lr.partial, data...)
+			break
+		}
+		line := append(lr.partial, data[:end]...)
+		lr.partial = nil
+		lr.lines = append(lr.lines, line)
+		lr.size += len(line)
+		data = data[end+1:]
+	}
+	for len(lr.lines) > 1 && lr.size > previewKeep {
+		lr.size -= len(lr.lines[0])
+		lr.lines = lr.lines[1:]
+		lr.first++
+	}
+	return n, err
+}
+
+// line returns the text of line n, without its line ending and cut short
+// if it is long, or false if it is no longer kept.
+func (lr *lineRecorder) line(n int) (string, bool) {
+	var text []byte
+	switch i := n - lr.first; {
+	case i >= 0 && i < len(lr.lines):
+		text = lr.lines[i]
+	case i == len(lr.lines) && len(lr.partial) > 0:
+		text = lr.partial
+	default:
+		return "", false
+	}
+	text = bytes.TrimSuffix(text, []byte{'\r'})
+	if len(text) > previewLength {
+		return string(text[:previewLength]) + "...", true
+	}
+	return string(text), true
+}
+
+// previewError adds the text of the input line on which a parse error
+// occurred to its message.
+type previewError struct {
+	err  error
+	line int
+	text string
+}
+
+func (e *previewError) Error() string {
+	return fmt.Sprintf("%v\n  line %d: %s", e.err, e.line, e.text)
+}
+
+func (e *previewError) Unwrap() error {
+	return e.err
+}
@@ -2,16 +2,22 @@ package common
 
 import (
 	"bufio"
+	"bytes"
 	"encoding/csv"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"os"
+	"regexp"
 	"sort"
-	"strconv"
+	"strings"
+	"text/template"
+	"time"
+	"unicode/utf8"
 )
 
-type RecordFunc func(record []string, buffer []string, isHeader bool, lineNo int) ([]string, error)
+type RecordFunc func(record []string, buffer []string, isHeader bool, lineNo int) ([][]string, error)
 
 type CSVProcessor struct {
 	InputSeparator        string
@@ -20,42 +26,280 @@ type CSVProcessor struct {
 	InputFieldsPerLine    int
 	InputLazyQuotes       bool
 	InputTrimLeadingSpace bool
+	InputTrailingComma    bool
+	InputURL              string
+	InputURLHeaders       []string
+	InputURLTimeout       time.Duration
+	InputURLRetries       int
+	// InputMultiline, if set, joins each line whose quotes are unbalanced to
+	// the next line with this string in place of the line ending; see
+	// multilineReader.
+	InputMultiline string
+	// InputJSONPath, if set, makes the input a JSON document rather than CSV.
+	// The path selects the objects that are the rows; see EvalJSONPath and
+	// JSONRecords.
+	InputJSONPath string
+	// InputInferSeparator makes OpenIO choose InputSeparator with
+	// InferDelimiter, from the lines at the start of the input after those
+	// ignored, and OutputSeparator too if it is empty.
+	InputInferSeparator bool
 
 	OutputFile      string
+	OutputURL       string
+	OutputURLMethod string
+	OutputURLHeader []string
 	OutputSeparator string
 	OutputCRLF      bool
+	OutputNewline   string
+	OutputWidth     int
+	OutputPadChar   string
+	OutputBOM       bool
+	RejectFile      string
+
+	// AppendOutput makes OpenIO append to OutputFile rather than replace it.
+	// If the file already has content, the header row is not written again.
+	AppendOutput bool
+
+	// AtomicOutput makes OpenIO write OutputFile under a temporary name,
+	// which Close renames over OutputFile once the output is complete and
+	// synced to disk.  Abort removes it instead, leaving OutputFile as it
+	// was.
+	AtomicOutput bool
+
+	// OutputJSONLines writes each record as a JSON object on its own line,
+	// keyed by the header, instead of as CSV.  OutputJSONArray writes the
+	// objects instead as a single JSON array, indented for reading, once all
+	// of them have been written.  With OutputJSONTypes, values that are
+	// numbers or booleans are written unquoted.
+	OutputJSONLines bool
+	OutputJSONArray bool
+	OutputJSONTypes bool
+
+	// OutputTemplate, if set, formats each record after the header instead
+	// of writing it as CSV; see TemplateWriter.
+	OutputTemplate *template.Template
+
+	// OutputFormulaEscape, if set, is written before every field that begins
+	// with "=", "+", "-" or "@", so that spreadsheets do not run it as a
+	// formula.
+	OutputFormulaEscape string
+
+	ImplodeColumn    int
+	ImplodeSeparator string
+
+	// HeaderFunc, if set, is called by Sort with the header row before any
+	// records are compared.
+	HeaderFunc func(header []string) error
+	// EndFunc, if set, is called by Process after the last record has been
+	// processed.  The records it returns are written to the output.
+	EndFunc func() ([][]string, error)
 
 	IgnoreBeginning int
 	IgnoreEnd       int
 	NoHeader        bool
+	NormalizeHeader bool
 	LineNumbers     bool
 	ZeroBased       bool
 
-	input  io.Reader
-	output io.Writer
+	// LineNumberStart, if not nil, is the number given to the first data
+	// row, which is otherwise 1, or 0 if ZeroBased is set.  Each following
+	// row is numbered LineNumberStep higher, 1 if unset, and numbers are
+	// formatted with LineNumberFormat, "%d" if unset.
+	LineNumberStart  *int
+	LineNumberStep   int
+	LineNumberFormat string
+	RelaxedMode      bool
+
+	// ValidUTF8 makes Process, Sort and ReadAll fail at the first field that
+	// is not valid UTF-8, giving its line and column in the input.
+	ValidUTF8 bool
+
+	// HeadSeparator, if set, is the separator of the header row, for input
+	// whose data rows use InputSeparator but whose header uses another.  It
+	// is ignored if NoHeader is set.
+	HeadSeparator string
+
+	// InputQuote and OutputQuote, if set, are the characters quoting fields
+	// of the input and output instead of the double quote.  Within a quoted
+	// field, the quote character is escaped by doubling it.
+	InputQuote  string
+	OutputQuote string
+
+	// InputTrimBOM drops a UTF-8 byte order mark from the start of the input
+	// and of every line, as in files concatenated together; see
+	// bomStripReader.
+	InputTrimBOM bool
+
+	// DetectHeader makes Process and Sort decide for themselves whether the input has a
+	// header, overriding NoHeader, from its first two rows; see
+	// LooksLikeHeader.
+	DetectHeader bool
+
+	// MaxRows, if positive, is the number of data rows after which Process
+	// stops writing output and reading input.
+	MaxRows int
+
+	// Every, if positive, samples the input: Process and ProcessRaw pass
+	// to their functions only the data records whose line number modulo
+	// Every is EveryPhase.  The others are skipped, and not written to the
+	// reject file, though they still count towards IgnoreEnd.
+	Every      int
+	EveryPhase int
+
+	// IgnoreEndPattern, if set, ends the input at the first record after the
+	// header which matches it, dropping that record and everything after
+	// it.  The record is matched as its fields joined by the input
+	// separator.  IgnoreEnd then applies to the records before it.
+	IgnoreEndPattern *regexp.Regexp
+
+	// OriginalOrderTies makes Sort order records that compare equal by
+	// their position in the input.  Stable has the same effect, by sorting
+	// with a stable sort instead.
+	OriginalOrderTies bool
+	Stable            bool
+
+	// MaxMemory, if positive, is about the most memory in bytes that Sort
+	// may use to hold records.  Input that needs more is sorted on disk
+	// instead, in runs that fit, which are then merged.  Verbose makes Sort
+	// report on standard error which it did.
+	MaxMemory int64
+	Verbose   bool
+
+	// PadToFields, if positive, makes Process pad every record, including
+	// the header, that has fewer fields than this with empty fields, before
+	// Trims and the RecordFunc see it.  With InputFieldsPerLine set to -1,
+	// records of any length can then be indexed up to this many fields.
+	// TruncateToFields, if positive, likewise drops the fields of every
+	// record beyond this many.  Set both to the same number to give every
+	// record exactly that many fields.
+	PadToFields      int
+	TruncateToFields int
+
+	// Trims are applied by Process to every record, including the header,
+	// before it is passed to the RecordFunc.
+	Trims []*FieldTrim
+	// Fills are applied by Process to every data record, after Trims and
+	// before it is passed to the RecordFunc.
+	Fills []*FieldFill
+	// HeaderRenames are applied by Process to the header, in turn, after
+	// Trims and before it is passed to the RecordFunc.  A header created
+	// because of NoHeader is renamed too.
+	HeaderRenames []*HeaderRename
+
+	// ByteOffsets makes Process keep the byte offsets in the input of each
+	// record, which RecordOffsets gives while it is being processed.
+	ByteOffsets bool
+
+	// RecordLines makes Process keep the line of the input on which each
+	// record starts, which RecordLine gives while it is being processed.
+	RecordLines bool
+
+	// SortRanges, if set, makes Sort compare records by the fields of
+	// SortRanges, as FieldsCompareFunc does, in place of the CSVCompareFunc
+	// it is given, which must order records the same way.  Each field is
+	// parsed once for each record, rather than on each comparison.  The
+	// CSVCompareFunc is still used to merge runs sorted on disk.
+	SortRanges []*FieldRange
+	// NumberFormat is the format in which SortRanges parses numbers.
+	NumberFormat NumberFormat
+	// EmptyLast, if set, makes Sort put records with an empty field among
+	// the fields of EmptyLast after all others, even when it is reversed.
+	EmptyLast []*FieldRange
+
+	// DuplicateFunc, if set, makes Sort drop every record which it reports
+	// to be a duplicate of the record before it in sorted order, so that
+	// only the first of each run of duplicates is written.
+	DuplicateFunc func(prev, record []string) bool
+
+	input     io.Reader
+	output    io.Writer
+	reject    io.Writer
+	appending bool
+	recorder  *lineRecorder
+
+	inputBase      int64
+	offsets        *lineOffsets
+	pendingOffsets [][2]int64
+	recordOffsets  [2]int64
+	pendingLines   []int
+	recordLine     int
 }
 
-func (proc *CSVProcessor) OpenIO(args []string) error {
-	var err error
+func (proc *CSVProcessor) OpenIO(args []string) (err error) {
+	defer func() {
+		if err != nil {
+			proc.abortOutput()
+		}
+	}()
 	proc.input = os.Stdin
 	proc.output = os.Stdout
 	switch len(args) {
 	case 0:
 	case 1:
-		proc.input, err = os.Open(args[0])
+		if isURL(args[0]) {
+			proc.input, err = proc.openURL(args[0])
+		} else {
+			proc.input, err = os.Open(args[0])
+		}
 	default:
 		return errors.New("too many arguments")
 	}
+	if err == nil && proc.InputURL != "" {
+		if len(args) > 0 {
+			return errors.New("an input file and an input URL cannot both be given")
+		}
+		proc.input, err = proc.openURL(proc.InputURL)
+	}
+	if err == nil && proc.InputJSONPath != "" {
+		proc.input, err = proc.jsonInput(proc.input)
+	}
 	if err != nil {
 		return err
 	}
+	switch proc.OutputNewline {
+	case "", "lf", "crlf", "cr":
+	default:
+		return fmt.Errorf("%s: invalid newline, must be one of lf, crlf or cr", proc.OutputNewline)
+	}
+	if proc.OutputFile != "" && proc.OutputURL != "" {
+		return errors.New("an output file and an output URL cannot both be given")
+	}
+	if proc.AppendOutput && proc.OutputFile == "" {
+		return errors.New("appending requires an output file")
+	}
+	if proc.AtomicOutput && (proc.OutputFile == "" || proc.AppendOutput) {
+		return errors.New("atomic output requires an output file, which is replaced rather than appended to")
+	}
 	if proc.OutputFile != "" {
-		proc.output, err = os.Open(proc.OutputFile)
+		if proc.AtomicOutput {
+			var af *atomicFile
+			if af, err = createAtomic(proc.OutputFile); err == nil {
+				proc.output = af
+			}
+		} else if proc.AppendOutput {
+			if info, serr := os.Stat(proc.OutputFile); serr == nil && info.Size() > 0 {
+				proc.appending = true
+			}
+			proc.output, err = os.OpenFile(proc.OutputFile, os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0666)
+		} else {
+			proc.output, err = os.Create(proc.OutputFile)
+		}
+	}
+	if proc.OutputURL != "" {
+		method := proc.OutputURLMethod
+		if method == "" {
+			method = "POST"
+		}
+		proc.output, err = createURL(proc.OutputURL, method, proc.OutputURLHeader)
+	}
+	if err == nil && proc.RejectFile != "" {
+		proc.reject, err = os.Create(proc.RejectFile)
 	}
 
 	ignore := proc.IgnoreBeginning
 	if ignore > 0 {
-		buffered := bufio.NewReader(proc.input)
+		counter := &byteCounter{r: proc.input}
+		buffered := bufio.NewReader(counter)
 		for ignore > 0 {
 			_, isPrefix, err := buffered.ReadLine()
 			if err != nil {
@@ -67,12 +311,133 @@ func (proc *CSVProcessor) OpenIO(args []string) error {
 			}
 			ignore--
 		}
+		proc.inputBase = counter.n - int64(buffered.Buffered())
 		proc.input = buffered
 	}
+	if proc.InputInferSeparator {
+		if err := proc.inferSeparator(); err != nil {
+			return err
+		}
+	}
+	if proc.InputMultiline != "" {
+		proc.input = newMultilineReader(proc.input, proc.InputMultiline)
+	}
+
+	return err
+}
+
+// inferSeparator sets InputSeparator, and OutputSeparator if it is empty, to
+// the separator InferDelimiter chooses from the start of the input.
+func (proc *CSVProcessor) inferSeparator() error {
+	br := bufio.NewReaderSize(proc.input, 64*1024)
+	sample, err := br.Peek(64 * 1024)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return err
+	}
+	proc.input = br
+	sep, _, err := InferDelimiter(bytes.NewReader(sample), nil, 0)
+	if err != nil {
+		return err
+	}
+	proc.InputSeparator = string(sep)
+	if proc.OutputSeparator == "" {
+		proc.OutputSeparator = proc.InputSeparator
+	}
+	return nil
+}
+
+// jsonInput reads a JSON document from input and returns the rows selected
+// by InputJSONPath as CSV, using the input separator.
+func (proc *CSVProcessor) jsonInput(input io.Reader) (io.Reader, error) {
+	data, err := io.ReadAll(input)
+	if c, ok := input.(io.Closer); ok && input != os.Stdin {
+		c.Close()
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !json.Valid(data) {
+		return nil, errors.New("input is not valid JSON")
+	}
+	values, err := EvalJSONPath(data, proc.InputJSONPath)
+	if err != nil {
+		return nil, err
+	}
+	records, err := JSONRecords(values)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	csvw := csv.NewWriter(&buf)
+	if len(proc.InputSeparator) > 0 {
+		csvw.Comma = rune((proc.InputSeparator)[0])
+	}
+	if err := csvw.WriteAll(records); err != nil {
+		return nil, err
+	}
+	return &buf, nil
+}
 
+// Close closes the input and outputs opened by OpenIO.  When writing to a URL,
+// it waits for the request to complete and reports whether it succeeded.
+func (proc *CSVProcessor) Close() error {
+	var err error
+	if c, ok := proc.input.(io.Closer); ok && proc.input != os.Stdin {
+		c.Close()
+	}
+	for _, w := range []io.Writer{proc.output, proc.reject} {
+		var cerr error
+		if af, ok := w.(*atomicFile); ok {
+			cerr = af.commit()
+		} else if c, ok := w.(io.Closer); ok && w != os.Stdout {
+			cerr = c.Close()
+		}
+		if err == nil {
+			err = cerr
+		}
+	}
 	return err
 }
 
+// Abort closes the input and outputs opened by OpenIO after processing has
+// failed.  With AtomicOutput, the partial output is removed, so that
+// OutputFile is left as it was; otherwise Abort is the same as Close.
+func (proc *CSVProcessor) Abort() error {
+	proc.abortOutput()
+	return proc.Close()
+}
+
+// abortOutput removes the output if it is written atomically.
+func (proc *CSVProcessor) abortOutput() {
+	if af, ok := proc.output.(*atomicFile); ok {
+		af.abort()
+		proc.output = os.Stdout
+	}
+}
+
+// isTrailer reports whether record matches IgnoreEndPattern, and so begins
+// the trailer at the end of the input.  The header is never the trailer.
+func (proc *CSVProcessor) isTrailer(record []string, isHeader bool) bool {
+	if proc.IgnoreEndPattern == nil || isHeader {
+		return false
+	}
+	sep := proc.InputSeparator
+	if sep == "" {
+		sep = ","
+	}
+	return proc.IgnoreEndPattern.MatchString(strings.Join(record, sep))
+}
+
+// cutTrailer returns the records before the first that begins the trailer.
+func (proc *CSVProcessor) cutTrailer(c [][]string) [][]string {
+	for i, record := range c {
+		if proc.isTrailer(record, i == 0 && !proc.NoHeader) {
+			return c[:i]
+		}
+	}
+	return c
+}
+
 type CSVCompareFunc func(r1 []string, r2 []string) bool
 
 type sortableCSV struct {
@@ -92,29 +457,89 @@ func (scsv *sortableCSV) Swap(i, j int) {
 	scsv.values[i], scsv.values[j] = scsv.values[j], scsv.values[i]
 }
 
+// indexedCSV decorates each record with its original position, which is
+// used to order records that compare equal.  The positions are compared in
+// ascending order even when the sort is reversed.
+type indexedCSV struct {
+	sortableCSV
+	index    []int
+	reversed bool
+}
+
+func (icsv *indexedCSV) Less(i, j int) bool {
+	if icsv.sortableCSV.Less(i, j) {
+		return true
+	}
+	if icsv.sortableCSV.Less(j, i) {
+		return false
+	}
+	return (icsv.index[i] < icsv.index[j]) != icsv.reversed
+}
+
+func (icsv *indexedCSV) Swap(i, j int) {
+	icsv.sortableCSV.Swap(i, j)
+	icsv.index[i], icsv.index[j] = icsv.index[j], icsv.index[i]
+}
+
 func (proc *CSVProcessor) Sort(f CSVCompareFunc, reverse bool) error {
+	if proc.EmptyLast != nil {
+		fields, _ := sortFields(proc.EmptyLast)
+		f = ChainCompareFuncs(emptyLastFunc(fields, reverse), f)
+	}
 	reader := proc.getReader()
 	writer := proc.getWriter()
 
-	c, err := reader.ReadAll()
+	c, more, err := proc.readSortRecords(reader)
 	if err != nil {
 		return err
 	}
+	if more {
+		return proc.externalSort(reader, writer, c, f, reverse)
+	}
+	if proc.Verbose {
+		fmt.Fprintf(os.Stderr, "sorted in memory\n")
+	}
+	c = proc.cutTrailer(c)
 	if proc.IgnoreEnd > 0 {
 		if len(c) < proc.IgnoreEnd {
 			return errors.New("entire file was ignored because of value of 'ignore end'")
 		}
 		c = c[:len(c)-proc.IgnoreEnd]
 	}
+	if proc.DetectHeader && len(c) > 0 {
+		var second []string
+		if len(c) > 1 {
+			second = c[1]
+		}
+		proc.NoHeader = !LooksLikeHeader(c[0], second)
+	}
+	if proc.HeaderFunc != nil && len(c) > 0 {
+		header := c[0]
+		if proc.NoHeader {
+			header = createHeaderRecord(len(c[0]))
+		}
+		err = proc.HeaderFunc(header)
+		if err != nil {
+			return err
+		}
+	}
 	sortRef := c
 	if !proc.NoHeader {
 		sortRef = sortRef[1:]
 	}
-	var sortInterface sort.Interface = &sortableCSV{f, sortRef}
-	if reverse {
-		sortInterface = sort.Reverse(sortInterface)
+	var index []int
+	if proc.OriginalOrderTies {
+		index = make([]int, len(sortRef))
+		for i := range index {
+			index[i] = i
+		}
+	}
+	proc.sortRecords(sortRef, index, f, reverse)
+	if proc.DuplicateFunc != nil {
+		n := len(sortRef)
+		sortRef = removeDuplicates(sortRef, proc.DuplicateFunc)
+		c = c[:len(c)-n+len(sortRef)]
 	}
-	sort.Sort(sortInterface)
 	if proc.NoHeader && len(c) > 0 {
 		header := make([]string, 0, len(c[0])+1)
 		if proc.LineNumbers {
@@ -127,60 +552,222 @@ func (proc *CSVProcessor) Sort(f CSVCompareFunc, reverse bool) error {
 		}
 	}
 	if proc.LineNumbers {
-		offset := 1
-		if proc.ZeroBased {
-			offset = 0
+		if !proc.NoHeader && len(c) > 0 {
+			err = writer.Write(append([]string{"N"}, c[0]...))
+			if err != nil {
+				return err
+			}
 		}
-		for i, line := range c {
+		for i, line := range sortRef {
 			expanded := make([]string, 0, len(line)+1)
-			expanded = append(expanded, strconv.Itoa(i+offset))
+			expanded = append(expanded, proc.formatLineNumber(i))
 			expanded = append(expanded, line...)
 			err = writer.Write(expanded)
 			if err != nil {
 				return err
 			}
 		}
+		writer.Flush()
+		return writer.Error()
+	}
+	return writer.WriteAll(c)
+}
+
+// sortRecords sorts records by f, or by SortRanges if set, or in reverse.
+// If index is given, it holds the positions of the records in the input,
+// which order records that compare equal, and is sorted with them.
+// Otherwise such records keep their order if Stable is set.
+func (proc *CSVProcessor) sortRecords(records [][]string, index []int, f CSVCompareFunc, reverse bool) {
+	var sortInterface sort.Interface = &sortableCSV{f, records}
+	var keyed *keyedCSV
+	if proc.SortRanges != nil {
+		emptyFields, _ := sortFields(proc.EmptyLast)
+		keyed = newKeyedCSV(records, index, proc.SortRanges, emptyFields, proc.NumberFormat, reverse)
+		sortInterface = keyed
+	} else if index != nil {
+		sortInterface = &indexedCSV{sortableCSV{f, records}, index, reverse}
+	}
+	if reverse {
+		sortInterface = sort.Reverse(sortInterface)
+	}
+	if proc.Stable && index == nil {
+		sort.Stable(sortInterface)
 	} else {
-		return writer.WriteAll(c)
+		sort.Sort(sortInterface)
+	}
+	if keyed != nil {
+		keyed.store(records, index)
 	}
-	return nil
+}
+
+// removeDuplicates removes, in place, every record that isDup reports to be
+// a duplicate of the record before it.
+func removeDuplicates(records [][]string, isDup func(prev, record []string) bool) [][]string {
+	if len(records) == 0 {
+		return records
+	}
+	unique := records[:1]
+	for _, record := range records[1:] {
+		if !isDup(unique[len(unique)-1], record) {
+			unique = append(unique, record)
+		}
+	}
+	return unique
+}
+
+// SummaryFunc receives the header and all data records of the input, and
+// returns the records to be written to the output in their place.
+type SummaryFunc func(header []string, records [][]string) ([][]string, error)
+
+// Summarize reads the entire input, passes it to f and writes out the records
+// that f returns.  If NoHeader is set, a default header is created.
+func (proc *CSVProcessor) Summarize(f SummaryFunc) error {
+	header, records, err := proc.ReadAll()
+	if err != nil {
+		return err
+	}
+	output, err := f(header, records)
+	if err != nil {
+		return err
+	}
+	return proc.getWriter().WriteAll(output)
+}
+
+// ReadAll reads the entire input opened by OpenIO and returns its header and
+// data records separately.  Lines are ignored at the beginning and end of the
+// input as for Process.  If NoHeader is set, a default header is created.  The
+// header is nil if the input is empty.
+func (proc *CSVProcessor) ReadAll() (header []string, records [][]string, err error) {
+	c, err := proc.readRecords(proc.getReader())
+	if err != nil {
+		return nil, nil, err
+	}
+	c = proc.cutTrailer(c)
+	if proc.IgnoreEnd > 0 {
+		if len(c) < proc.IgnoreEnd {
+			return nil, nil, errors.New("entire file was ignored because of value of 'ignore end'")
+		}
+		c = c[:len(c)-proc.IgnoreEnd]
+	}
+	if len(c) > 0 {
+		if proc.NoHeader {
+			header = createHeaderRecord(len(c[0]))
+		} else {
+			header, c = c[0], c[1:]
+		}
+	}
+	return header, c, nil
 }
 
 func (proc *CSVProcessor) Process(processFunc RecordFunc, deleteEmpty bool) error {
 	var err error
 
 	reader := proc.getReader()
+	var peeked [][]string
+	var peekErr error
+	if proc.DetectHeader {
+		peeked, peekErr = proc.peekRecords(reader, 2)
+		var second []string
+		if len(peeked) > 1 {
+			second = peeked[1]
+		}
+		proc.NoHeader = len(peeked) > 0 && !LooksLikeHeader(peeked[0], second)
+	}
 	writer := proc.getWriter()
+	var rejectWriter RecordWriter
+	if proc.reject != nil {
+		rejectWriter = proc.newWriter(proc.reject)
+	}
 
-	footerBuffer := make([][]string, proc.IgnoreEnd)
+	footerBuffer := make([][][]string, proc.IgnoreEnd)
+	footerIsHeader := make([]bool, proc.IgnoreEnd)
 	footerBufferLocation := 0
+	written := 0
+	// writeData writes records, counting them as data rows unless isHeader
+	// is set, and drops any beyond MaxRows.
+	writeData := func(records [][]string, isHeader bool) error {
+		if isHeader {
+			return writeRecords(writer, records, deleteEmpty, proc.LineNumbers)
+		}
+		for _, record := range records {
+			if proc.MaxRows > 0 && written >= proc.MaxRows {
+				return nil
+			}
+			if record == nil || (deleteEmpty && isEmptyRecord(record, proc.LineNumbers)) {
+				continue
+			}
+			if err := writer.Write(record); err != nil {
+				return err
+			}
+			written++
+		}
+		return nil
+	}
 	line := 1
 	if proc.ZeroBased {
 		line = 0
 	}
+	firstLine := line
 	if !proc.NoHeader {
 		line -= 1
 	}
 	isFirst := true
+	skipped := 0
 	for err == nil {
 		var record []string
-		var outputRecord []string
-		record, err = reader.Read()
+		var outputRecords [][]string
+		if len(peeked) > 0 {
+			record, peeked = peeked[0], peeked[1:]
+		} else if peekErr != nil {
+			err, peekErr = peekErr, nil
+		} else {
+			record, err = proc.read(reader)
+		}
 		if err != nil {
+			var parseErr *csv.ParseError
+			if proc.RelaxedMode && errors.As(err, &parseErr) {
+				fmt.Fprintf(os.Stderr, "warning: skipping record: %v\n", err)
+				skipped++
+				err = nil
+				continue
+			}
 			break
 		}
+		if proc.offsets != nil {
+			proc.recordOffsets, proc.pendingOffsets = proc.pendingOffsets[0], proc.pendingOffsets[1:]
+		}
+		if proc.RecordLines {
+			proc.recordLine, proc.pendingLines = proc.pendingLines[0], proc.pendingLines[1:]
+		}
+		if proc.isTrailer(record, isFirst && !proc.NoHeader) {
+			err = io.EOF
+			break
+		}
+		record = PadFields(record, proc.PadToFields)
+		if proc.TruncateToFields > 0 && len(record) > proc.TruncateToFields {
+			record = record[:proc.TruncateToFields]
+		}
+		for _, t := range proc.Trims {
+			t.Apply(record)
+		}
 		first := "N"
 		if isFirst && proc.NoHeader {
 			buffer := make([]string, 0, len(record)+1)
 			if proc.LineNumbers {
 				buffer = append(buffer, first)
 			}
-			outputRecord, err = processFunc(createHeaderRecord(len(record)), buffer, true, line)
+			header := createHeaderRecord(len(record))
+			for _, r := range proc.HeaderRenames {
+				r.Apply(header)
+			}
+			outputRecords, err = processFunc(header, buffer, true, line)
 			if err != nil {
 				break
 			}
-			if outputRecord != nil {
-				err = writer.Write(outputRecord)
+			proc.normalizeHeaders(outputRecords)
+			err = writeRecords(writer, outputRecords, false, proc.LineNumbers)
+			if err == nil && rejectWriter != nil {
+				err = rejectWriter.Write(header)
 			}
 			if err != nil {
 				break
@@ -191,49 +778,190 @@ func (proc *CSVProcessor) Process(processFunc RecordFunc, deleteEmpty bool) erro
 		buffer := make([]string, 0, len(record)+1)
 		if proc.LineNumbers {
 			if !isFirst {
-				first = strconv.Itoa(line)
+				first = proc.formatLineNumber(line - firstLine)
 			}
 			buffer = append(buffer, first)
 		}
-		outputRecord, err = processFunc(record, buffer, (!proc.NoHeader) && isFirst, line)
-		if err != nil {
-			break
-		}
-
-		if proc.IgnoreEnd > 0 {
-			if footerBuffer[footerBufferLocation] != nil {
-				record := footerBuffer[footerBufferLocation]
-				if record != nil {
-					err = writer.Write(record)
-				}
+		isHeader := (!proc.NoHeader) && isFirst
+		if isHeader {
+			for _, r := range proc.HeaderRenames {
+				r.Apply(record)
 			}
-			if !deleteEmpty || !isEmptyRecord(outputRecord, proc.LineNumbers) {
-				footerBuffer[footerBufferLocation] = outputRecord
-				footerBufferLocation++
-				footerBufferLocation = footerBufferLocation % (proc.IgnoreEnd)
+		} else {
+			for _, f := range proc.Fills {
+				f.Apply(record)
 			}
+		}
+		if !isHeader && proc.Every > 0 && line%proc.Every != proc.EveryPhase {
+			outputRecords = nil
 		} else {
-			if !deleteEmpty || !isEmptyRecord(outputRecord, proc.LineNumbers) {
-				if outputRecord != nil {
-					err = writer.Write(outputRecord)
+			outputRecords, err = processFunc(record, buffer, isHeader, line)
+			if err != nil {
+				break
+			}
+			if isHeader {
+				proc.normalizeHeaders(outputRecords)
+			}
+			if rejectWriter != nil && (isHeader || len(outputRecords) == 0) {
+				err = rejectWriter.Write(record)
+				if err != nil {
+					break
 				}
 			}
 		}
+
+		if proc.IgnoreEnd > 0 {
+			err = writeData(footerBuffer[footerBufferLocation], footerIsHeader[footerBufferLocation])
+			footerBuffer[footerBufferLocation] = outputRecords
+			footerIsHeader[footerBufferLocation] = isHeader
+			footerBufferLocation++
+			footerBufferLocation = footerBufferLocation % (proc.IgnoreEnd)
+		} else {
+			err = writeData(outputRecords, isHeader)
+		}
 		if err != nil {
 			break
 		}
+		if proc.MaxRows > 0 && written >= proc.MaxRows {
+			err = io.EOF
+			break
+		}
 		isFirst = false
 		line++
 	}
+	if err == io.EOF && proc.EndFunc != nil {
+		var outputRecords [][]string
+		outputRecords, err = proc.EndFunc()
+		if err == nil {
+			err = writeData(outputRecords, false)
+		}
+		if err == nil {
+			err = io.EOF
+		}
+	}
 	writer.Flush()
+	if rejectWriter != nil {
+		rejectWriter.Flush()
+	}
+	if skipped > 0 {
+		fmt.Fprintf(os.Stderr, "%d records skipped because of parse errors\n", skipped)
+	}
 	if err == io.EOF {
 		return nil
 	}
 	return err
 }
 
+// RawRecordFunc is called by ProcessRaw with the fields of each record, which
+// it may change in place, and its line number as for Process.  It returns
+// false to remove a data record.
+type RawRecordFunc func(record []string, isHeader bool, lineNo int) (bool, error)
+
+// ProcessRaw is like Process, but copies the input text of every record and
+// field that f leaves unchanged to the output as it is, quotes and all.  Only
+// the fields that f changes are written anew.  Options that change the output
+// format, such as OutputSeparator, have no effect, and no header is created if
+// NoHeader is set.
+func (proc *CSVProcessor) ProcessRaw(f RawRecordFunc) error {
+	input := proc.input
+	if proc.InputTrimBOM {
+		input = newBOMStripReader(input)
+	}
+	reader := NewRawReader(input)
+	comma := ','
+	if len(proc.InputSeparator) > 0 {
+		comma, _ = utf8.DecodeRuneInString(proc.InputSeparator)
+	}
+	reader.Comma = comma
+	if len(proc.InputComment) > 0 {
+		reader.Comment, _ = utf8.DecodeRuneInString(proc.InputComment)
+	}
+	writer := bufio.NewWriter(proc.output)
+	defer writer.Flush()
+	var rejectWriter *bufio.Writer
+	if proc.reject != nil {
+		rejectWriter = bufio.NewWriter(proc.reject)
+		defer rejectWriter.Flush()
+	}
+
+	pending := make([]*RawRecord, 0, proc.IgnoreEnd+1)
+	isHeader := !proc.NoHeader
+	line := 1
+	if proc.ZeroBased {
+		line = 0
+	}
+	if isHeader {
+		line--
+	}
+	for {
+		record, err := reader.Read()
+		if err == nil && proc.isTrailer(record.Fields, isHeader && len(pending) == 0) {
+			err = io.EOF
+		}
+		if err == io.EOF {
+			if rejectWriter != nil {
+				if err := rejectWriter.Flush(); err != nil {
+					return err
+				}
+			}
+			return writer.Flush()
+		}
+		if err != nil {
+			return err
+		}
+		pending = append(pending, record)
+		if len(pending) <= proc.IgnoreEnd {
+			continue
+		}
+		record = pending[0]
+		pending = pending[1:]
+		if !isHeader && proc.Every > 0 && line%proc.Every != proc.EveryPhase {
+			line++
+			continue
+		}
+
+		keep, err := f(record.Fields, isHeader, line)
+		if err != nil {
+			return err
+		}
+		if keep || (isHeader && !proc.appending) {
+			err = record.Write(writer, comma)
+		}
+		if err == nil && rejectWriter != nil && (!keep || isHeader) {
+			err = record.WriteOriginal(rejectWriter)
+		}
+		if err != nil {
+			return err
+		}
+		isHeader = false
+		line++
+	}
+}
+
+// getReader returns a csv.Reader for the input.  Input with bare carriage
+// returns as line endings, as written with an OutputNewline of "cr", is read
+// as if they were line feeds.
 func (proc *CSVProcessor) getReader() *csv.Reader {
-	csvr := csv.NewReader(proc.input)
+	buffered := bufio.NewReaderSize(proc.input, crPeekSize)
+	var input io.Reader = buffered
+	if hasCRLineEndings(buffered, proc.InputQuote) {
+		input = &crReader{r: buffered, quote: newQuoteTracker(proc.InputQuote)}
+	}
+	if proc.InputTrimBOM {
+		input = newBOMStripReader(input)
+	}
+	if proc.InputQuote != "" && proc.InputQuote != `"` {
+		input = proc.newQuoteReader(input)
+	}
+	if proc.HeadSeparator != "" && !proc.NoHeader {
+		input = proc.convertHead(input)
+	}
+	if proc.ByteOffsets {
+		proc.offsets = newLineOffsets(input, proc.inputBase)
+		input = proc.offsets
+	}
+	proc.recorder = newLineRecorder(input)
+	csvr := csv.NewReader(proc.recorder)
 	if len(proc.InputSeparator) > 0 {
 		csvr.Comma = rune((proc.InputSeparator)[0])
 	}
@@ -243,18 +971,320 @@ func (proc *CSVProcessor) getReader() *csv.Reader {
 	csvr.FieldsPerRecord = proc.InputFieldsPerLine
 	csvr.LazyQuotes = proc.InputLazyQuotes
 	csvr.TrimLeadingSpace = proc.InputTrimLeadingSpace
+	// The csv package now always allows a trailing comma, but the option is
+	// still passed on for compatibility.
+	csvr.TrailingComma = proc.InputTrailingComma
 	return csvr
 }
 
-func (proc *CSVProcessor) getWriter() *csv.Writer {
-	csvw := csv.NewWriter(proc.output)
-	if len(proc.OutputSeparator) > 0 {
-		csvw.Comma = rune((proc.OutputSeparator)[0])
+// newQuoteReader returns input converted from fields quoted with InputQuote
+// to standard CSV, with the same separator and comment character.
+func (proc *CSVProcessor) newQuoteReader(input io.Reader) io.Reader {
+	quote, _ := utf8.DecodeRuneInString(proc.InputQuote)
+	comma, comment := ',', rune(0)
+	if len(proc.InputSeparator) > 0 {
+		comma = rune(proc.InputSeparator[0])
+	}
+	if len(proc.InputComment) > 0 {
+		comment = rune(proc.InputComment[0])
+	}
+	return newQuoteReader(input, quote, comma, comment, proc.InputTrimLeadingSpace)
+}
+
+// convertHead returns input with its first row, which is separated by
+// HeadSeparator, rewritten to be separated by InputSeparator like the rest,
+// so that a single csv.Reader can read it all.  The row is read with a
+// csv.Reader of its own, and keeps its number of lines.  If it cannot be
+// read, it is left as it is, for the main reader to report.
+func (proc *CSVProcessor) convertHead(input io.Reader) io.Reader {
+	br := bufio.NewReader(input)
+	line, err := readLogicalLine(br)
+	if err != nil && err != io.EOF {
+		return io.MultiReader(bytes.NewReader(line), br)
+	}
+	headr := csv.NewReader(bytes.NewReader(line))
+	headr.Comma, _ = utf8.DecodeRuneInString(proc.HeadSeparator)
+	headr.FieldsPerRecord = -1
+	headr.LazyQuotes = proc.InputLazyQuotes
+	headr.TrimLeadingSpace = proc.InputTrimLeadingSpace
+	header, err := headr.Read()
+	if err != nil {
+		return io.MultiReader(bytes.NewReader(line), br)
+	}
+	var converted bytes.Buffer
+	w := csv.NewWriter(&converted)
+	if len(proc.InputSeparator) > 0 {
+		w.Comma, _ = utf8.DecodeRuneInString(proc.InputSeparator)
+	}
+	w.Write(header)
+	w.Flush()
+	return io.MultiReader(&converted, br)
+}
+
+// readLogicalLine reads a line from br, together with the lines that follow
+// it while it has an odd number of quotes, so that a quoted field containing
+// line endings is read whole.
+func readLogicalLine(br *bufio.Reader) ([]byte, error) {
+	var line []byte
+	for {
+		more, err := br.ReadBytes('\n')
+		line = append(line, more...)
+		if err != nil || bytes.Count(line, []byte{'"'})%2 == 0 {
+			return line, err
+		}
 	}
-	if proc.OutputCRLF {
-		csvw.UseCRLF = proc.OutputCRLF
+}
+
+func (proc *CSVProcessor) getWriter() RecordWriter {
+	output := proc.output
+	if proc.OutputBOM && !proc.appending {
+		output = &bomWriter{w: output}
+	}
+	var w RecordWriter
+	if proc.OutputJSONLines || proc.OutputJSONArray || proc.OutputTemplate != nil {
+		if proc.OutputNewline == "cr" {
+			output = &crWriter{output}
+		}
+		useCRLF := proc.OutputCRLF || proc.OutputNewline == "crlf"
+		if proc.OutputTemplate != nil {
+			w = NewTemplateWriter(output, proc.OutputTemplate, useCRLF)
+		} else {
+			w = newJSONLinesWriter(output, useCRLF, proc.OutputJSONTypes, proc.OutputJSONArray)
+		}
+	} else {
+		w = proc.newWriter(output)
+		if proc.appending {
+			w = &skipFirstWriter{RecordWriter: w}
+		}
+	}
+	if proc.OutputFormulaEscape != "" {
+		w = &formulaGuardWriter{w, proc.OutputFormulaEscape}
+	}
+	if proc.ImplodeColumn > 0 {
+		column := proc.ImplodeColumn - 1
+		if proc.LineNumbers {
+			column++
+		}
+		w = &ImplodeProcessor{
+			ImplodeColumn:    column,
+			ImplodeSeparator: proc.ImplodeSeparator,
+			SkipFirst:        proc.LineNumbers,
+			Writer:           w,
+		}
+	}
+	return w
+}
+
+func (proc *CSVProcessor) newWriter(output io.Writer) RecordWriter {
+	if proc.OutputNewline == "cr" {
+		output = &crWriter{output}
+	}
+	useCRLF := proc.OutputCRLF || proc.OutputNewline == "crlf"
+	var w RecordWriter
+	customQuote := proc.OutputQuote != "" && proc.OutputQuote != `"`
+	// csv.Writer quotes fields with a leading space, which would make a
+	// field padded to OutputWidth wider than the rest.
+	if utf8.RuneCountInString(proc.OutputSeparator) > 1 || customQuote || proc.OutputWidth > 0 {
+		sep, quote := proc.OutputSeparator, `"`
+		if sep == "" {
+			sep = ","
+		}
+		if customQuote {
+			r, _ := utf8.DecodeRuneInString(proc.OutputQuote)
+			quote = string(r)
+		}
+		w = newSepWriter(output, sep, quote, useCRLF)
+	} else {
+		csvw := csv.NewWriter(output)
+		if len(proc.OutputSeparator) > 0 {
+			csvw.Comma, _ = utf8.DecodeRuneInString(proc.OutputSeparator)
+		}
+		csvw.UseCRLF = useCRLF
+		w = csvw
+	}
+	if proc.OutputWidth > 0 {
+		pad := ' '
+		if len(proc.OutputPadChar) > 0 {
+			pad, _ = utf8.DecodeRuneInString(proc.OutputPadChar)
+		}
+		w = &fieldWidthWriter{w, proc.OutputWidth, pad}
+	}
+	return w
+}
+
+// formatLineNumber returns the line number of the i'th data row, counting
+// from 0.
+func (proc *CSVProcessor) formatLineNumber(i int) string {
+	start := 1
+	if proc.LineNumberStart != nil {
+		start = *proc.LineNumberStart
+	} else if proc.ZeroBased {
+		start = 0
+	}
+	step := proc.LineNumberStep
+	if step == 0 {
+		step = 1
+	}
+	format := proc.LineNumberFormat
+	if format == "" {
+		format = "%d"
+	}
+	return fmt.Sprintf(format, start+i*step)
+}
+
+// normalizeHeaders normalizes header records in place if NormalizeHeader is
+// set.
+func (proc *CSVProcessor) normalizeHeaders(headers [][]string) {
+	if !proc.NormalizeHeader {
+		return
+	}
+	for i, header := range headers {
+		headers[i] = NormalizeHeader(header)
+	}
+}
+
+// writeRecords writes each non-nil record, skipping empty ones if deleteEmpty
+// is set.
+func writeRecords(writer RecordWriter, records [][]string, deleteEmpty, ignoreFirst bool) error {
+	for _, record := range records {
+		if record == nil || (deleteEmpty && isEmptyRecord(record, ignoreFirst)) {
+			continue
+		}
+		err := writer.Write(record)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RecordOffsets returns the byte offsets in the input of the start and end
+// of the record being processed by Process, if ByteOffsets is set.  The end
+// is just past its line ending, where the next line starts.
+func (proc *CSVProcessor) RecordOffsets() (start, end int64) {
+	return proc.recordOffsets[0], proc.recordOffsets[1]
+}
+
+// RecordLine returns the line of the input, counting from 1, on which the
+// record being processed by Process starts, if RecordLines is set.  Every
+// line is counted, including those skipped with IgnoreBeginning and those
+// inside quoted fields.
+func (proc *CSVProcessor) RecordLine() int {
+	return proc.recordLine
+}
+
+// readRecords reads all the records from reader, checking each as it is read
+// as read does.
+func (proc *CSVProcessor) readRecords(reader *csv.Reader) ([][]string, error) {
+	var records [][]string
+	for {
+		record, err := proc.read(reader)
+		if err == io.EOF {
+			return records, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+}
+
+// WrongColumnCountError is returned for a record with a different number of
+// fields than InputFieldsPerLine, or than the first record if it is 0.  It
+// wraps the *csv.ParseError reported by the csv package, so RelaxedMode skips
+// the record.
+type WrongColumnCountError struct {
+	Line     int
+	Got      int
+	Expected int
+	err      error
+}
+
+func (e *WrongColumnCountError) Error() string {
+	return fmt.Sprintf("line %d: wrong number of fields: got %d, expected %d", e.Line, e.Got, e.Expected)
+}
+
+func (e *WrongColumnCountError) Unwrap() error {
+	return e.err
+}
+
+// read reads the next record from reader.  A record with the wrong number of
+// fields is reported as a *WrongColumnCountError, and each record is checked
+// with checkUTF8.  The text of the line on which a parse error occurred is
+// added to the error, if it is still kept.
+func (proc *CSVProcessor) read(reader *csv.Reader) ([]string, error) {
+	record, err := reader.Read()
+	if err == nil && proc.offsets != nil {
+		line, _ := reader.FieldPos(0)
+		end := proc.offsets.base + reader.InputOffset()
+		proc.pendingOffsets = append(proc.pendingOffsets, [2]int64{proc.offsets.start(line), end})
+	}
+	if err == nil && proc.RecordLines {
+		line, _ := reader.FieldPos(0)
+		proc.pendingLines = append(proc.pendingLines, line+proc.IgnoreBeginning)
+	}
+	var parseErr *csv.ParseError
+	if !errors.As(err, &parseErr) {
+		if err == nil {
+			err = proc.checkUTF8(reader, record)
+		}
+		return record, err
+	}
+	// The line is numbered as in the message it follows.
+	line := parseErr.Line
+	if parseErr.Err == csv.ErrFieldCount {
+		line += proc.IgnoreBeginning
+		err = &WrongColumnCountError{
+			Line:     parseErr.StartLine + proc.IgnoreBeginning,
+			Got:      len(record),
+			Expected: reader.FieldsPerRecord,
+			err:      err,
+		}
+	}
+	if proc.recorder != nil {
+		if text, ok := proc.recorder.line(parseErr.Line); ok {
+			err = &previewError{err: err, line: line, text: text}
+		}
+	}
+	return record, err
+}
+
+// checkUTF8 returns an error giving the position of the first invalid UTF-8
+// sequence in record, the last record read from reader, if ValidUTF8 is set.
+func (proc *CSVProcessor) checkUTF8(reader *csv.Reader, record []string) error {
+	if !proc.ValidUTF8 {
+		return nil
+	}
+	for i, field := range record {
+		if utf8.ValidString(field) {
+			continue
+		}
+		offset := 0
+		for offset < len(field) {
+			r, size := utf8.DecodeRuneInString(field[offset:])
+			if r == utf8.RuneError && size <= 1 {
+				break
+			}
+			offset += size
+		}
+		line, column := reader.FieldPos(i)
+		return fmt.Errorf("line %d, column %d: invalid UTF-8 in field %d", line+proc.IgnoreBeginning, column+offset, i+1)
+	}
+	return nil
+}
+
+// peekRecords reads up to n records from reader, stopping at the first
+// error, which is returned with the records read before it.
+func (proc *CSVProcessor) peekRecords(reader *csv.Reader, n int) ([][]string, error) {
+	var records [][]string
+	for len(records) < n {
+		record, err := proc.read(reader)
+		if err != nil {
+			return records, err
+		}
+		records = append(records, record)
 	}
-	return csvw
+	return records, nil
 }
 
 func createHeaderRecord(sz int) (header []string) {
@@ -0,0 +1,136 @@
+package common
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// quoteReader converts input whose fields are quoted with a character other
+// than the double quote into standard CSV, which the csv package can read.
+// Each record is parsed and written again with csv.Writer, which keeps line
+// breaks within fields, and so keeps line numbers.  Within a quoted field,
+// the quote character is escaped by doubling it, and a double quote is an
+// ordinary character.  Parsing is lenient: a quote character within an
+// unquoted field, or text after the closing quote, is kept as it is.
+type quoteReader struct {
+	br      *bufio.Reader
+	quote   rune
+	comma   rune
+	comment rune
+	trim    bool
+	buf     bytes.Buffer
+	w       *csv.Writer
+	line    int
+	err     error
+}
+
+func newQuoteReader(r io.Reader, quote, comma, comment rune, trim bool) *quoteReader {
+	qr := &quoteReader{br: bufio.NewReader(r), quote: quote, comma: comma, comment: comment, trim: trim}
+	qr.w = csv.NewWriter(&qr.buf)
+	qr.w.Comma = comma
+	return qr
+}
+
+func (qr *quoteReader) Read(p []byte) (int, error) {
+	for qr.buf.Len() == 0 && qr.err == nil {
+		qr.err = qr.convertRecord()
+	}
+	if qr.buf.Len() > 0 {
+		return qr.buf.Read(p)
+	}
+	return 0, qr.err
+}
+
+// convertRecord reads a record and writes it to buf as standard CSV.  Empty
+// lines and comments are copied as they are, for the csv package to skip.
+func (qr *quoteReader) convertRecord() error {
+	qr.line++
+	start := qr.line
+	r, _, err := qr.br.ReadRune()
+	if err != nil {
+		return err
+	}
+	if r == '\n' || (qr.comment != 0 && r == qr.comment) {
+		qr.buf.WriteRune(r)
+		if r != '\n' {
+			line, err := qr.br.ReadString('\n')
+			qr.buf.WriteString(line)
+			if err != nil && err != io.EOF {
+				return err
+			}
+		}
+		return nil
+	}
+	qr.br.UnreadRune()
+
+	var record []string
+	var field strings.Builder
+	atStart, quoted := true, false
+	endField := func() {
+		record = append(record, field.String())
+		field.Reset()
+	}
+	for {
+		r, _, err := qr.br.ReadRune()
+		if err == io.EOF {
+			if quoted {
+				return fmt.Errorf("line %d: missing closing %c quote", start, qr.quote)
+			}
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if quoted {
+			if r != qr.quote {
+				if r == '\n' {
+					qr.line++
+				}
+				field.WriteRune(r)
+				continue
+			}
+			next, _, err := qr.br.ReadRune()
+			if err == nil && next == qr.quote {
+				field.WriteRune(r)
+				continue
+			}
+			if err == nil {
+				qr.br.UnreadRune()
+			}
+			quoted = false
+			continue
+		}
+		if r == '\n' {
+			break
+		}
+		if r == '\r' {
+			if next, err := qr.br.Peek(1); err == nil && next[0] == '\n' {
+				continue
+			}
+		}
+		if r == qr.comma {
+			endField()
+			atStart = true
+			continue
+		}
+		if atStart {
+			if qr.trim && (r == ' ' || r == '\t') {
+				continue
+			}
+			atStart = false
+			if r == qr.quote {
+				quoted = true
+				continue
+			}
+		}
+		field.WriteRune(r)
+	}
+	endField()
+	qr.w.Write(record)
+	qr.w.Flush()
+	return qr.w.Error()
+}
@@ -0,0 +1,23 @@
+package common
+
+import (
+	"math/rand/v2"
+	"strconv"
+)
+
+// NewRand returns a random source seeded with seed, a decimal number, so that
+// a run can be repeated by giving the same seed.  If seed is empty, one is
+// chosen at random.  The seed used is returned so that it can be reported.
+func NewRand(seed string) (*rand.Rand, uint64, error) {
+	var n uint64
+	if seed == "" {
+		n = rand.Uint64()
+	} else {
+		var err error
+		n, err = strconv.ParseUint(seed, 10, 64)
+		if err != nil {
+			return nil, 0, err
+		}
+	}
+	return rand.New(rand.NewPCG(n, n)), n, nil
+}
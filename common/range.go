@@ -1,7 +1,10 @@
 package common
 
 import (
+	"bufio"
 	"fmt"
+	"os"
+	"regexp"
 	"strconv"
 	"strings"
 )
@@ -28,6 +31,37 @@ func ParseFieldRanges(ranges string) ([]*FieldRange, error) {
 	return frs, nil
 }
 
+// ReadFieldRangesFile reads field ranges from the named file.  Ranges are
+// given one per line, or as comma-separated lists; blank lines and lines
+// beginning with '#' are ignored.
+func ReadFieldRangesFile(name string) ([]*FieldRange, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var frs []*FieldRange
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		for _, r := range strings.Split(line, ",") {
+			r = strings.TrimSpace(r)
+			if r == "" {
+				continue
+			}
+			fr, err := parseFieldRange(r)
+			if err != nil {
+				return nil, err
+			}
+			frs = append(frs, fr)
+		}
+	}
+	return frs, scanner.Err()
+}
+
 func parseFieldRange(str string) (*FieldRange, error) {
 	flag := byte(0)
 	if len(str) > 0 {
@@ -54,3 +88,15 @@ func parseFieldRange(str string) (*FieldRange, error) {
 	}
 	return &FieldRange{Start: int(i) - 1, End: int(i2) - 1}, nil
 }
+
+// MatchFieldRanges returns a single field range for each name in header that
+// matches re, in header order.
+func MatchFieldRanges(header []string, re *regexp.Regexp) []*FieldRange {
+	var frs []*FieldRange
+	for i, name := range header {
+		if re.MatchString(name) {
+			frs = append(frs, &FieldRange{Start: i, End: -1})
+		}
+	}
+	return frs
+}
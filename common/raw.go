@@ -0,0 +1,182 @@
+package common
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// RawReader reads CSV records like csv.Reader, but keeps the original text of
+// every field so that records can be written back exactly as they were read.
+// Quotes are parsed leniently: a quote inside an unquoted field is taken
+// literally.
+type RawReader struct {
+	Comma   rune
+	Comment rune
+
+	r    *bufio.Reader
+	line int
+}
+
+// RawRecord is a record read by a RawReader.  Fields holds the values of its
+// fields, which may be changed before the record is written with Write.
+type RawRecord struct {
+	Fields []string
+
+	values []string
+	raw    []string
+	text   string
+	ending string
+}
+
+func NewRawReader(r io.Reader) *RawReader {
+	return &RawReader{Comma: ',', r: bufio.NewReader(r)}
+}
+
+// Read reads the next record, which may span several lines if it has quoted
+// fields containing line breaks.  At the end of the input it returns io.EOF.
+func (rr *RawReader) Read() (*RawRecord, error) {
+	line, err := rr.readLine()
+	for err == nil && rr.skip(line) {
+		line, err = rr.readLine()
+	}
+	if err != nil {
+		return nil, err
+	}
+	startLine := rr.line
+	rec := &RawRecord{}
+	comma := string(rr.Comma)
+	pos := 0
+	for {
+		start := pos
+		var value string
+		if strings.HasPrefix(line[pos:], `"`) {
+			var b strings.Builder
+			pos++
+			for {
+				i := strings.IndexByte(line[pos:], '"')
+				if i < 0 {
+					b.WriteString(line[pos:])
+					next, err := rr.readLine()
+					if err == io.EOF {
+						return nil, fmt.Errorf("line %d: quoted field is not terminated", startLine)
+					}
+					if err != nil {
+						return nil, err
+					}
+					line += next
+					pos = len(line) - len(next)
+					continue
+				}
+				b.WriteString(line[pos : pos+i])
+				pos += i + 1
+				if strings.HasPrefix(line[pos:], `"`) {
+					b.WriteByte('"')
+					pos++
+					continue
+				}
+				break
+			}
+			value = strings.Replace(b.String(), "\r\n", "\n", -1)
+			rest := line[pos:]
+			if rest != "" && rest != "\n" && rest != "\r\n" && !strings.HasPrefix(rest, comma) {
+				return nil, fmt.Errorf("line %d: extraneous %q after quoted field %d", rr.line, `"`, len(rec.Fields)+1)
+			}
+		} else {
+			end := strings.Index(line[pos:], comma)
+			if end < 0 {
+				end = len(strings.TrimRight(line[pos:], "\r\n"))
+			}
+			pos += end
+			value = line[start:pos]
+		}
+		rec.Fields = append(rec.Fields, value)
+		rec.raw = append(rec.raw, line[start:pos])
+		if !strings.HasPrefix(line[pos:], comma) {
+			break
+		}
+		pos += len(comma)
+	}
+	rec.values = append([]string{}, rec.Fields...)
+	rec.text = line
+	rec.ending = line[pos:]
+	return rec, nil
+}
+
+// skip reports whether line is empty or a comment, which csv.Reader also
+// skips.
+func (rr *RawReader) skip(line string) bool {
+	if line == "\n" || line == "\r\n" {
+		return true
+	}
+	return rr.Comment != 0 && strings.HasPrefix(line, string(rr.Comment))
+}
+
+func (rr *RawReader) readLine() (string, error) {
+	line, err := rr.r.ReadString('\n')
+	if err == io.EOF && line != "" {
+		err = nil
+	}
+	if err != nil {
+		return "", err
+	}
+	rr.line++
+	return line, nil
+}
+
+// Write writes the record to w, separating fields with comma.  Fields that
+// have not been changed are written with their original text, and the others
+// are quoted if necessary.  The record ends with its original line ending.
+func (rec *RawRecord) Write(w io.Writer, comma rune) error {
+	if rec.unchanged() {
+		_, err := io.WriteString(w, rec.text)
+		return err
+	}
+	var b strings.Builder
+	for i, field := range rec.Fields {
+		if i > 0 {
+			b.WriteRune(comma)
+		}
+		if i < len(rec.values) && field == rec.values[i] {
+			b.WriteString(rec.raw[i])
+			continue
+		}
+		b.WriteString(quoteField(field, comma))
+	}
+	b.WriteString(rec.ending)
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// WriteOriginal writes the record to w exactly as it was read.
+func (rec *RawRecord) WriteOriginal(w io.Writer) error {
+	_, err := io.WriteString(w, rec.text)
+	return err
+}
+
+func (rec *RawRecord) unchanged() bool {
+	if len(rec.Fields) != len(rec.values) {
+		return false
+	}
+	for i := range rec.Fields {
+		if rec.Fields[i] != rec.values[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// quoteField quotes field if csv.Writer would.
+func quoteField(field string, comma rune) string {
+	if field == "" {
+		return field
+	}
+	r, _ := utf8.DecodeRuneInString(field)
+	if !strings.ContainsRune(field, comma) && !strings.ContainsAny(field, "\"\r\n") && !unicode.IsSpace(r) {
+		return field
+	}
+	return `"` + strings.Replace(field, `"`, `""`, -1) + `"`
+}
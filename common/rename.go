@@ -0,0 +1,38 @@
+package common
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// HeaderRename renames the columns of a header whose names match a regular
+// expression.
+type HeaderRename struct {
+	Pattern *regexp.Regexp
+	// Replacement replaces each match in a name, with $1 and so on standing
+	// for its submatches, as in regexp.ReplaceAllString.
+	Replacement string
+}
+
+// ParseHeaderRename parses a rename given as "regexp:replacement".  The
+// replacement is everything after the last colon, so the regular expression
+// may contain colons but the replacement may not.
+func ParseHeaderRename(spec string) (*HeaderRename, error) {
+	i := strings.LastIndex(spec, ":")
+	if i < 0 {
+		return nil, fmt.Errorf("%s: rename must be given as regexp:replacement", spec)
+	}
+	pattern, err := regexp.Compile(spec[:i])
+	if err != nil {
+		return nil, err
+	}
+	return &HeaderRename{Pattern: pattern, Replacement: spec[i+1:]}, nil
+}
+
+// Apply renames, in place, the names in header that match.
+func (hr *HeaderRename) Apply(header []string) {
+	for i, name := range header {
+		header[i] = hr.Pattern.ReplaceAllString(name, hr.Replacement)
+	}
+}
@@ -0,0 +1,83 @@
+package common
+
+import (
+	"bufio"
+	"io"
+	"strings"
+)
+
+// sepWriter writes records with fields separated by a string of any length,
+// for separators that csv.Writer, which takes a single rune, cannot use.
+// It also writes fields quoted with a character other than the double quote,
+// and fixed width fields, which csv.Writer would quote if they begin with a
+// space.
+// Fields containing the separator, the quote character or a line break are
+// quoted as csv.Writer would quote them.
+type sepWriter struct {
+	w       *bufio.Writer
+	sep     string
+	quote   string
+	useCRLF bool
+	err     error
+}
+
+func newSepWriter(output io.Writer, sep, quote string, useCRLF bool) *sepWriter {
+	return &sepWriter{w: bufio.NewWriter(output), sep: sep, quote: quote, useCRLF: useCRLF}
+}
+
+func (sw *sepWriter) Write(record []string) error {
+	if sw.err != nil {
+		return sw.err
+	}
+	for i, field := range record {
+		if i > 0 {
+			sw.w.WriteString(sw.sep)
+		}
+		if !sw.needsQuotes(field) {
+			sw.w.WriteString(field)
+			continue
+		}
+		sw.w.WriteString(sw.quote)
+		field = strings.Replace(field, sw.quote, sw.quote+sw.quote, -1)
+		if sw.useCRLF {
+			field = strings.Replace(field, "\r\n", "\n", -1)
+			field = strings.Replace(field, "\n", "\r\n", -1)
+		}
+		sw.w.WriteString(field)
+		sw.w.WriteString(sw.quote)
+	}
+	if sw.useCRLF {
+		_, sw.err = sw.w.WriteString("\r\n")
+	} else {
+		sw.err = sw.w.WriteByte('\n')
+	}
+	return sw.err
+}
+
+// needsQuotes reports whether field must be quoted.  Besides fields containing
+// the separator, this includes fields ending with part of it, such as "a|"
+// with a separator of "||", which would otherwise be split in the wrong place.
+func (sw *sepWriter) needsQuotes(field string) bool {
+	return strings.Contains(field+sw.sep[:len(sw.sep)-1], sw.sep) ||
+		strings.ContainsAny(field, sw.quote+"\r\n")
+}
+
+func (sw *sepWriter) WriteAll(records [][]string) error {
+	for _, record := range records {
+		if err := sw.Write(record); err != nil {
+			return err
+		}
+	}
+	sw.Flush()
+	return sw.Error()
+}
+
+func (sw *sepWriter) Flush() {
+	if err := sw.w.Flush(); err != nil && sw.err == nil {
+		sw.err = err
+	}
+}
+
+func (sw *sepWriter) Error() error {
+	return sw.err
+}
@@ -0,0 +1,274 @@
+package common
+
+import "strings"
+
+// ChainCompareFuncs returns a CSVCompareFunc that orders records by each of
+// funcs in turn: records that are equal by one, neither being less than the
+// other, are ordered by the next.  Records equal by all of them are equal.
+func ChainCompareFuncs(funcs ...CSVCompareFunc) CSVCompareFunc {
+	return func(r1 []string, r2 []string) bool {
+		for _, less := range funcs {
+			if less(r1, r2) {
+				return true
+			}
+			if less(r2, r1) {
+				return false
+			}
+		}
+		return false
+	}
+}
+
+// CompareFields compares two fields as strings, byte by byte, or with a flag
+// of 'n', as numbers, or with a flag of 'h', in natural order, as described
+// by naturalCmp, or with a flag of 'c', in dictionary order, as described by
+// collationKey.  With 'n', fields that are not numbers sort before those
+// that are, and among themselves as strings.  The result is negative if a
+// sorts before b, positive if after, and 0 if they are equal.
+func CompareFields(a, b string, flag byte) int {
+	return NumberFormat{}.CompareFields(a, b, flag)
+}
+
+// CompareFields compares two fields as the function CompareFields does,
+// parsing numbers in the format nf.
+func (nf NumberFormat) CompareFields(a, b string, flag byte) int {
+	ka, kb := newFieldKey(a, flag, nf), newFieldKey(b, flag, nf)
+	return ka.compare(&kb, flag)
+}
+
+// FieldsCompareFunc returns a function ordering records by each field of
+// ranges in turn, compared by CompareFields with the flag of its range.
+func FieldsCompareFunc(ranges []*FieldRange) CSVCompareFunc {
+	return NumberFormat{}.FieldsCompareFunc(ranges)
+}
+
+// FieldsCompareFunc returns a function ordering records as the function
+// FieldsCompareFunc does, parsing numbers in the format nf.
+func (nf NumberFormat) FieldsCompareFunc(ranges []*FieldRange) CSVCompareFunc {
+	fields, flags := sortFields(ranges)
+	funcs := make([]CSVCompareFunc, len(fields))
+	for k, i := range fields {
+		funcs[k] = nf.fieldCompareFunc(i, flags[k])
+	}
+	return ChainCompareFuncs(funcs...)
+}
+
+// sortFields returns the fields of ranges in the order they are compared,
+// with the flag each is compared with.
+func sortFields(ranges []*FieldRange) (fields []int, flags []byte) {
+	for _, r := range ranges {
+		if r.End < 0 {
+			fields, flags = append(fields, r.Start), append(flags, r.Flag)
+		}
+		for i := r.Start; i <= r.End; i++ {
+			fields, flags = append(fields, i), append(flags, r.Flag)
+		}
+	}
+	return fields, flags
+}
+
+// fieldCompareFunc returns a function ordering records by field i, as
+// CompareFields compares it with flag.
+func (nf NumberFormat) fieldCompareFunc(i int, flag byte) CSVCompareFunc {
+	return func(r1 []string, r2 []string) bool {
+		return nf.CompareFields(r1[i], r2[i], flag) < 0
+	}
+}
+
+// naturalCmp compares a and b as sequences of runs of digits and runs of
+// other characters, comparing runs of digits by their value, so that "file2"
+// sorts before "file10".  Other runs are compared byte by byte, and a run of
+// digits sorts before a run of other characters.  Strings that are equal
+// this way, such as "a01" and "a1", are compared byte by byte.
+func naturalCmp(a, b string) int {
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		digits := isDigit(a[i])
+		if digits != isDigit(b[j]) {
+			if digits {
+				return -1
+			}
+			return 1
+		}
+		ei, ej := runEnd(a, i, digits), runEnd(b, j, digits)
+		var c int
+		if digits {
+			c = compareDigits(a[i:ei], b[j:ej])
+		} else {
+			c = strings.Compare(a[i:ei], b[j:ej])
+		}
+		if c != 0 {
+			return c
+		}
+		i, j = ei, ej
+	}
+	switch {
+	case i < len(a):
+		return 1
+	case j < len(b):
+		return -1
+	}
+	return strings.Compare(a, b)
+}
+
+// hasEmptyField reports whether any of fields of record is empty, white
+// space or missing.
+func hasEmptyField(record []string, fields []int) bool {
+	for _, i := range fields {
+		if i >= len(record) || strings.TrimSpace(record[i]) == "" {
+			return true
+		}
+	}
+	return false
+}
+
+// emptyLastFunc returns a function ordering records with an empty field
+// among fields after those without, or before if reverse is set, so that
+// they still come last once the order is reversed.
+func emptyLastFunc(fields []int, reverse bool) CSVCompareFunc {
+	return func(r1 []string, r2 []string) bool {
+		e1, e2 := hasEmptyField(r1, fields), hasEmptyField(r2, fields)
+		if reverse {
+			return e1 && !e2
+		}
+		return !e1 && e2
+	}
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// runEnd returns the end of the run of digits, or of other characters,
+// beginning at s[i].
+func runEnd(s string, i int, digits bool) int {
+	for i < len(s) && isDigit(s[i]) == digits {
+		i++
+	}
+	return i
+}
+
+// compareDigits compares two runs of digits by their value, however long.
+func compareDigits(a, b string) int {
+	a, b = strings.TrimLeft(a, "0"), strings.TrimLeft(b, "0")
+	if len(a) != len(b) {
+		return len(a) - len(b)
+	}
+	return strings.Compare(a, b)
+}
+
+// fieldKey is a field as it is compared with a flag, computed once for each
+// record sorted rather than on each comparison.  With 'n', num holds the
+// field as a number if isNum is set.  With 'c', str is the collation key of
+// the field.
+type fieldKey struct {
+	str   string
+	num   float64
+	isNum bool
+}
+
+func newFieldKey(field string, flag byte, nf NumberFormat) fieldKey {
+	key := fieldKey{str: field}
+	if flag == 'c' {
+		key.str = collationKey(field)
+	}
+	if flag == 'n' {
+		f, err := nf.Parse(field)
+		key.num, key.isNum = f, err == nil
+	}
+	return key
+}
+
+// compare compares two keys with flag.  It is the one comparison behind both
+// CompareFields and keyed sorts, so that the two always agree.
+func (a *fieldKey) compare(b *fieldKey, flag byte) int {
+	switch {
+	case flag == 'h':
+		return naturalCmp(a.str, b.str)
+	case flag != 'n' || !a.isNum && !b.isNum:
+		return strings.Compare(a.str, b.str)
+	case !a.isNum:
+		return -1
+	case !b.isNum:
+		return 1
+	case a.num < b.num:
+		return -1
+	case b.num < a.num:
+		return 1
+	}
+	return 0
+}
+
+// keyedRecord is a record with its keys and its position in the input.
+// empty is set if the record has an empty field that sorts it last.
+type keyedRecord struct {
+	keys   []fieldKey
+	record []string
+	index  int
+	empty  bool
+}
+
+// keyedCSV sorts records by their keys, after putting last those with empty
+// set, even when the sort is reversed.  If indexed is set, records whose
+// keys are equal are ordered by their positions, in ascending order even
+// when the sort is reversed.
+type keyedCSV struct {
+	records  []keyedRecord
+	flags    []byte
+	indexed  bool
+	reversed bool
+}
+
+func (kcsv *keyedCSV) Len() int {
+	return len(kcsv.records)
+}
+
+func (kcsv *keyedCSV) Less(i, j int) bool {
+	a, b := &kcsv.records[i], &kcsv.records[j]
+	if a.empty != b.empty {
+		return b.empty != kcsv.reversed
+	}
+	for k, flag := range kcsv.flags {
+		if c := a.keys[k].compare(&b.keys[k], flag); c != 0 {
+			return c < 0
+		}
+	}
+	return kcsv.indexed && (a.index < b.index) != kcsv.reversed
+}
+
+func (kcsv *keyedCSV) Swap(i, j int) {
+	kcsv.records[i], kcsv.records[j] = kcsv.records[j], kcsv.records[i]
+}
+
+// newKeyedCSV computes the keys of records by the fields of ranges, parsing
+// numbers in the format nf, and marks those with an empty field among
+// emptyFields.  The keys of all the records share a single slice.
+func newKeyedCSV(records [][]string, index []int, ranges []*FieldRange, emptyFields []int, nf NumberFormat, reverse bool) *keyedCSV {
+	fields, flags := sortFields(ranges)
+	kcsv := &keyedCSV{make([]keyedRecord, len(records)), flags, index != nil, reverse}
+	keys := make([]fieldKey, len(records)*len(fields))
+	for i, record := range records {
+		kr := &kcsv.records[i]
+		kr.keys, keys = keys[:len(fields):len(fields)], keys[len(fields):]
+		for k, field := range fields {
+			kr.keys[k] = newFieldKey(record[field], flags[k], nf)
+		}
+		kr.record = record
+		kr.empty = hasEmptyField(record, emptyFields)
+		if index != nil {
+			kr.index = index[i]
+		}
+	}
+	return kcsv
+}
+
+// store writes the records, and their positions if indexed, back in their
+// sorted order.
+func (kcsv *keyedCSV) store(records [][]string, index []int) {
+	for i, kr := range kcsv.records {
+		records[i] = kr.record
+		if kcsv.indexed {
+			index[i] = kr.index
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package common
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"text/template"
+)
+
+// ParseOutputTemplate parses a text/template used to format each output
+// record.  Referring to a field that does not exist is an error when the
+// template is executed.
+func ParseOutputTemplate(text string) (*template.Template, error) {
+	return template.New("output").Option("missingkey=error").Parse(text)
+}
+
+// TemplateWriter writes each record by executing a template, followed by a
+// line ending.  The first record written is taken as the header.  In the
+// template, fields are available as .F0, .F1 and so on, counting from 0, and
+// by their names in the header, as .Name or index . "Full Name".
+type TemplateWriter struct {
+	w        *bufio.Writer
+	tmpl     *template.Template
+	header   []string
+	newline  string
+	err      error
+	gotFirst bool
+}
+
+func NewTemplateWriter(output io.Writer, tmpl *template.Template, useCRLF bool) *TemplateWriter {
+	newline := "\n"
+	if useCRLF {
+		newline = "\r\n"
+	}
+	return &TemplateWriter{w: bufio.NewWriter(output), tmpl: tmpl, newline: newline}
+}
+
+func (tw *TemplateWriter) Write(record []string) error {
+	if tw.err != nil {
+		return tw.err
+	}
+	if !tw.gotFirst {
+		tw.header = append([]string{}, record...)
+		tw.gotFirst = true
+		return nil
+	}
+	data := make(map[string]string, 2*len(record))
+	for i, field := range record {
+		if i < len(tw.header) {
+			data[tw.header[i]] = field
+		}
+	}
+	for i, field := range record {
+		data[fmt.Sprintf("F%d", i)] = field
+	}
+	if tw.err = tw.tmpl.Execute(tw.w, data); tw.err != nil {
+		return tw.err
+	}
+	_, tw.err = tw.w.WriteString(tw.newline)
+	return tw.err
+}
+
+func (tw *TemplateWriter) WriteAll(records [][]string) error {
+	for _, record := range records {
+		if err := tw.Write(record); err != nil {
+			return err
+		}
+	}
+	tw.Flush()
+	return tw.Error()
+}
+
+func (tw *TemplateWriter) Flush() {
+	if err := tw.w.Flush(); err != nil && tw.err == nil {
+		tw.err = err
+	}
+}
+
+func (tw *TemplateWriter) Error() error {
+	return tw.err
+}
@@ -0,0 +1,177 @@
+package common
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// transformFuncs holds the transformations that may be applied to a field,
+// by name.
+var transformFuncs = map[string]func(string) (string, error){
+	"base64encode": func(s string) (string, error) {
+		return base64.StdEncoding.EncodeToString([]byte(s)), nil
+	},
+	"base64decode": func(s string) (string, error) {
+		b, err := base64.StdEncoding.DecodeString(s)
+		return string(b), err
+	},
+	"urlencode": func(s string) (string, error) {
+		return url.QueryEscape(s), nil
+	},
+	"urldecode": url.QueryUnescape,
+	"md5": func(s string) (string, error) {
+		sum := md5.Sum([]byte(s))
+		return hex.EncodeToString(sum[:]), nil
+	},
+	"sha256": func(s string) (string, error) {
+		sum := sha256.Sum256([]byte(s))
+		return hex.EncodeToString(sum[:]), nil
+	},
+	"upper": func(s string) (string, error) {
+		return strings.ToUpper(s), nil
+	},
+	"lower": func(s string) (string, error) {
+		return strings.ToLower(s), nil
+	},
+	"title": func(s string) (string, error) {
+		return titleCase(s), nil
+	},
+}
+
+// titleCase returns s with the first letter of each word in title case,
+// leaving the rest as they are.  A word is a run of letters, digits,
+// underscores and apostrophes, so "don't" becomes "Don't".
+func titleCase(s string) string {
+	inWord := false
+	return strings.Map(func(r rune) rune {
+		wasInWord := inWord
+		inWord = unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' || r == '\''
+		if wasInWord {
+			return r
+		}
+		return unicode.ToTitle(r)
+	}, s)
+}
+
+// caseTransforms are the names of the transforms accepted by
+// ParseCaseTransforms.
+var caseTransforms = map[string]bool{"upper": true, "lower": true, "title": true}
+
+// FieldTransform is a transformation applied to a single field of every
+// record.
+type FieldTransform struct {
+	Field int
+	Name  string
+	fn    func(string) (string, error)
+}
+
+// ParseFieldTransform parses a transform given as "N:name", where N is a
+// field number starting at 1.
+func ParseFieldTransform(spec string) (*FieldTransform, error) {
+	splits := strings.SplitN(spec, ":", 2)
+	if len(splits) != 2 {
+		return nil, fmt.Errorf("%s: invalid transform, must be N:name", spec)
+	}
+	i, err := strconv.ParseInt(splits[0], 10, 32)
+	if err != nil {
+		return nil, err
+	}
+	if i <= 0 {
+		return nil, fmt.Errorf("%d: field specifiers must be greater than 0", i)
+	}
+	fn, ok := transformFuncs[splits[1]]
+	if !ok {
+		return nil, fmt.Errorf("%s: unknown transform", splits[1])
+	}
+	return &FieldTransform{Field: int(i) - 1, Name: splits[1], fn: fn}, nil
+}
+
+// ParseFieldTransforms parses each of specs with ParseFieldTransform.
+func ParseFieldTransforms(specs []string) ([]*FieldTransform, error) {
+	var transforms []*FieldTransform
+	for _, spec := range specs {
+		t, err := ParseFieldTransform(spec)
+		if err != nil {
+			return nil, err
+		}
+		transforms = append(transforms, t)
+	}
+	return transforms, nil
+}
+
+// ParseCaseTransforms parses a change of case given as "case:ranges", where
+// case is one of upper, lower or title and ranges is a comma-separated list of
+// field ranges, returning a transform for each field.
+func ParseCaseTransforms(spec string) ([]*FieldTransform, error) {
+	splits := strings.SplitN(spec, ":", 2)
+	if len(splits) != 2 {
+		return nil, fmt.Errorf("%s: invalid case, must be case:ranges", spec)
+	}
+	name := splits[0]
+	if !caseTransforms[name] {
+		return nil, fmt.Errorf("%s: unknown case, must be upper, lower or title", name)
+	}
+	ranges, err := ParseFieldRanges(splits[1])
+	if err != nil {
+		return nil, err
+	}
+	var transforms []*FieldTransform
+	for _, i := range FieldIndices(ranges) {
+		transforms = append(transforms, &FieldTransform{Field: i, Name: name, fn: transformFuncs[name]})
+	}
+	return transforms, nil
+}
+
+// ParseDateTransforms parses a comma-separated list of field ranges, and
+// returns a transform for each field that parses its value as a time with
+// the layout from, as for time.Parse, and formats it with the layout to.
+// Empty values are left as they are.
+func ParseDateTransforms(ranges, from, to string) ([]*FieldTransform, error) {
+	frs, err := ParseFieldRanges(ranges)
+	if err != nil {
+		return nil, err
+	}
+	fn := func(s string) (string, error) {
+		if strings.TrimSpace(s) == "" {
+			return s, nil
+		}
+		t, err := time.Parse(from, strings.TrimSpace(s))
+		if err != nil {
+			return "", err
+		}
+		return t.Format(to), nil
+	}
+	var transforms []*FieldTransform
+	for _, i := range FieldIndices(frs) {
+		transforms = append(transforms, &FieldTransform{Field: i, Name: "date", fn: fn})
+	}
+	return transforms, nil
+}
+
+// ApplyTransforms returns a copy of record with each of the transforms
+// applied in order.
+func ApplyTransforms(transforms []*FieldTransform, record []string) ([]string, error) {
+	if len(transforms) == 0 {
+		return record, nil
+	}
+	transformed := append([]string(nil), record...)
+	for _, t := range transforms {
+		if t.Field >= len(transformed) {
+			return nil, fmt.Errorf("%d: no such field in record of length %d", t.Field+1, len(transformed))
+		}
+		v, err := t.fn(transformed[t.Field])
+		if err != nil {
+			return nil, fmt.Errorf("%s of field %d: %v", t.Name, t.Field+1, err)
+		}
+		transformed[t.Field] = v
+	}
+	return transformed, nil
+}
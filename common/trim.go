@@ -0,0 +1,77 @@
+package common
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// FieldTrim removes white space from the start, end or both ends of some or
+// all of the fields of a record, or a pair of quotes around them.
+type FieldTrim struct {
+	// Fields are the indices of the fields to trim, or nil for all fields.
+	Fields []int
+	// Mode is one of "all", "left", "right" or "quotes".
+	Mode string
+}
+
+// ParseFieldTrim parses a trim given as "ranges:mode", where ranges is a
+// comma-separated list of field ranges and mode is one of all, left, right or
+// quotes.  The mode may be left out, in which case it is all.
+func ParseFieldTrim(spec string) (*FieldTrim, error) {
+	ranges, mode := spec, "all"
+	if i := strings.LastIndex(spec, ":"); i >= 0 {
+		ranges, mode = spec[:i], spec[i+1:]
+	}
+	switch mode {
+	case "all", "left", "right", "quotes":
+	default:
+		return nil, fmt.Errorf("%s: unknown trim mode, must be all, left, right or quotes", mode)
+	}
+	frs, err := ParseFieldRanges(ranges)
+	if err != nil {
+		return nil, err
+	}
+	if len(frs) == 0 {
+		return nil, fmt.Errorf("%s: no fields to trim", spec)
+	}
+	return &FieldTrim{Fields: FieldIndices(frs), Mode: mode}, nil
+}
+
+// Apply trims the fields of record in place.  Fields beyond the end of the
+// record are ignored.
+func (t *FieldTrim) Apply(record []string) {
+	if t.Fields == nil {
+		for i := range record {
+			record[i] = t.trim(record[i])
+		}
+		return
+	}
+	for _, i := range t.Fields {
+		if i < len(record) {
+			record[i] = t.trim(record[i])
+		}
+	}
+}
+
+func (t *FieldTrim) trim(s string) string {
+	switch t.Mode {
+	case "left":
+		return strings.TrimLeftFunc(s, unicode.IsSpace)
+	case "right":
+		return strings.TrimRightFunc(s, unicode.IsSpace)
+	case "quotes":
+		return stripQuotes(s)
+	}
+	return strings.TrimSpace(s)
+}
+
+// stripQuotes removes a double or single quote from each end of s, if it
+// begins and ends with the same one.  Only one pair is removed, and quotes
+// within s are left as they are.
+func stripQuotes(s string) string {
+	if len(s) >= 2 && (s[0] == '"' || s[0] == '\'') && s[len(s)-1] == s[0] {
+		return s[1 : len(s)-1]
+	}
+	return s
+}
@@ -0,0 +1,109 @@
+package common
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// RecordWriter is the interface through which records are written to the
+// output.  *csv.Writer satisfies it, and wrappers may transform records
+// before passing them on.
+type RecordWriter interface {
+	Write(record []string) error
+	WriteAll(records [][]string) error
+	Flush()
+	Error() error
+}
+
+// fieldWidthWriter pads or truncates every field to a fixed number of
+// characters before writing it.
+type fieldWidthWriter struct {
+	RecordWriter
+	width int
+	pad   rune
+}
+
+func (fw *fieldWidthWriter) Write(record []string) error {
+	fitted := make([]string, len(record))
+	for i, field := range record {
+		fitted[i] = fitField(field, fw.width, fw.pad)
+	}
+	return fw.RecordWriter.Write(fitted)
+}
+
+func (fw *fieldWidthWriter) WriteAll(records [][]string) error {
+	for _, record := range records {
+		if err := fw.Write(record); err != nil {
+			return err
+		}
+	}
+	fw.Flush()
+	return fw.Error()
+}
+
+func fitField(field string, width int, pad rune) string {
+	n := utf8.RuneCountInString(field)
+	if n > width {
+		return string([]rune(field)[:width])
+	}
+	buf := make([]rune, 0, width)
+	buf = append(buf, []rune(field)...)
+	for ; n < width; n++ {
+		buf = append(buf, pad)
+	}
+	return string(buf)
+}
+
+// formulaGuardWriter prefixes every field that a spreadsheet would take as a
+// formula with an escape string, usually a single quote, before writing it.
+type formulaGuardWriter struct {
+	RecordWriter
+	escape string
+}
+
+func (gw *formulaGuardWriter) Write(record []string) error {
+	guarded := make([]string, len(record))
+	for i, field := range record {
+		if field != "" && strings.ContainsRune("=+-@", rune(field[0])) {
+			field = gw.escape + field
+		}
+		guarded[i] = field
+	}
+	return gw.RecordWriter.Write(guarded)
+}
+
+func (gw *formulaGuardWriter) WriteAll(records [][]string) error {
+	for _, record := range records {
+		if err := gw.Write(record); err != nil {
+			return err
+		}
+	}
+	gw.Flush()
+	return gw.Error()
+}
+
+// skipFirstWriter drops the first record written, which is the header, and
+// writes the rest.  It is used when appending to a file that already has a
+// header.
+type skipFirstWriter struct {
+	RecordWriter
+	skipped bool
+}
+
+func (sw *skipFirstWriter) Write(record []string) error {
+	if !sw.skipped {
+		sw.skipped = true
+		return nil
+	}
+	return sw.RecordWriter.Write(record)
+}
+
+func (sw *skipFirstWriter) WriteAll(records [][]string) error {
+	for _, record := range records {
+		if err := sw.Write(record); err != nil {
+			return err
+		}
+	}
+	sw.Flush()
+	return sw.Error()
+}
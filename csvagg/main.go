@@ -0,0 +1,499 @@
+package main
+
+import (
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"github.com/laslowh/cursive/common"
+	"os"
+	"strconv"
+	"strings"
+)
+
+var (
+	fInputSeparator        = flag.String("is", ",", "input separator")
+	fInputTabSeparator     = flag.Bool("its", false, "input separator is the tab character (overrides -is)")
+	fInputComment          = flag.String("ic", "", "input beginning of line comment character")
+	fInputFieldsPerLine    = common.FieldsPerLine(-1)
+	fInputLazyQuotes       = flag.Bool("iq", false, "input allow 'lazy' quotes")
+	fInputTrimLeadingSpace = flag.Bool("it", false, "input trim leading space")
+
+	fOutputFile      = flag.String("o", "", "output file; defaults to stdout")
+	fAppendOutput    = flag.Bool("append", false, "append to the output file instead of replacing it, without repeating the header")
+	fOutputSeparator = flag.String("os", "", "output separator, which may be more than one character; defaults to input separator")
+	fOutputTabSep    = flag.Bool("ots", false, "output separator is the tab character (overrides -os)")
+	fOutputCRLF      = flag.Bool("oc", false, "output using CRLF as line ending")
+	fOutputNewline   = flag.String("newline", "lf", "output line ending: lf, crlf or cr")
+
+	fIgnoreBeginning = flag.Int("bi", 0, "number of lines to ignore at beginning of file")
+	fIgnoreEnd       = flag.Int("ei", 0, "number of lines to ignore at end of file")
+	fNoHeader        = flag.Bool("h", false, "no header row, will create default headers")
+	fFoldCase        = flag.Bool("hci", false, "match the column names given with -g, -agg, -pivot-key and -pivot-val regardless of case")
+	fGroup           = flag.String("g", "", "a comma-separated list of the names or numbers of the columns to group by")
+	fAggregates      common.StringList
+	fPivotKey        = flag.String("pivot-key", "", "name or number of the column whose values become the output columns")
+	fPivotValue      = flag.String("pivot-val", "", "name or number of the column aggregated into each cell of the pivot table")
+	fPivotFunc       = flag.String("pivot-func", "sum", "function used to aggregate -pivot-val: count, sum, min, max or mean")
+	fLogFile         = flag.String("log-file", "", "append error and warning messages to this file instead of writing them to standard error")
+)
+
+func init() {
+	flag.Var(&fInputFieldsPerLine, "in", "input expected number of fields per line (-1 is any, strict is the number in the first line)")
+	flag.BoolVar(fInputTabSeparator, "input-tsv", false, "alias for -its")
+	flag.BoolVar(fOutputTabSep, "output-tsv", false, "alias for -ots")
+	flag.Var(&fAggregates, "agg", "an aggregate as func:column, where func is count, sum, min, max or mean; may be repeated")
+}
+
+var usage = func() {
+	fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [options] [ <input> ]\n", os.Args[0])
+	flag.PrintDefaults()
+	fmt.Fprintf(flag.CommandLine.Output(), DESCRIPTION)
+	os.Exit(1)
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+	if err := common.SetLogFile(*fLogFile); err != nil {
+		fmt.Fprintf(os.Stderr, "%v: error opening log file\n", err)
+		os.Exit(1)
+	}
+	defer common.CloseLogFile()
+	if *fInputTabSeparator {
+		*fInputSeparator = "\t"
+	}
+	if *fOutputTabSep {
+		*fOutputSeparator = "\t"
+	}
+	if *fOutputSeparator == "" {
+		*fOutputSeparator = *fInputSeparator
+	}
+	groupNames, err := parseNames(*fGroup)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v: error parsing group columns\n", err)
+		os.Exit(1)
+	}
+	pivoting := *fPivotKey != "" || *fPivotValue != ""
+	if pivoting && (*fPivotKey == "" || *fPivotValue == "") {
+		fmt.Fprintf(os.Stderr, "-pivot-key and -pivot-val must be given together\n")
+		os.Exit(1)
+	}
+	if pivoting && len(fAggregates) > 0 {
+		fmt.Fprintf(os.Stderr, "-agg cannot be used with -pivot-key\n")
+		os.Exit(1)
+	}
+	var specs []aggSpec
+	for _, a := range fAggregates {
+		spec, err := parseAggSpec(a)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v: error parsing aggregate\n", err)
+			os.Exit(1)
+		}
+		specs = append(specs, spec)
+	}
+	if pivoting {
+		if !validFunc(*fPivotFunc) {
+			fmt.Fprintf(os.Stderr, "%s: unknown aggregate function\n", *fPivotFunc)
+			os.Exit(1)
+		}
+	} else if len(specs) == 0 {
+		usage()
+	}
+
+	var t table
+	if pivoting {
+		t = newPivotTable(groupNames, *fPivotKey, *fPivotValue, *fPivotFunc)
+	} else {
+		t = newGroupTable(groupNames, specs)
+	}
+	procFunc := func(record []string, buffer []string, isHeader bool, lineNo int) ([][]string, error) {
+		if isHeader {
+			return nil, t.header(record)
+		}
+		return nil, t.add(record)
+	}
+
+	proc := common.CSVProcessor{
+		InputSeparator:        *fInputSeparator,
+		InputTabSeparator:     *fInputTabSeparator,
+		InputComment:          *fInputComment,
+		InputFieldsPerLine:    int(fInputFieldsPerLine),
+		InputLazyQuotes:       *fInputLazyQuotes,
+		InputTrimLeadingSpace: *fInputTrimLeadingSpace,
+
+		OutputFile:      *fOutputFile,
+		AppendOutput:    *fAppendOutput,
+		OutputSeparator: *fOutputSeparator,
+		OutputCRLF:      *fOutputCRLF,
+		OutputNewline:   *fOutputNewline,
+
+		IgnoreBeginning: *fIgnoreBeginning,
+		IgnoreEnd:       *fIgnoreEnd,
+		NoHeader:        *fNoHeader,
+
+		EndFunc: t.end,
+	}
+
+	err = proc.OpenIO(flag.Args())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v: error opening file\n", err)
+		os.Exit(1)
+	}
+
+	err = proc.Process(procFunc, false)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+	err = proc.Close()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+}
+
+// table accumulates the input rows and produces the output records once
+// they have all been read.
+type table interface {
+	header(record []string) error
+	add(record []string) error
+	end() ([][]string, error)
+}
+
+// groupTable computes a set of aggregates for each group of rows.
+type groupTable struct {
+	groupNames []string
+	specs      []aggSpec
+	groupCols  []int
+	aggCols    []int
+	outHeader  []string
+	order      []string
+	groups     map[string]*groupRow
+}
+
+type groupRow struct {
+	key  []string
+	aggs []*aggregator
+}
+
+func newGroupTable(groupNames []string, specs []aggSpec) *groupTable {
+	return &groupTable{groupNames: groupNames, specs: specs, groups: make(map[string]*groupRow)}
+}
+
+func (t *groupTable) header(record []string) error {
+	var err error
+	t.groupCols, err = common.FindColumns(record, t.groupNames, *fFoldCase)
+	if err != nil {
+		return err
+	}
+	columns := make([]string, len(t.specs))
+	for i, spec := range t.specs {
+		columns[i] = spec.column
+	}
+	t.aggCols, err = common.FindColumns(record, columns, *fFoldCase)
+	if err != nil {
+		return err
+	}
+	t.outHeader = fields(record, t.groupCols)
+	for i, spec := range t.specs {
+		t.outHeader = append(t.outHeader, spec.fn+"("+record[t.aggCols[i]]+")")
+	}
+	return nil
+}
+
+func (t *groupTable) add(record []string) error {
+	if err := checkLength(record, t.groupCols, t.aggCols); err != nil {
+		return err
+	}
+	key := fields(record, t.groupCols)
+	id := groupID(key)
+	g, ok := t.groups[id]
+	if !ok {
+		g = &groupRow{key: key, aggs: make([]*aggregator, len(t.specs))}
+		for i, spec := range t.specs {
+			g.aggs[i] = &aggregator{fn: spec.fn}
+		}
+		t.groups[id] = g
+		t.order = append(t.order, id)
+	}
+	for i, col := range t.aggCols {
+		if err := g.aggs[i].add(record[col]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *groupTable) end() ([][]string, error) {
+	records := [][]string{t.outHeader}
+	for _, id := range t.order {
+		g := t.groups[id]
+		output := append([]string{}, g.key...)
+		for _, agg := range g.aggs {
+			output = append(output, agg.result())
+		}
+		records = append(records, output)
+	}
+	return records, nil
+}
+
+// pivotTable aggregates a value column for each group and each distinct
+// value of a key column, and outputs a row for each group with a column for
+// each key value.
+type pivotTable struct {
+	groupNames []string
+	keyName    string
+	valueName  string
+	fn         string
+	groupCols  []int
+	keyCol     int
+	valueCol   int
+	outHeader  []string
+	order      []string
+	groups     map[string]*pivotRow
+}
+
+type pivotRow struct {
+	key   []string
+	cells map[string]*aggregator
+	seen  []string
+}
+
+func newPivotTable(groupNames []string, keyName, valueName, fn string) *pivotTable {
+	return &pivotTable{
+		groupNames: groupNames,
+		keyName:    keyName,
+		valueName:  valueName,
+		fn:         fn,
+		groups:     make(map[string]*pivotRow),
+	}
+}
+
+func (t *pivotTable) header(record []string) error {
+	var err error
+	t.groupCols, err = common.FindColumns(record, t.groupNames, *fFoldCase)
+	if err != nil {
+		return err
+	}
+	cols, err := common.FindColumns(record, []string{t.keyName, t.valueName}, *fFoldCase)
+	if err != nil {
+		return err
+	}
+	t.keyCol, t.valueCol = cols[0], cols[1]
+	t.outHeader = fields(record, t.groupCols)
+	return nil
+}
+
+func (t *pivotTable) add(record []string) error {
+	if err := checkLength(record, t.groupCols, []int{t.keyCol, t.valueCol}); err != nil {
+		return err
+	}
+	key := fields(record, t.groupCols)
+	id := groupID(key)
+	g, ok := t.groups[id]
+	if !ok {
+		g = &pivotRow{key: key, cells: make(map[string]*aggregator)}
+		t.groups[id] = g
+		t.order = append(t.order, id)
+	}
+	pivot := record[t.keyCol]
+	cell, ok := g.cells[pivot]
+	if !ok {
+		cell = &aggregator{fn: t.fn}
+		g.cells[pivot] = cell
+		g.seen = append(g.seen, pivot)
+	}
+	return cell.add(record[t.valueCol])
+}
+
+// end builds the pivot table in two passes over the groups: the first
+// collects the distinct key values, in the order they were first seen, which
+// become the columns, and the second fills in the cell of each group for
+// each of them.  Cells for which there were no rows are left empty.
+func (t *pivotTable) end() ([][]string, error) {
+	var columns []string
+	known := make(map[string]bool)
+	for _, id := range t.order {
+		for _, pivot := range t.groups[id].seen {
+			if !known[pivot] {
+				known[pivot] = true
+				columns = append(columns, pivot)
+			}
+		}
+	}
+	records := [][]string{append(t.outHeader, columns...)}
+	for _, id := range t.order {
+		g := t.groups[id]
+		output := append([]string{}, g.key...)
+		for _, pivot := range columns {
+			value := ""
+			if cell, ok := g.cells[pivot]; ok {
+				value = cell.result()
+			}
+			output = append(output, value)
+		}
+		records = append(records, output)
+	}
+	return records, nil
+}
+
+// aggSpec is an aggregate given with -agg: a function applied to a column.
+type aggSpec struct {
+	fn     string
+	column string
+}
+
+func parseAggSpec(s string) (aggSpec, error) {
+	i := strings.IndexByte(s, ':')
+	if i < 0 {
+		return aggSpec{}, fmt.Errorf("%s: aggregate must be given as func:column", s)
+	}
+	spec := aggSpec{fn: s[:i], column: s[i+1:]}
+	if !validFunc(spec.fn) {
+		return aggSpec{}, fmt.Errorf("%s: unknown aggregate function", spec.fn)
+	}
+	if spec.column == "" {
+		return aggSpec{}, fmt.Errorf("%s: missing column", s)
+	}
+	return spec, nil
+}
+
+func validFunc(fn string) bool {
+	switch fn {
+	case "count", "sum", "min", "max", "mean":
+		return true
+	}
+	return false
+}
+
+// aggregator computes one aggregate function over the values added to it.
+// Every function but count requires the values to be numbers.
+type aggregator struct {
+	fn    string
+	count int
+	sum   float64
+	min   float64
+	max   float64
+}
+
+func (a *aggregator) add(value string) error {
+	if a.fn == "count" {
+		a.count++
+		return nil
+	}
+	v, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil {
+		return fmt.Errorf("%s: value is not a number", value)
+	}
+	if a.count == 0 || v < a.min {
+		a.min = v
+	}
+	if a.count == 0 || v > a.max {
+		a.max = v
+	}
+	a.sum += v
+	a.count++
+	return nil
+}
+
+func (a *aggregator) result() string {
+	switch a.fn {
+	case "count":
+		return strconv.Itoa(a.count)
+	case "sum":
+		return formatNumber(a.sum)
+	case "min":
+		return formatNumber(a.min)
+	case "max":
+		return formatNumber(a.max)
+	}
+	return formatNumber(a.sum / float64(a.count))
+}
+
+func formatNumber(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+// groupID returns a string identifying a group by its key fields.
+func groupID(key []string) string {
+	return strings.Join(key, "\x00")
+}
+
+func fields(record []string, indices []int) []string {
+	output := make([]string, len(indices))
+	for i, index := range indices {
+		output[i] = record[index]
+	}
+	return output
+}
+
+func checkLength(record []string, indexLists ...[]int) error {
+	for _, indices := range indexLists {
+		for _, index := range indices {
+			if index >= len(record) {
+				return fmt.Errorf("%d: no such field in record of length %d", index+1, len(record))
+			}
+		}
+	}
+	return nil
+}
+
+// parseNames splits a comma-separated list of column names, which may be
+// quoted as in a CSV file if they contain commas.
+func parseNames(list string) ([]string, error) {
+	if strings.TrimSpace(list) == "" {
+		return nil, nil
+	}
+	r := csv.NewReader(strings.NewReader(list))
+	return r.Read()
+}
+
+const DESCRIPTION = `
+csvagg - aggregate the rows of a CSV file by group
+
+csvagg is part of the Cursive toolkit.  Cursive is a set of utilities for
+reading and writing "separated value" formats like CSV and TSV.
+
+The "-g" flag gives the columns whose values make up the group of each row,
+as a comma-separated list of names or numbers starting at 1.  The repeatable
+"-agg" flag gives an aggregate to compute for each group, as func:column,
+where func is "count", "sum", "min", "max" or "mean".  The output has a row
+for each group, in the order the groups first appear, holding the group
+columns followed by a column for each aggregate, named as func(column).  For
+example, to total the revenue and count the orders of each region:
+
+  csvagg -g=Region -agg=sum:Revenue -agg=count:Revenue input.csv
+
+Without "-g", the whole file is one group.  Values aggregated with anything
+but "count" must be numbers.
+
+With "-hci", column names match the header regardless of case, so -g=region
+groups by a column named "Region".  A column named exactly as given is
+preferred, and if columns whose names differ only in case both match, a
+warning is printed and the first is used.
+
+PIVOT TABLES
+
+With "-pivot-key" and "-pivot-val", csvagg outputs a cross-tab instead.  Each
+distinct value of the "-pivot-key" column becomes a column of the output, in
+the order the values first appear, and each cell holds the "-pivot-val"
+values of the rows in that group with that key, aggregated with
+"-pivot-func", which is "sum" unless given.  Cells for which there are no rows
+are empty.  For example, to output a row for each region with its revenue for
+each month:
+
+  csvagg -g=Region -pivot-key=Month -pivot-val=Revenue input.csv
+
+All the groups and their aggregates are kept in memory until the input has
+been read.
+
+INPUT AND OUTPUT
+
+If <input> is not specified on the command line, csvagg will read from
+standard in.   If no "-o" flag is provided, csvagg will write to standard
+out.
+
+With "-log-file", error and warning messages are appended to the given file
+instead of being written to standard error.
+
+`
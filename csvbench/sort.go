@@ -0,0 +1,161 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"github.com/laslowh/cursive/common"
+	"math/rand/v2"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// sortStrategy sorts records by their first field.
+type sortStrategy struct {
+	name    string
+	numeric bool
+	sort    func(records [][]string, flag byte)
+}
+
+var sortStrategies = []sortStrategy{
+	{"sort", false, func(records [][]string, flag byte) {
+		sort.Sort(newComparedRecords(records, flag))
+	}},
+	{"stable", false, func(records [][]string, flag byte) {
+		sort.Stable(newComparedRecords(records, flag))
+	}},
+	{"keys", true, sortByNumericKeys},
+}
+
+// comparedRecords sorts records by their first field with the comparison
+// csvsort uses.
+type comparedRecords struct {
+	less    common.CSVCompareFunc
+	records [][]string
+}
+
+func newComparedRecords(records [][]string, flag byte) *comparedRecords {
+	ranges := []*common.FieldRange{{Start: 0, End: -1, Flag: flag}}
+	return &comparedRecords{common.FieldsCompareFunc(ranges), records}
+}
+
+func (cr *comparedRecords) Len() int {
+	return len(cr.records)
+}
+
+func (cr *comparedRecords) Less(i, j int) bool {
+	return cr.less(cr.records[i], cr.records[j])
+}
+
+func (cr *comparedRecords) Swap(i, j int) {
+	cr.records[i], cr.records[j] = cr.records[j], cr.records[i]
+}
+
+// sortByNumericKeys sorts records by their first field, parsing each as a
+// number once, rather than on each comparison.  Fields that are not numbers
+// sort first, as with CompareFields.
+func sortByNumericKeys(records [][]string, flag byte) {
+	keyed := &keyedRecords{make([]float64, len(records)), make([]bool, len(records)), records}
+	for i, record := range records {
+		f, err := strconv.ParseFloat(strings.TrimSpace(record[0]), 64)
+		keyed.keys[i], keyed.valid[i] = f, err == nil
+	}
+	sort.Sort(keyed)
+}
+
+type keyedRecords struct {
+	keys    []float64
+	valid   []bool
+	records [][]string
+}
+
+func (kr *keyedRecords) Len() int {
+	return len(kr.records)
+}
+
+func (kr *keyedRecords) Less(i, j int) bool {
+	if kr.valid[i] != kr.valid[j] {
+		return kr.valid[j]
+	}
+	if !kr.valid[i] {
+		return common.CompareFields(kr.records[i][0], kr.records[j][0], 's') < 0
+	}
+	return kr.keys[i] < kr.keys[j]
+}
+
+func (kr *keyedRecords) Swap(i, j int) {
+	kr.keys[i], kr.keys[j] = kr.keys[j], kr.keys[i]
+	kr.valid[i], kr.valid[j] = kr.valid[j], kr.valid[i]
+	kr.records[i], kr.records[j] = kr.records[j], kr.records[i]
+}
+
+// syntheticRecords makes rows records of width fields, whose first field is
+// a key with the given number of distinct values, as a number or a string.
+// The other fields are random letters.  The data depends only on the
+// arguments.
+func syntheticRecords(rows, width, distinct int, numeric bool) [][]string {
+	r := rand.New(rand.NewPCG(uint64(rows), uint64(width*distinct)))
+	records := make([][]string, rows)
+	for i := range records {
+		record := make([]string, width)
+		key := r.IntN(distinct)
+		if numeric {
+			record[0] = strconv.FormatFloat(float64(key)/10, 'f', -1, 64)
+		} else {
+			record[0] = fmt.Sprintf("key%x", key*2654435761%(1<<32))
+		}
+		for j := 1; j < width; j++ {
+			b := make([]byte, 8)
+			for k := range b {
+				b[k] = byte('a' + r.IntN(26))
+			}
+			record[j] = string(b)
+		}
+		records[i] = record
+	}
+	return records
+}
+
+// benchSorts times each sort strategy on each synthetic data set, reporting
+// the mean over iterations as CSV on standard out.
+func benchSorts(rows, iterations int) {
+	report := csv.NewWriter(os.Stdout)
+	report.Write([]string{"width", "distinct", "key", "strategy", "rows", "wall_seconds", "rows_per_sec"})
+	for _, width := range []int{2, 10, 50} {
+		for _, distinct := range []int{10, 1000, rows} {
+			for _, numeric := range []bool{false, true} {
+				data := syntheticRecords(rows, width, distinct, numeric)
+				key, flag := "string", byte('s')
+				if numeric {
+					key, flag = "number", 'n'
+				}
+				records := make([][]string, len(data))
+				for _, strategy := range sortStrategies {
+					if strategy.numeric && !numeric {
+						continue
+					}
+					var wall time.Duration
+					for i := 0; i < iterations; i++ {
+						copy(records, data)
+						start := time.Now()
+						strategy.sort(records, flag)
+						wall += time.Since(start)
+					}
+					seconds := wall.Seconds() / float64(iterations)
+					report.Write([]string{
+						strconv.Itoa(width),
+						strconv.Itoa(distinct),
+						key,
+						strategy.name,
+						strconv.Itoa(rows),
+						strconv.FormatFloat(seconds, 'f', 6, 64),
+						strconv.FormatFloat(float64(rows)/seconds, 'f', 0, 64),
+					})
+					report.Flush()
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/laslowh/cursive/common"
+	"os"
+	"strconv"
+	"time"
+)
+
+var (
+	fInputSeparator        = flag.String("is", ",", "input separator")
+	fInputTabSeparator     = flag.Bool("its", false, "input separator is the tab character (overrides -is)")
+	fInputComment          = flag.String("ic", "", "input beginning of line comment character")
+	fInputTrimLeadingSpace = flag.Bool("it", false, "input trim leading space")
+	fInputURL              = flag.String("input-url", "", "input URL to read with an HTTP GET instead of a file")
+	fInputURLHeaders       common.StringList
+	fInputURLTimeout       = flag.Duration("timeout", 30*time.Second, "input time to wait for a response from an input URL (0 is no limit)")
+	fInputURLRetries       = flag.Int("retries", 3, "input number of times to retry an input URL after a transient failure")
+
+	fOutputFile      = flag.String("o", "", "output file; defaults to stdout")
+	fAppendOutput    = flag.Bool("append", false, "append to the output file instead of replacing it, without repeating the header")
+	fOutputURL       = flag.String("output-url", "", "output URL to which the output is sent with an HTTP request instead of a file")
+	fOutputURLMethod = flag.String("output-url-method", "POST", "output HTTP method used with -output-url: POST or PUT")
+	fOutputURLHeader common.StringList
+	fOutputSeparator = flag.String("os", "", "output separator, which may be more than one character; defaults to input separator")
+	fOutputTabSep    = flag.Bool("ots", false, "output separator is the tab character (overrides -os)")
+	fOutputCRLF      = flag.Bool("oc", false, "output using CRLF as line ending")
+	fOutputNewline   = flag.String("newline", "lf", "output line ending: lf, crlf or cr")
+
+	fIgnoreBeginning = flag.Int("bi", 0, "number of lines to ignore at beginning of file")
+	fIgnoreEnd       = flag.Int("ei", 0, "number of lines to ignore at end of file")
+	fNoHeader        = flag.Bool("h", false, "no header row, the first row defines the expected number of fields")
+	fZeroBased       = flag.Bool("z", false, "when displaying line numbers, use zero-based numbering")
+	fLogFile         = flag.String("log-file", "", "append error and warning messages to this file instead of writing them to standard error")
+)
+
+func init() {
+	flag.Var(&fInputURLHeaders, "input-url-header", "input HTTP header as Key:Value sent with -input-url; may be repeated")
+	flag.BoolVar(fInputTabSeparator, "input-tsv", false, "alias for -its")
+	flag.BoolVar(fOutputTabSep, "output-tsv", false, "alias for -ots")
+	flag.Var(&fOutputURLHeader, "output-url-header", "output HTTP header as Key:Value sent with -output-url; may be repeated")
+}
+
+var usage = func() {
+	fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [options] [ <input> ]\n", os.Args[0])
+	flag.PrintDefaults()
+	fmt.Fprintf(flag.CommandLine.Output(), DESCRIPTION)
+	os.Exit(2)
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+	if err := common.SetLogFile(*fLogFile); err != nil {
+		fmt.Fprintf(os.Stderr, "%v: error opening log file\n", err)
+		os.Exit(2)
+	}
+	defer common.CloseLogFile()
+	if *fInputTabSeparator {
+		*fInputSeparator = "\t"
+	}
+	if *fOutputTabSep {
+		*fOutputSeparator = "\t"
+	}
+	if *fOutputSeparator == "" {
+		*fOutputSeparator = *fInputSeparator
+	}
+
+	expected := -1
+	failed := false
+	var proc common.CSVProcessor
+	procFunc := func(record []string, buffer []string, isHeader bool, lineNo int) ([][]string, error) {
+		if isHeader {
+			expected = len(record)
+			return [][]string{{"line", "expected", "found"}}, nil
+		}
+		if len(record) == expected {
+			return nil, nil
+		}
+		failed = true
+		line := proc.RecordLine()
+		if *fZeroBased {
+			line--
+		}
+		return [][]string{{strconv.Itoa(line), strconv.Itoa(expected), strconv.Itoa(len(record))}}, nil
+	}
+
+	proc = common.CSVProcessor{
+		InputSeparator:        *fInputSeparator,
+		InputTabSeparator:     *fInputTabSeparator,
+		InputComment:          *fInputComment,
+		InputFieldsPerLine:    -1,
+		InputLazyQuotes:       true,
+		InputTrimLeadingSpace: *fInputTrimLeadingSpace,
+		InputURL:              *fInputURL,
+		InputURLHeaders:       fInputURLHeaders,
+		InputURLTimeout:       *fInputURLTimeout,
+		InputURLRetries:       *fInputURLRetries,
+
+		OutputFile:      *fOutputFile,
+		AppendOutput:    *fAppendOutput,
+		OutputURL:       *fOutputURL,
+		OutputURLMethod: *fOutputURLMethod,
+		OutputURLHeader: fOutputURLHeader,
+		OutputSeparator: *fOutputSeparator,
+		OutputCRLF:      *fOutputCRLF,
+		OutputNewline:   *fOutputNewline,
+
+		IgnoreBeginning: *fIgnoreBeginning,
+		IgnoreEnd:       *fIgnoreEnd,
+		NoHeader:        *fNoHeader,
+		ZeroBased:       *fZeroBased,
+		RecordLines:     true,
+	}
+
+	err := proc.OpenIO(flag.Args())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v: error opening file\n", err)
+		os.Exit(2)
+	}
+
+	err = proc.Process(procFunc, false)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(2)
+	}
+	err = proc.Close()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(2)
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+const DESCRIPTION = `
+csvcheck - check that every row of a CSV file has the same number of fields
+
+csvcheck is part of the Cursive toolkit.  Cursive is a set of utilities for
+reading and writing "separated value" formats like CSV and TSV.
+
+csvcheck reads the whole input and compares the number of fields in each row
+with the number of fields in the header row.  Unlike the "-in" flag of the
+other tools, it does not stop at the first offending row.  Instead it outputs
+a CSV report with one row per offending row, giving the line of the input on
+which it starts, the expected number of fields and the number actually found.
+Every line is counted, including the header, those skipped with "-bi" and
+those inside quoted fields, so the number is the one a text editor shows.  Quotes are parsed
+lazily so that stray quote characters do not abort the check.
+
+If the "-h" flag is given, the first row is treated as data, but still defines
+the expected number of fields.
+
+INPUT AND OUTPUT
+
+If <input> is not specified on the command line, csvcheck will read from
+standard in.   If no "-o" flag is provided, csvcheck will write to standard
+out.
+
+With "-log-file", error and warning messages are appended to the given file
+instead of being written to standard error.
+
+<input> may also be an "http://" or "https://" URL, which is fetched with an
+HTTP GET.  A URL ending in ".gz" is decompressed.
+
+EXIT STATUS
+
+csvcheck exits with status 0 if every row has the expected number of fields, 1
+if any row does not, and 2 if an error occurred.
+
+`
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/laslowh/cursive/common"
+	"hash/crc32"
+	"os"
+	"strconv"
+	"strings"
+)
+
+var (
+	fInputSeparator        = flag.String("is", ",", "input separator")
+	fInputTabSeparator     = flag.Bool("its", false, "input separator is the tab character (overrides -is)")
+	fInputComment          = flag.String("ic", "", "input beginning of line comment character")
+	fInputFieldsPerLine    = common.FieldsPerLine(-1)
+	fInputLazyQuotes       = flag.Bool("iq", false, "input allow 'lazy' quotes")
+	fInputTrimLeadingSpace = flag.Bool("it", false, "input trim leading space")
+
+	fOutputFile      = flag.String("o", "", "output file; defaults to stdout")
+	fAppendOutput    = flag.Bool("append", false, "append to the output file instead of replacing it, without repeating the header")
+	fOutputSeparator = flag.String("os", "", "output separator, which may be more than one character; defaults to input separator")
+	fOutputTabSep    = flag.Bool("ots", false, "output separator is the tab character (overrides -os)")
+	fOutputCRLF      = flag.Bool("oc", false, "output using CRLF as line ending")
+	fOutputNewline   = flag.String("newline", "lf", "output line ending: lf, crlf or cr")
+
+	fIgnoreBeginning = flag.Int("bi", 0, "number of lines to ignore at beginning of file")
+	fIgnoreEnd       = flag.Int("ei", 0, "number of lines to ignore at end of file")
+	fNoHeader        = flag.Bool("h", false, "no header row, will create default headers")
+	fZeroBased       = flag.Bool("z", false, "when displaying line numbers, use zero-based numbering")
+	fAdd             = flag.Bool("add", false, "append a checksum column to every row")
+	fVerify          = flag.Bool("verify", false, "check the checksum in the last column of every row, reporting the rows that do not match")
+	fLogFile         = flag.String("log-file", "", "append error and warning messages to this file instead of writing them to standard error")
+)
+
+func init() {
+	flag.Var(&fInputFieldsPerLine, "in", "input expected number of fields per line (-1 is any, strict is the number in the first line)")
+	flag.BoolVar(fInputTabSeparator, "input-tsv", false, "alias for -its")
+	flag.BoolVar(fOutputTabSep, "output-tsv", false, "alias for -ots")
+}
+
+var usage = func() {
+	fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [options] [ <input> ]\n", os.Args[0])
+	flag.PrintDefaults()
+	fmt.Fprintf(flag.CommandLine.Output(), DESCRIPTION)
+	os.Exit(2)
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+	if err := common.SetLogFile(*fLogFile); err != nil {
+		fmt.Fprintf(os.Stderr, "%v: error opening log file\n", err)
+		os.Exit(2)
+	}
+	defer common.CloseLogFile()
+	if *fInputTabSeparator {
+		*fInputSeparator = "\t"
+	}
+	if *fOutputTabSep {
+		*fOutputSeparator = "\t"
+	}
+	if *fOutputSeparator == "" {
+		*fOutputSeparator = *fInputSeparator
+	}
+	if *fAdd == *fVerify {
+		usage()
+	}
+
+	failed := false
+	procFunc := func(record []string, buffer []string, isHeader bool, lineNo int) ([][]string, error) {
+		if *fAdd {
+			if isHeader {
+				return [][]string{append(record, "checksum")}, nil
+			}
+			return [][]string{append(record, checksum(record))}, nil
+		}
+		if isHeader {
+			return [][]string{{"line", "stored", "computed"}}, nil
+		}
+		fields, stored := record[:len(record)-1], record[len(record)-1]
+		computed := checksum(fields)
+		if strings.EqualFold(strings.TrimSpace(stored), computed) {
+			return nil, nil
+		}
+		failed = true
+		return [][]string{{strconv.Itoa(lineNo), stored, computed}}, nil
+	}
+
+	proc := common.CSVProcessor{
+		InputSeparator:        *fInputSeparator,
+		InputTabSeparator:     *fInputTabSeparator,
+		InputComment:          *fInputComment,
+		InputFieldsPerLine:    int(fInputFieldsPerLine),
+		InputLazyQuotes:       *fInputLazyQuotes,
+		InputTrimLeadingSpace: *fInputTrimLeadingSpace,
+
+		OutputFile:      *fOutputFile,
+		AppendOutput:    *fAppendOutput,
+		OutputSeparator: *fOutputSeparator,
+		OutputCRLF:      *fOutputCRLF,
+		OutputNewline:   *fOutputNewline,
+
+		IgnoreBeginning: *fIgnoreBeginning,
+		IgnoreEnd:       *fIgnoreEnd,
+		NoHeader:        *fNoHeader,
+		ZeroBased:       *fZeroBased,
+	}
+
+	err := proc.OpenIO(flag.Args())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v: error opening file\n", err)
+		os.Exit(2)
+	}
+
+	err = proc.Process(procFunc, false)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(2)
+	}
+	err = proc.Close()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(2)
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// checksum returns the CRC-32 of fields, joined by NUL bytes, as eight
+// lower case hexadecimal digits.  Joining by a byte that CSV text does not
+// hold keeps "a","bc" from having the checksum of "ab","c", and makes the
+// checksum independent of the separator and quoting of the file.
+func checksum(fields []string) string {
+	return fmt.Sprintf("%08x", crc32.ChecksumIEEE([]byte(strings.Join(fields, "\x00"))))
+}
+
+const DESCRIPTION = `
+csvchecksum - add or verify a checksum column in a CSV file
+
+csvchecksum is part of the Cursive toolkit.  Cursive is a set of utilities for
+reading and writing "separated value" formats like CSV and TSV.
+
+csvchecksum guards the rows of a file against corruption, such as in transfer
+between systems.  It runs in one of two modes, of which exactly one must be
+given.
+
+With "-add", a "checksum" column is appended to every row, holding the CRC-32
+of the row's values as eight hexadecimal digits.  The values are joined by
+NUL bytes before hashing, so the checksum does not depend on the separator or
+quoting of the file, and the file can be converted between CSV and TSV
+without changing its checksums.
+
+With "-verify", the last column of every row is taken to be its checksum,
+which is compared with the checksum of the other values.  The output is a CSV
+report with one row for each row that does not match, giving its line number,
+the stored checksum and the computed one.  Case and surrounding space in the
+stored checksum are ignored.  For example:
+
+  csvchecksum -add data.csv > sent.csv
+  csvchecksum -verify received.csv
+
+The header row is passed through by "-add", with "checksum" appended, and
+ignored by "-verify".
+
+INPUT AND OUTPUT
+
+If <input> is not specified on the command line, csvchecksum will read from
+standard in.   If no "-o" flag is provided, csvchecksum will write to standard
+out.
+
+With "-log-file", error and warning messages are appended to the given file
+instead of being written to standard error.
+
+EXIT STATUS
+
+csvchecksum exits with status 0 on success, 1 if "-verify" finds a row whose
+checksum does not match, and 2 if an error occurred.
+
+`
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/laslowh/cursive/common"
+	"os"
+	"strings"
+)
+
+var (
+	fInputSeparator        = flag.String("is", ",", "input separator")
+	fInputTabSeparator     = flag.Bool("its", false, "input separator is the tab character (overrides -is)")
+	fInputComment          = flag.String("ic", "", "input beginning of line comment character")
+	fInputFieldsPerLine    = common.FieldsPerLine(-1)
+	fInputLazyQuotes       = flag.Bool("iq", false, "input allow 'lazy' quotes")
+	fInputTrimLeadingSpace = flag.Bool("it", false, "input trim leading space")
+
+	fOutputFile      = flag.String("o", "", "output file; defaults to stdout")
+	fAppendOutput    = flag.Bool("append", false, "append to the output file instead of replacing it, without repeating the header")
+	fOutputSeparator = flag.String("os", "", "output separator, which may be more than one character; defaults to input separator")
+	fOutputTabSep    = flag.Bool("ots", false, "output separator is the tab character (overrides -os)")
+	fOutputCRLF      = flag.Bool("oc", false, "output using CRLF as line ending")
+	fOutputNewline   = flag.String("newline", "lf", "output line ending: lf, crlf or cr")
+
+	fIgnoreBeginning = flag.Int("bi", 0, "number of lines to ignore at beginning of file")
+	fIgnoreEnd       = flag.Int("ei", 0, "number of lines to ignore at end of file")
+	fNoHeader        = flag.Bool("h", false, "no header row, will create default headers")
+	fColumns         = flag.String("c", "", "a comma-separated list of column indices or ranges to merge, in order")
+	fInto            = flag.String("into", "coalesced", "header of the new column")
+	fJoin            = flag.Bool("join", false, "join the non-empty values with -sep instead of taking the first of them")
+	fSep             = flag.String("sep", " ", "separator placed between the values joined with -join")
+	fDrop            = flag.Bool("drop", false, "remove the merged columns")
+	fLogFile         = flag.String("log-file", "", "append error and warning messages to this file instead of writing them to standard error")
+)
+
+func init() {
+	flag.Var(&fInputFieldsPerLine, "in", "input expected number of fields per line (-1 is any, strict is the number in the first line)")
+	flag.BoolVar(fInputTabSeparator, "input-tsv", false, "alias for -its")
+	flag.BoolVar(fOutputTabSep, "output-tsv", false, "alias for -ots")
+}
+
+var usage = func() {
+	fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [options] [ <input> ]\n", os.Args[0])
+	flag.PrintDefaults()
+	fmt.Fprintf(flag.CommandLine.Output(), DESCRIPTION)
+	os.Exit(1)
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+	if err := common.SetLogFile(*fLogFile); err != nil {
+		fmt.Fprintf(os.Stderr, "%v: error opening log file\n", err)
+		os.Exit(1)
+	}
+	defer common.CloseLogFile()
+	if *fInputTabSeparator {
+		*fInputSeparator = "\t"
+	}
+	if *fOutputTabSep {
+		*fOutputSeparator = "\t"
+	}
+	if *fOutputSeparator == "" {
+		*fOutputSeparator = *fInputSeparator
+	}
+	ranges, err := common.ParseFieldRanges(*fColumns)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v: error parsing columns\n", err)
+		os.Exit(1)
+	}
+	indices := common.FieldIndices(ranges)
+	if len(indices) == 0 {
+		usage()
+	}
+
+	procFunc := func(record []string, buffer []string, isHeader bool, lineNo int) ([][]string, error) {
+		value := *fInto
+		if !isHeader {
+			value = coalesce(indices, record)
+		}
+		if *fDrop {
+			record = common.RemoveFields(record, indices)
+		}
+		output := append(buffer, record...)
+		return [][]string{append(output, value)}, nil
+	}
+
+	proc := common.CSVProcessor{
+		InputSeparator:        *fInputSeparator,
+		InputTabSeparator:     *fInputTabSeparator,
+		InputComment:          *fInputComment,
+		InputFieldsPerLine:    int(fInputFieldsPerLine),
+		InputLazyQuotes:       *fInputLazyQuotes,
+		InputTrimLeadingSpace: *fInputTrimLeadingSpace,
+
+		OutputFile:      *fOutputFile,
+		AppendOutput:    *fAppendOutput,
+		OutputSeparator: *fOutputSeparator,
+		OutputCRLF:      *fOutputCRLF,
+		OutputNewline:   *fOutputNewline,
+
+		IgnoreBeginning: *fIgnoreBeginning,
+		IgnoreEnd:       *fIgnoreEnd,
+		NoHeader:        *fNoHeader,
+	}
+
+	err = proc.OpenIO(flag.Args())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v: error opening file\n", err)
+		os.Exit(1)
+	}
+
+	err = proc.Process(procFunc, false)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+	err = proc.Close()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+}
+
+// coalesce returns the first non-empty field of record at indices, or with
+// -join all of them joined with -sep.  Fields that are missing from the
+// record or only white space are empty.
+func coalesce(indices []int, record []string) string {
+	var values []string
+	for _, i := range indices {
+		if i >= len(record) || strings.TrimSpace(record[i]) == "" {
+			continue
+		}
+		if !*fJoin {
+			return record[i]
+		}
+		values = append(values, record[i])
+	}
+	return strings.Join(values, *fSep)
+}
+
+const DESCRIPTION = `
+csvcoalesce - merge several CSV columns into one
+
+csvcoalesce is part of the Cursive toolkit.  Cursive is a set of utilities for
+reading and writing "separated value" formats like CSV and TSV.
+
+csvcoalesce adds a column to the end of each row holding the first non-empty
+value among the columns given with "-c", in the order they are given, or an
+empty value if all of them are empty.  Columns are given by number starting at
+1, as a comma-separated list of indices or ranges such as "2-4".  A value that
+is only white space counts as empty.  The new column is headed by "-into",
+"coalesced" unless given.  For example:
+
+  csvcoalesce -c=3,2 -into=phone input.csv
+
+With "-join", the new column holds instead every non-empty value, in order,
+separated by "-sep", a space unless given.  For example, to make a full name
+from first, middle and last names where the middle name may be empty:
+
+  csvcoalesce -c=2-4 -into=fullname -join input.csv
+
+With "-drop", the merged columns are removed, leaving only the new one.
+
+INPUT AND OUTPUT
+
+If <input> is not specified on the command line, csvcoalesce will read from
+standard in.   If no "-o" flag is provided, csvcoalesce will write to standard
+out.
+
+With "-log-file", error and warning messages are appended to the given file
+instead of being written to standard error.
+
+`
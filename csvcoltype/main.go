@@ -0,0 +1,255 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/laslowh/cursive/common"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	fInputSeparator        = flag.String("is", ",", "input separator")
+	fInputTabSeparator     = flag.Bool("its", false, "input separator is the tab character (overrides -is)")
+	fInputComment          = flag.String("ic", "", "input beginning of line comment character")
+	fInputFieldsPerLine    = common.FieldsPerLine(-1)
+	fInputLazyQuotes       = flag.Bool("iq", false, "input allow 'lazy' quotes")
+	fInputTrimLeadingSpace = flag.Bool("it", false, "input trim leading space")
+
+	fOutputFile      = flag.String("o", "", "output file; defaults to stdout")
+	fAppendOutput    = flag.Bool("append", false, "append to the output file instead of replacing it, without repeating the header")
+	fOutputSeparator = flag.String("os", "", "output separator, which may be more than one character; defaults to input separator")
+	fOutputTabSep    = flag.Bool("ots", false, "output separator is the tab character (overrides -os)")
+	fOutputCRLF      = flag.Bool("oc", false, "output using CRLF as line ending")
+	fOutputNewline   = flag.String("newline", "lf", "output line ending: lf, crlf or cr")
+
+	fIgnoreBeginning = flag.Int("bi", 0, "number of lines to ignore at beginning of file")
+	fIgnoreEnd       = flag.Int("ei", 0, "number of lines to ignore at end of file")
+	fNoHeader        = flag.Bool("h", false, "no header row, will create default headers")
+	fZeroBased       = flag.Bool("z", false, "when displaying column numbers, use zero-based numbering")
+	fSample          = flag.Int("sample", 100, "number of non-empty values per column used to guess its type")
+	fLogFile         = flag.String("log-file", "", "append error and warning messages to this file instead of writing them to standard error")
+)
+
+// columnTypes lists the types in the order they are tried; each type is
+// checked against values by the corresponding function in typeCheckers.
+var columnTypes = []string{"integer", "float", "boolean", "date", "datetime", "text"}
+
+var typeCheckers = map[string]func(string) bool{
+	"integer": func(v string) bool {
+		_, err := strconv.ParseInt(v, 10, 64)
+		return err == nil
+	},
+	"float": func(v string) bool {
+		_, err := strconv.ParseFloat(v, 64)
+		return err == nil
+	},
+	"boolean": func(v string) bool {
+		switch strings.ToLower(v) {
+		case "true", "false", "yes", "no":
+			return true
+		}
+		return false
+	},
+	"date": func(v string) bool {
+		return parsesAs(v, dateLayouts...)
+	},
+	// A datetime column may also hold plain dates, so that a column of both
+	// is widened to "datetime" rather than to "text".
+	"datetime": func(v string) bool {
+		return parsesAs(v, datetimeLayouts...) || parsesAs(v, dateLayouts...)
+	},
+	"text": func(v string) bool {
+		return true
+	},
+}
+
+var dateLayouts = []string{"2006-01-02", "2006/01/02", "01/02/2006"}
+
+var datetimeLayouts = []string{time.RFC3339, "2006-01-02 15:04:05", "2006-01-02T15:04:05"}
+
+// widerTypes gives, for each type, the type to try next when a value does
+// not match it.
+var widerTypes = map[string]string{
+	"integer":  "float",
+	"float":    "text",
+	"boolean":  "text",
+	"date":     "datetime",
+	"datetime": "text",
+}
+
+func init() {
+	flag.Var(&fInputFieldsPerLine, "in", "input expected number of fields per line (-1 is any, strict is the number in the first line)")
+	flag.BoolVar(fInputTabSeparator, "input-tsv", false, "alias for -its")
+	flag.BoolVar(fOutputTabSep, "output-tsv", false, "alias for -ots")
+}
+
+var usage = func() {
+	fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [options] [ <input> ]\n", os.Args[0])
+	flag.PrintDefaults()
+	fmt.Fprintf(flag.CommandLine.Output(), DESCRIPTION)
+	os.Exit(1)
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+	if err := common.SetLogFile(*fLogFile); err != nil {
+		fmt.Fprintf(os.Stderr, "%v: error opening log file\n", err)
+		os.Exit(1)
+	}
+	defer common.CloseLogFile()
+	if *fInputTabSeparator {
+		*fInputSeparator = "\t"
+	}
+	if *fOutputTabSep {
+		*fOutputSeparator = "\t"
+	}
+	if *fOutputSeparator == "" {
+		*fOutputSeparator = *fInputSeparator
+	}
+
+	proc := common.CSVProcessor{
+		InputSeparator:        *fInputSeparator,
+		InputTabSeparator:     *fInputTabSeparator,
+		InputComment:          *fInputComment,
+		InputFieldsPerLine:    int(fInputFieldsPerLine),
+		InputLazyQuotes:       *fInputLazyQuotes,
+		InputTrimLeadingSpace: *fInputTrimLeadingSpace,
+
+		OutputFile:      *fOutputFile,
+		AppendOutput:    *fAppendOutput,
+		OutputSeparator: *fOutputSeparator,
+		OutputCRLF:      *fOutputCRLF,
+		OutputNewline:   *fOutputNewline,
+
+		IgnoreBeginning: *fIgnoreBeginning,
+		IgnoreEnd:       *fIgnoreEnd,
+		NoHeader:        *fNoHeader,
+	}
+
+	err := proc.OpenIO(flag.Args())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v: error opening file\n", err)
+		os.Exit(1)
+	}
+
+	err = proc.Summarize(analyze)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+	err = proc.Close()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+}
+
+func analyze(header []string, records [][]string) ([][]string, error) {
+	offset := 1
+	if *fZeroBased {
+		offset = 0
+	}
+	output := [][]string{{"column_index", "column_name", "type", "null_pct", "unique_count"}}
+	for i, name := range header {
+		values := make([]string, 0, len(records))
+		nulls := 0
+		unique := make(map[string]struct{})
+		for _, record := range records {
+			v := ""
+			if i < len(record) {
+				v = strings.TrimSpace(record[i])
+			}
+			if v == "" {
+				nulls++
+				continue
+			}
+			values = append(values, v)
+			unique[v] = struct{}{}
+		}
+		nullPct := 0.0
+		if len(records) > 0 {
+			nullPct = 100 * float64(nulls) / float64(len(records))
+		}
+		output = append(output, []string{
+			strconv.Itoa(i + offset),
+			name,
+			validate(guess(values, *fSample), values),
+			strconv.FormatFloat(nullPct, 'f', 1, 64),
+			strconv.Itoa(len(unique)),
+		})
+	}
+	return output, nil
+}
+
+// guess returns the first type that matches each of the first n values.
+func guess(values []string, n int) string {
+	if n < len(values) {
+		values = values[:n]
+	}
+	for _, t := range columnTypes {
+		if matchesAll(t, values) {
+			return t
+		}
+	}
+	return "text"
+}
+
+// validate checks the guessed type t against every value, widening it until
+// all of them match.
+func validate(t string, values []string) string {
+	for !matchesAll(t, values) {
+		t = widerTypes[t]
+	}
+	return t
+}
+
+func matchesAll(t string, values []string) bool {
+	check := typeCheckers[t]
+	for _, v := range values {
+		if !check(v) {
+			return false
+		}
+	}
+	return true
+}
+
+func parsesAs(v string, layouts ...string) bool {
+	for _, layout := range layouts {
+		if _, err := time.Parse(layout, v); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+const DESCRIPTION = `
+csvcoltype - report the data type of each column of a CSV file
+
+csvcoltype is part of the Cursive toolkit.  Cursive is a set of utilities for
+reading and writing "separated value" formats like CSV and TSV.
+
+csvcoltype outputs, as CSV, one row per input column giving its index, its
+name, its type, the percentage of empty values and the number of distinct
+non-empty values.  The type is one of "integer", "float", "boolean", "date",
+"datetime" or "text".
+
+The type is found in two passes.  First, a guess is made from a sample of the
+non-empty values in the column (the first 100 by default, see "-sample").
+Then every value is checked against the guess, and if any does not match, the
+type is widened (for example from "integer" to "float", or from "date" to
+"datetime") until all values match.
+
+INPUT AND OUTPUT
+
+If <input> is not specified on the command line, csvcoltype will read from
+standard in.   If no "-o" flag is provided, csvcoltype will write to standard
+out.
+
+With "-log-file", error and warning messages are appended to the given file
+instead of being written to standard error.
+
+`
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/laslowh/cursive/common"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	fInputSeparator        = flag.String("is", ",", "input separator")
+	fInputTabSeparator     = flag.Bool("its", false, "input separator is the tab character (overrides -is)")
+	fInputComment          = flag.String("ic", "", "input beginning of line comment character")
+	fInputFieldsPerLine    = common.FieldsPerLine(-1)
+	fInputLazyQuotes       = flag.Bool("iq", false, "input allow 'lazy' quotes")
+	fInputTrimLeadingSpace = flag.Bool("it", false, "input trim leading space")
+	fInputURL              = flag.String("input-url", "", "input URL to read with an HTTP GET instead of a file")
+	fInputURLHeaders       common.StringList
+	fInputURLTimeout       = flag.Duration("timeout", 30*time.Second, "input time to wait for a response from an input URL (0 is no limit)")
+	fInputURLRetries       = flag.Int("retries", 3, "input number of times to retry an input URL after a transient failure")
+
+	fOutputFile      = flag.String("o", "", "output file; defaults to stdout")
+	fAppendOutput    = flag.Bool("append", false, "append to the output file instead of replacing it, without repeating the header")
+	fOutputURL       = flag.String("output-url", "", "output URL to which the output is sent with an HTTP request instead of a file")
+	fOutputURLMethod = flag.String("output-url-method", "POST", "output HTTP method used with -output-url: POST or PUT")
+	fOutputURLHeader common.StringList
+	fOutputSeparator = flag.String("os", "", "output separator, which may be more than one character; defaults to input separator")
+	fOutputTabSep    = flag.Bool("ots", false, "output separator is the tab character (overrides -os)")
+	fOutputCRLF      = flag.Bool("oc", false, "output using CRLF as line ending")
+	fOutputNewline   = flag.String("newline", "lf", "output line ending: lf, crlf or cr")
+
+	fIgnoreBeginning = flag.Int("bi", 0, "number of lines to ignore at beginning of file")
+	fIgnoreEnd       = flag.Int("ei", 0, "number of lines to ignore at end of file")
+	fNoHeader        = flag.Bool("h", false, "no header row, will create default headers")
+	fLogFile         = flag.String("log-file", "", "append error and warning messages to this file instead of writing them to standard error")
+)
+
+// numericThreshold is the fraction of values in a column that must parse as
+// numbers for the column to be included in the matrix.
+const numericThreshold = 0.8
+
+func init() {
+	flag.Var(&fInputFieldsPerLine, "in", "input expected number of fields per line (-1 is any, strict is the number in the first line)")
+	flag.BoolVar(fInputTabSeparator, "input-tsv", false, "alias for -its")
+	flag.BoolVar(fOutputTabSep, "output-tsv", false, "alias for -ots")
+	flag.Var(&fInputURLHeaders, "input-url-header", "input HTTP header as Key:Value sent with -input-url; may be repeated")
+	flag.Var(&fOutputURLHeader, "output-url-header", "output HTTP header as Key:Value sent with -output-url; may be repeated")
+}
+
+var usage = func() {
+	fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [options] [ <input> ]\n", os.Args[0])
+	flag.PrintDefaults()
+	fmt.Fprintf(flag.CommandLine.Output(), DESCRIPTION)
+	os.Exit(1)
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+	if err := common.SetLogFile(*fLogFile); err != nil {
+		fmt.Fprintf(os.Stderr, "%v: error opening log file\n", err)
+		os.Exit(1)
+	}
+	defer common.CloseLogFile()
+	if *fInputTabSeparator {
+		*fInputSeparator = "\t"
+	}
+	if *fOutputTabSep {
+		*fOutputSeparator = "\t"
+	}
+	if *fOutputSeparator == "" {
+		*fOutputSeparator = *fInputSeparator
+	}
+
+	proc := common.CSVProcessor{
+		InputSeparator:        *fInputSeparator,
+		InputTabSeparator:     *fInputTabSeparator,
+		InputComment:          *fInputComment,
+		InputFieldsPerLine:    int(fInputFieldsPerLine),
+		InputLazyQuotes:       *fInputLazyQuotes,
+		InputTrimLeadingSpace: *fInputTrimLeadingSpace,
+		InputURL:              *fInputURL,
+		InputURLHeaders:       fInputURLHeaders,
+		InputURLTimeout:       *fInputURLTimeout,
+		InputURLRetries:       *fInputURLRetries,
+
+		OutputFile:      *fOutputFile,
+		AppendOutput:    *fAppendOutput,
+		OutputURL:       *fOutputURL,
+		OutputURLMethod: *fOutputURLMethod,
+		OutputURLHeader: fOutputURLHeader,
+		OutputSeparator: *fOutputSeparator,
+		OutputCRLF:      *fOutputCRLF,
+		OutputNewline:   *fOutputNewline,
+
+		IgnoreBeginning: *fIgnoreBeginning,
+		IgnoreEnd:       *fIgnoreEnd,
+		NoHeader:        *fNoHeader,
+	}
+
+	err := proc.OpenIO(flag.Args())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v: error opening file\n", err)
+		os.Exit(1)
+	}
+
+	err = proc.Summarize(correlate)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+	err = proc.Close()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+}
+
+// correlate computes the Pearson correlation coefficient between every pair
+// of numeric columns and returns it as a square matrix.
+func correlate(header []string, records [][]string) ([][]string, error) {
+	values := make([][]float64, len(header))
+	valid := make([][]bool, len(header))
+	var columns []int
+	for i := range header {
+		values[i] = make([]float64, len(records))
+		valid[i] = make([]bool, len(records))
+		n := 0
+		for j, record := range records {
+			if i >= len(record) {
+				continue
+			}
+			f, err := strconv.ParseFloat(strings.TrimSpace(record[i]), 64)
+			if err != nil {
+				continue
+			}
+			values[i][j] = f
+			valid[i][j] = true
+			n++
+		}
+		if len(records) > 0 && float64(n) >= numericThreshold*float64(len(records)) {
+			columns = append(columns, i)
+		}
+	}
+
+	output := make([][]string, 0, len(columns)+1)
+	row := make([]string, 0, len(columns)+1)
+	row = append(row, "")
+	for _, c := range columns {
+		row = append(row, header[c])
+	}
+	output = append(output, row)
+	for _, c1 := range columns {
+		row := make([]string, 0, len(columns)+1)
+		row = append(row, header[c1])
+		for _, c2 := range columns {
+			r := pearson(values[c1], valid[c1], values[c2], valid[c2])
+			row = append(row, strconv.FormatFloat(r, 'f', 6, 64))
+		}
+		output = append(output, row)
+	}
+	return output, nil
+}
+
+// pearson returns the correlation coefficient of x and y, using only the
+// positions where both values are valid.
+func pearson(x []float64, xValid []bool, y []float64, yValid []bool) float64 {
+	var n, sx, sy, sxx, syy, sxy float64
+	for i := range x {
+		if !xValid[i] || !yValid[i] {
+			continue
+		}
+		n++
+		sx += x[i]
+		sy += y[i]
+		sxx += x[i] * x[i]
+		syy += y[i] * y[i]
+		sxy += x[i] * y[i]
+	}
+	d := math.Sqrt((n*sxx - sx*sx) * (n*syy - sy*sy))
+	if d == 0 {
+		return math.NaN()
+	}
+	return (n*sxy - sx*sy) / d
+}
+
+const DESCRIPTION = `
+csvcorr - compute the correlation matrix of the numeric columns of a CSV file
+
+csvcorr is part of the Cursive toolkit.  Cursive is a set of utilities for
+reading and writing "separated value" formats like CSV and TSV.
+
+csvcorr finds every column in which at least 80 percent of the values can be parsed
+as numbers, and computes the Pearson correlation coefficient between each pair
+of these columns.  The result is written as a square CSV matrix, with the
+column names as both the first row and the first column.  For each pair of
+columns, rows where either value is not a number are skipped.  Pairs for which
+no correlation can be computed are reported as "NaN".
+
+INPUT AND OUTPUT
+
+If <input> is not specified on the command line, csvcorr will read from
+standard in.   If no "-o" flag is provided, csvcorr will write to standard
+out.
+
+With "-log-file", error and warning messages are appended to the given file
+instead of being written to standard error.
+
+<input> may also be an "http://" or "https://" URL, which is fetched with an
+HTTP GET.  A URL ending in ".gz" is decompressed.
+
+`
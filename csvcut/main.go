@@ -1,90 +1,513 @@
 package main
 
 import (
+	"encoding/csv"
 	"flag"
 	"fmt"
 	"github.com/laslowh/cursive/common"
 	"io"
 	"math"
 	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+	"unicode/utf8"
 )
 
 var (
 	fInputSeparator        = flag.String("is", ",", "input separator")
 	fInputTabSeparator     = flag.Bool("its", false, "input separator is the tab character (overrides -is)")
+	fInputHeadSeparator    = flag.String("head-sep", "", "input separator of the header row, when it differs from that of the data rows")
+	fInputInferSeparator   = flag.Bool("infer-delimiter", false, "input separator is chosen from comma, tab, semicolon and bar as the one splitting the first lines most consistently")
 	fInputComment          = flag.String("ic", "", "input beginning of line comment character")
-	fInputFieldsPerLine    = flag.Int("in", -1, "input expected number of fields per line (-1 is any)")
+	fInputFieldsPerLine    = common.FieldsPerLine(-1)
 	fInputLazyQuotes       = flag.Bool("iq", false, "input allow 'lazy' quotes")
+	fInputQuoteChar        = flag.String("iqc", "", "input quote character, instead of the double quote")
+	fInputTrimBOM          = flag.Bool("trim-bom", false, "input drop a byte order mark from the start of the input and of every line, as in files concatenated together")
 	fInputTrimLeadingSpace = flag.Bool("it", false, "input trim leading space")
+	fInputTrailingComma    = flag.Bool("il", false, "input allow a trailing comma (always allowed; accepted for compatibility)")
+	fInputURL              = flag.String("input-url", "", "input URL to read with an HTTP GET instead of a file")
+	fInputURLHeaders       common.StringList
+	fInputURLTimeout       = flag.Duration("timeout", 30*time.Second, "input time to wait for a response from an input URL (0 is no limit)")
+	fInputURLRetries       = flag.Int("retries", 3, "input number of times to retry an input URL after a transient failure")
+	fInputJSONPath         = flag.String("input-json-path", "", "input is JSON, and this JSONPath, such as $.records[*], selects the objects that are rows")
+	fInputMultiline        = flag.String("input-multiline", "", "input join each line with unbalanced quotes to the next with this string, such as \\n or a space, repairing broken fields")
+	fInputValidUTF8        = flag.Bool("valid-utf8", false, "input fail at the first field that is not valid UTF-8, giving its line and column")
+	fInputRelaxed          = flag.Bool("input-relaxed", false, "input skip records with parse errors, reporting them on stderr")
 
 	fOutputFile      = flag.String("o", "", "output file; defaults to stdout")
-	fOutputSeparator = flag.String("os", "", "output separator; defaults to input separator")
+	fAppendOutput    = flag.Bool("append", false, "append to the output file instead of replacing it, without repeating the header")
+	fAtomicOutput    = flag.Bool("atomic", false, "write the output file under a temporary name, renaming it over the -o file only once it is complete")
+	fOutputURL       = flag.String("output-url", "", "output URL to which the output is sent with an HTTP request instead of a file")
+	fOutputURLMethod = flag.String("output-url-method", "POST", "output HTTP method used with -output-url: POST or PUT")
+	fOutputURLHeader common.StringList
+	fOutputSeparator = flag.String("os", "", "output separator, which may be more than one character; defaults to input separator")
+	fOutputQuoteChar = flag.String("oqc", "", "output quote character, instead of the double quote")
+	fOutputTabSep    = flag.Bool("ots", false, "output separator is the tab character (overrides -os)")
 	fOutputCRLF      = flag.Bool("oc", false, "output using CRLF as line ending")
+	fOutputNewline   = flag.String("newline", "lf", "output line ending: lf, crlf or cr")
+	fOutputWidth     = flag.Int("field-width", 0, "output pad or truncate every field to this many characters (0 is unlimited)")
+	fOutputPadChar   = flag.String("pad-char", " ", "output character used to pad fields with -field-width")
+	fOutputJSONLines = flag.Bool("jl", false, "output each row as a JSON object on its own line, keyed by the header")
+	fOutputJSONArray = flag.Bool("jp", false, "output all rows as a single JSON array of objects keyed by the header, indented for reading")
+	fOutputJSONTypes = flag.Bool("jt", false, "with -jl or -jp, output numbers and true/false as JSON numbers and booleans instead of strings")
+	fOutputExcel     = flag.Bool("excel", false, "output for Excel, starting with a UTF-8 byte order mark and using CRLF as line ending")
+	fOutputSafe      = flag.Bool("safe", false, "output fields beginning with =, +, - or @ prefixed with -safe-escape, so spreadsheets do not run them as formulas")
+	fOutputSafeEsc   = flag.String("safe-escape", "'", "prefix written before fields that look like formulas with -safe")
+	fOutputTemplate  = flag.String("output-template", "", "a Go text/template with which each row is output instead of as CSV")
 
 	fIgnoreBeginning = flag.Int("bi", 0, "number of lines to ignore at beginning of file")
 	fIgnoreEnd       = flag.Int("ei", 0, "number of lines to ignore at end of file")
+	fEndPattern      = flag.String("etp", "", "a regular expression; input ends at the first line after the header that matches it, which is dropped with all that follow")
 	fNoHeader        = flag.Bool("h", false, "no header row, will create default headers")
+	fDetectHeader    = flag.Bool("ha", false, "guess whether the input has a header row from its first two rows, unless -h is given")
+	fMaxRows         = flag.Int("max", 0, "output at most this many data rows, then stop (0 is unlimited)")
+	fEvery           = flag.Int("every", 0, "output only every Nth data row, those whose line number modulo N is -every-phase (0 is all rows)")
+	fEveryPhase      = flag.Int("every-phase", 0, "line number modulo -every of the data rows that are output")
+	fNormalizeHeader = flag.Bool("hn", false, "normalize the output header to lower case names made of letters, digits and underscores")
 	fLineNumbers     = flag.Bool("l", false, "insert a column of line numbers at the front of the output")
+	fLineNumberStart = flag.Int("number-rows-start", 0, "number of the first row with -l (default 1, or 0 with -z)")
+	fLineNumberStep  = flag.Int("number-rows-step", 1, "increment between the numbers of consecutive rows with -l")
+	fLineNumberFmt   = flag.String("number-rows-fmt", "%d", "printf format of the numbers inserted with -l, such as %05d")
+	fByteOffsets     = flag.Bool("byte-offset", false, "insert _byte_start and _byte_end columns giving the byte offsets of each row in the input")
 	fZeroBased       = flag.Bool("z", false, "when interpreting or displaying column numbers, use zero-based numbering")
 	fNames           = flag.Bool("n", false, "display column names and indices from the input and exit")
+	fNamesMachine    = flag.Bool("nm", false, "with -n, display the column count, then the indices and names as CSV using the output separator")
 	fColumns         = flag.String("c", "", "a comma-separated list of column indices or ranges to be extracted; default is all columns")
 	fDeleteEmpty     = flag.Bool("d", false, "after cutting, delete rows which are completely empty")
+	fLenient         = flag.Bool("lenient", false, "output an empty value for selected columns that a row is too short to have, instead of failing")
+	fPadTo           = flag.Int("pad-to", 0, "pad rows with fewer fields than this with empty fields, before any other processing (0 is off)")
+	fTruncateTo      = flag.Int("truncate-to", 0, "drop the fields of rows beyond this many, before any other processing (0 is off)")
+	fExplode         = flag.Int("explode", 0, "split the values of this column on -explode-sep, outputting a row for each value (0 is off)")
+	fExplodeSep      = flag.String("explode-sep", ";", "separator between the values of the -explode column")
+	fImplode         = flag.Int("implode", 0, "merge consecutive output rows that differ only in this column, joining its values with -implode-sep (0 is off)")
+	fImplodeSep      = flag.String("implode-sep", ";", "separator used to join the values of the -implode column")
+	fTransforms      common.StringList
+	fCases           common.StringList
+	fTrims           common.StringList
+	fTrimAll         = flag.Bool("trim-all", false, "trim leading and trailing white space from every field")
+	fUnquote         = flag.String("sq", "", "a comma-separated list of column indices or ranges from whose values a pair of surrounding quotes is removed")
+	fUnquoteAll      = flag.Bool("sq-all", false, "remove a pair of surrounding quotes from the values of every field")
+	fFills           common.StringList
+	fFillAll         = flag.String("col-fill-all", "", "replace every empty field of every data row with this value")
+	fSwaps           common.StringList
+	fAdds            common.StringList
+	fAddAts          common.StringList
+	fRenames         common.StringList
+	fJoin            = flag.String("join", "", "a comma-separated list of column indices or ranges whose values are joined into a new column")
+	fJoinChar        = flag.String("join-char", " ", "separator placed between the values joined with -join")
+	fJoinAs          = flag.String("join-as", "", "header of the column created by -join; defaults to the joined headers")
+	fJoinAt          = flag.Int("join-at", 0, "position of the column created by -join, starting at 1; default is after the last column")
+	fSplitCol        = flag.Int("split-col", 0, "split the values of this column on -split-sep into new columns named by -split-names (0 is off)")
+	fSplitSep        = flag.String("split-sep", ":", "separator on which the -split-col column is split")
+	fSplitNames      = flag.String("split-names", "", "a comma-separated list of names of the columns created by -split-col")
+	fSplitReplace    = flag.Bool("split-replace", false, "remove the column split with -split-col")
+	fJoinDrop        = flag.Bool("join-drop-sources", false, "remove the columns joined with -join")
+	fColumnsFile     = flag.String("cf", "", "a file of column indices or ranges to be extracted, one per line or comma-separated; added to -c")
+	fColumnsRegex    = flag.String("cre", "", "a regular expression; columns whose header matches are extracted after those given by -c")
+	fAllowEmpty      = flag.Bool("allow-empty", false, "do not fail when -cre matches no columns")
+	fWhere           = flag.String("where", "", "an expression; only rows for which it is true are output")
+	fLogFile         = flag.String("log-file", "", "append error and warning messages to this file instead of writing them to standard error")
 )
 
+func init() {
+	flag.Var(&fInputFieldsPerLine, "in", "input expected number of fields per line (-1 is any, strict is the number in the first line)")
+	flag.BoolVar(fInputTabSeparator, "input-tsv", false, "alias for -its")
+	flag.BoolVar(fOutputTabSep, "output-tsv", false, "alias for -ots")
+	flag.BoolVar(fLineNumbers, "number-rows", false, "alias for -l")
+	flag.Var(&fInputURLHeaders, "input-url-header", "input HTTP header as Key:Value sent with -input-url; may be repeated")
+	flag.Var(&fOutputURLHeader, "output-url-header", "output HTTP header as Key:Value sent with -output-url; may be repeated")
+	flag.Var(&fFills, "col-fill", "replace empty fields with a value as ranges:value, such as 3:0 or 4:N/A; may be repeated")
+	flag.Var(&fSwaps, "swap", "swap two output columns given as N,M, such as 2,5; may be repeated, and swaps are applied in order")
+	flag.Var(&fAdds, "add", "add a column with the same value in every row as name:value, such as source:2024.csv; may be repeated")
+	flag.Var(&fAddAts, "at", "position of the column added by the matching -add, starting at 1; may be repeated, the first -at going with the first -add and so on; default is after the last column")
+	flag.Var(&fRenames, "col-rename-regex", "rename the header columns matching a regular expression as regexp:replacement, such as ^Q(\\d+)$:Question_$1; may be repeated")
+	flag.Var(&fTrims, "trim", "trim white space from fields as ranges:mode, where mode is all, left, right or quotes; may be repeated")
+	flag.Var(&fCases, "case", "change the case of fields as case:ranges, where case is upper, lower or title; may be repeated")
+	flag.Var(&fTransforms, "transform", "transform field N as N:name, where name is one of base64encode, base64decode, urlencode, urldecode, md5, sha256, upper, lower or title; may be repeated")
+}
+
 var usage = func() {
-	fmt.Fprintf(os.Stderr, "usage: %s [options] [ <input> ]\n", os.Args[0])
+	fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [options] [ <input> ]\n", os.Args[0])
 	flag.PrintDefaults()
-	fmt.Fprintf(os.Stderr, DESCRIPTION)
+	fmt.Fprintf(flag.CommandLine.Output(), DESCRIPTION)
 	os.Exit(1)
 }
 
 func main() {
 	flag.Usage = usage
 	flag.Parse()
+	if err := common.SetLogFile(*fLogFile); err != nil {
+		fmt.Fprintf(os.Stderr, "%v: error opening log file\n", err)
+		os.Exit(1)
+	}
+	defer common.CloseLogFile()
 	if *fInputTabSeparator {
 		*fInputSeparator = "\t"
 	}
-	if *fOutputSeparator == "" {
+	if *fOutputTabSep {
+		*fOutputSeparator = "\t"
+	}
+	if *fInputInferSeparator && (common.FlagSet("is") || *fInputTabSeparator || *fInputJSONPath != "") {
+		fmt.Fprintf(os.Stderr, "-infer-delimiter cannot be combined with -is, -its or -input-json-path\n")
+		os.Exit(1)
+	}
+	if *fOutputSeparator == "" && !*fInputInferSeparator {
 		*fOutputSeparator = *fInputSeparator
 	}
+	if !*fOutputSafe {
+		*fOutputSafeEsc = ""
+	}
+	if utf8.RuneCountInString(*fInputQuoteChar) > 1 || utf8.RuneCountInString(*fOutputQuoteChar) > 1 {
+		fmt.Fprintf(os.Stderr, "-iqc and -oqc must be a single character\n")
+		os.Exit(1)
+	}
+	if *fInputMultiline != "" {
+		var err error
+		*fInputMultiline, err = common.ParseEscapes(*fInputMultiline)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v: error parsing -input-multiline\n", err)
+			os.Exit(1)
+		}
+	}
+	var outputTemplate *template.Template
+	if *fOutputTemplate != "" {
+		var err error
+		outputTemplate, err = common.ParseOutputTemplate(*fOutputTemplate)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v: error parsing output template\n", err)
+			os.Exit(1)
+		}
+	}
+	var ignoreEndPattern *regexp.Regexp
+	if *fEndPattern != "" {
+		var err error
+		ignoreEndPattern, err = regexp.Compile(*fEndPattern)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v: error parsing end pattern\n", err)
+			os.Exit(1)
+		}
+	}
 	fieldRanges, err := common.ParseFieldRanges(*fColumns)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "%v: error parsing columns\n", err)
 		os.Exit(1)
 	}
+	if *fColumnsFile != "" {
+		fileRanges, err := common.ReadFieldRangesFile(*fColumnsFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v: error reading columns file\n", err)
+			os.Exit(1)
+		}
+		fieldRanges = append(fieldRanges, fileRanges...)
+	}
+
+	transforms, err := common.ParseFieldTransforms(fTransforms)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v: error parsing transforms\n", err)
+		os.Exit(1)
+	}
+	for _, spec := range fCases {
+		cases, err := common.ParseCaseTransforms(spec)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v: error parsing case\n", err)
+			os.Exit(1)
+		}
+		transforms = append(transforms, cases...)
+	}
+
+	var trims []*common.FieldTrim
+	for _, spec := range fTrims {
+		t, err := common.ParseFieldTrim(spec)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v: error parsing trim\n", err)
+			os.Exit(1)
+		}
+		trims = append(trims, t)
+	}
+	if *fTrimAll {
+		trims = append(trims, &common.FieldTrim{Mode: "all"})
+	}
+	if *fUnquote != "" {
+		t, err := common.ParseFieldTrim(*fUnquote + ":quotes")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v: error parsing -sq\n", err)
+			os.Exit(1)
+		}
+		trims = append(trims, t)
+	}
+	if *fUnquoteAll {
+		trims = append(trims, &common.FieldTrim{Mode: "quotes"})
+	}
+
+	var fills []*common.FieldFill
+	for _, spec := range fFills {
+		f, err := common.ParseFieldFill(spec)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v: error parsing fill\n", err)
+			os.Exit(1)
+		}
+		fills = append(fills, f)
+	}
+	if *fFillAll != "" {
+		fills = append(fills, &common.FieldFill{Value: *fFillAll})
+	}
+
+	var renames []*common.HeaderRename
+	for _, spec := range fRenames {
+		r, err := common.ParseHeaderRename(spec)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v: error parsing rename\n", err)
+			os.Exit(1)
+		}
+		renames = append(renames, r)
+	}
+
+	var swaps [][2]int
+	for _, spec := range fSwaps {
+		swap, err := parseSwap(spec)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v: error parsing swap\n", err)
+			os.Exit(1)
+		}
+		swaps = append(swaps, swap)
+	}
+
+	if len(fAddAts) > len(fAdds) {
+		fmt.Fprintf(os.Stderr, "-at given %d times for %d -add columns\n", len(fAddAts), len(fAdds))
+		os.Exit(1)
+	}
+	var adds []addedField
+	for i, spec := range fAdds {
+		at := ""
+		if i < len(fAddAts) {
+			at = fAddAts[i]
+		}
+		add, err := parseAdd(spec, at)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v: error parsing add\n", err)
+			os.Exit(1)
+		}
+		adds = append(adds, add)
+	}
+
+	joinRanges, err := common.ParseFieldRanges(*fJoin)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v: error parsing join columns\n", err)
+		os.Exit(1)
+	}
+	joinIndices := common.FieldIndices(joinRanges)
 
-	procFunc := func(record []string, buffer []string, isHeader bool, lineNo int) ([]string, error) {
-		return processRecord(fieldRanges, record, buffer, isHeader, lineNo)
+	var splitNames []string
+	if *fSplitCol > 0 {
+		if *fSplitNames == "" {
+			fmt.Fprintf(os.Stderr, "-split-col requires -split-names\n")
+			os.Exit(1)
+		}
+		splitNames = strings.Split(*fSplitNames, ",")
+	}
+
+	var where *common.Expr
+	if *fWhere != "" {
+		where, err = common.ParseExpr(*fWhere)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v: error parsing where expression\n", err)
+			os.Exit(1)
+		}
+	}
+
+	var columnsRegex *regexp.Regexp
+	if *fColumnsRegex != "" {
+		columnsRegex, err = regexp.Compile(*fColumnsRegex)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v: error parsing column regular expression\n", err)
+			os.Exit(1)
+		}
+	}
+
+	if *fEvery < 0 || (*fEvery > 0 && (*fEveryPhase < 0 || *fEveryPhase >= *fEvery)) {
+		fmt.Fprintf(os.Stderr, "%d: -every-phase must be at least 0 and less than -every\n", *fEveryPhase)
+		os.Exit(1)
+	}
+	if *fByteOffsets && (*fInputJSONPath != "" || *fInputMultiline != "" || *fInputHeadSeparator != "" || *fInputQuoteChar != "" || *fInputTrimBOM) {
+		fmt.Fprintf(os.Stderr, "-byte-offset cannot be combined with -input-json-path, -input-multiline, -head-sep, -iqc or -trim-bom\n")
+		os.Exit(1)
+	}
+
+	procFunc := func(record []string, buffer []string, isHeader bool, lineNo int) ([][]string, error) {
+		if where != nil {
+			if isHeader {
+				if err := where.Bind(record); err != nil {
+					return nil, err
+				}
+			} else if !where.Eval(record).Truth() {
+				return nil, nil
+			}
+		}
+		if isHeader && columnsRegex != nil {
+			matched := common.MatchFieldRanges(record, columnsRegex)
+			if len(matched) == 0 && !*fAllowEmpty {
+				return nil, fmt.Errorf("%s: no column names match", *fColumnsRegex)
+			}
+			fieldRanges = append(fieldRanges, matched...)
+		}
+		if columnsRegex != nil && len(fieldRanges) == 0 {
+			return [][]string{buffer}, nil
+		}
+		if !isHeader {
+			record, err = common.ApplyTransforms(transforms, record)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if len(joinIndices) > 0 {
+			record, err = joinFields(joinIndices, record, isHeader)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if *fSplitCol > 0 {
+			record, err = splitField(*fSplitCol-1, splitNames, record, isHeader)
+			if err != nil {
+				return nil, err
+			}
+		}
+		var outputs [][]string
+		if *fExplode > 0 && !isHeader {
+			outputs, err = explodeRecord(*fExplode-1, *fExplodeSep, fieldRanges, record, buffer, isHeader, lineNo)
+		} else {
+			var output []string
+			output, err = processRecord(fieldRanges, record, buffer, isHeader, lineNo)
+			outputs = [][]string{output}
+		}
+		if err != nil {
+			return nil, err
+		}
+		for i, output := range outputs {
+			if err := swapFields(swaps, output[len(buffer):]); err != nil {
+				return nil, err
+			}
+			if len(adds) > 0 {
+				fields, err := addFields(adds, output[len(buffer):], isHeader)
+				if err != nil {
+					return nil, err
+				}
+				outputs[i] = append(output[:len(buffer):len(buffer)], fields...)
+			}
+		}
+		return outputs, nil
 	}
 	if *fNames {
 		if *fNoHeader {
 			fmt.Fprintf(os.Stderr, "-n and -h are incompatible")
 			os.Exit(1)
 		}
-		procFunc = func(record []string, buffer []string, isHeader bool, line int) ([]string, error) {
-			printNames(os.Stdout, record)
+		if *fNamesMachine && utf8.RuneCountInString(*fOutputSeparator) != 1 {
+			fmt.Fprintf(os.Stderr, "%s: -nm requires a single character output separator\n", *fOutputSeparator)
+			os.Exit(1)
+		}
+		base := 1
+		if *fZeroBased {
+			base = 0
+		}
+		procFunc = func(record []string, buffer []string, isHeader bool, line int) ([][]string, error) {
+			if *fNamesMachine {
+				sep, _ := utf8.DecodeRuneInString(*fOutputSeparator)
+				if err := printNamesCSV(os.Stdout, record, sep, base); err != nil {
+					return nil, err
+				}
+			} else {
+				printNames(os.Stdout, record, base)
+			}
 			os.Exit(0)
 			return nil, nil
 		}
 	}
 
+	var lineNumberStart *int
+	if common.FlagSet("number-rows-start") {
+		lineNumberStart = fLineNumberStart
+	}
 	proc := common.CSVProcessor{
 		InputSeparator:        *fInputSeparator,
+		InputInferSeparator:   *fInputInferSeparator,
 		InputTabSeparator:     *fInputTabSeparator,
 		InputComment:          *fInputComment,
-		InputFieldsPerLine:    *fInputFieldsPerLine,
+		InputFieldsPerLine:    int(fInputFieldsPerLine),
 		InputLazyQuotes:       *fInputLazyQuotes,
 		InputTrimLeadingSpace: *fInputTrimLeadingSpace,
+		InputTrailingComma:    *fInputTrailingComma,
+		InputURL:              *fInputURL,
+		InputURLHeaders:       fInputURLHeaders,
+		InputURLTimeout:       *fInputURLTimeout,
+		InputURLRetries:       *fInputURLRetries,
+		InputJSONPath:         *fInputJSONPath,
+		InputMultiline:        *fInputMultiline,
 
 		OutputFile:      *fOutputFile,
+		AppendOutput:    *fAppendOutput,
+		AtomicOutput:    *fAtomicOutput,
+		OutputURL:       *fOutputURL,
+		OutputURLMethod: *fOutputURLMethod,
+		OutputURLHeader: fOutputURLHeader,
 		OutputSeparator: *fOutputSeparator,
-		OutputCRLF:      *fOutputCRLF,
+		OutputCRLF:      *fOutputCRLF || *fOutputExcel,
+		OutputNewline:   *fOutputNewline,
+		OutputWidth:     *fOutputWidth,
+		OutputPadChar:   *fOutputPadChar,
+		OutputJSONLines: *fOutputJSONLines,
+		OutputJSONArray: *fOutputJSONArray,
+		OutputJSONTypes: *fOutputJSONTypes,
+		OutputBOM:       *fOutputExcel,
+
+		OutputFormulaEscape: *fOutputSafeEsc,
+		OutputTemplate:      outputTemplate,
+		IgnoreEndPattern:    ignoreEndPattern,
+		DetectHeader:        *fDetectHeader && !common.FlagSet("h"),
+		ValidUTF8:           *fInputValidUTF8,
+		HeadSeparator:       *fInputHeadSeparator,
+		InputQuote:          *fInputQuoteChar,
+		InputTrimBOM:        *fInputTrimBOM,
+		OutputQuote:         *fOutputQuoteChar,
 
+		Trims:           trims,
+		Fills:           fills,
+		HeaderRenames:   renames,
 		IgnoreBeginning: *fIgnoreBeginning,
 		IgnoreEnd:       *fIgnoreEnd,
 		NoHeader:        *fNoHeader,
+		MaxRows:         *fMaxRows,
+		Every:           *fEvery,
+		EveryPhase:      *fEveryPhase,
+		NormalizeHeader: *fNormalizeHeader,
+		RelaxedMode:     *fInputRelaxed,
 		LineNumbers:     *fLineNumbers,
 		ZeroBased:       *fZeroBased,
+
+		LineNumberStart:  lineNumberStart,
+		LineNumberStep:   *fLineNumberStep,
+		LineNumberFormat: *fLineNumberFmt,
+
+		PadToFields:      *fPadTo,
+		TruncateToFields: *fTruncateTo,
+
+		ImplodeColumn:    *fImplode,
+		ImplodeSeparator: *fImplodeSep,
+		ByteOffsets:      *fByteOffsets,
+	}
+	if *fByteOffsets {
+		cut := procFunc
+		procFunc = func(record []string, buffer []string, isHeader bool, lineNo int) ([][]string, error) {
+			if isHeader {
+				buffer = append(buffer, "_byte_start", "_byte_end")
+			} else {
+				start, end := proc.RecordOffsets()
+				buffer = append(buffer, strconv.FormatInt(start, 10), strconv.FormatInt(end, 10))
+			}
+			return cut(record, buffer, isHeader, lineNo)
+		}
 	}
 
 	err = proc.OpenIO(flag.Args())
@@ -94,6 +517,12 @@ func main() {
 	}
 
 	err = proc.Process(procFunc, *fDeleteEmpty)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		proc.Abort()
+		os.Exit(1)
+	}
+	err = proc.Close()
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "%v\n", err)
 		os.Exit(1)
@@ -106,29 +535,195 @@ func processRecord(fieldRanges []*common.FieldRange, record []string, buffer []s
 	}
 
 	for _, r := range fieldRanges {
-		if r.Start < 0 || r.Start >= len(record) {
+		if r.Start < 0 || (!*fLenient && (r.Start >= len(record) || r.End >= len(record))) {
 			return nil, fmt.Errorf("%d: no such field in record of length %d", r.Start, len(record))
 		}
 		if r.End < 0 {
-			buffer = append(buffer, record[r.Start])
+			buffer = append(buffer, fieldOrEmpty(record, r.Start))
 		} else {
 			for i := r.Start; i <= r.End; i++ {
-				buffer = append(buffer, record[i])
+				buffer = append(buffer, fieldOrEmpty(record, i))
 			}
 		}
 	}
 	return buffer, nil
 }
 
-func printNames(output io.Writer, ns []string) {
+// fieldOrEmpty returns field i of record, or an empty string if record is
+// too short to have it, which is only allowed with -lenient.
+func fieldOrEmpty(record []string, i int) string {
+	if i >= len(record) {
+		return ""
+	}
+	return record[i]
+}
+
+// parseSwap parses the two column numbers of a swap given as "N,M".
+func parseSwap(spec string) ([2]int, error) {
+	var swap [2]int
+	columns := strings.Split(spec, ",")
+	if len(columns) != 2 {
+		return swap, fmt.Errorf("%s: swap must be given as two column numbers, N,M", spec)
+	}
+	for i, column := range columns {
+		n, err := strconv.Atoi(strings.TrimSpace(column))
+		if err != nil {
+			return swap, err
+		}
+		if n < 1 {
+			return swap, fmt.Errorf("%d: column numbers start at 1", n)
+		}
+		swap[i] = n - 1
+	}
+	return swap, nil
+}
+
+// swapFields exchanges, in place, the two fields of record given by each
+// of swaps in turn.
+func swapFields(swaps [][2]int, record []string) error {
+	for _, swap := range swaps {
+		i, j := swap[0], swap[1]
+		if i >= len(record) || j >= len(record) {
+			return fmt.Errorf("%d,%d: no such fields to swap in record of length %d", i+1, j+1, len(record))
+		}
+		record[i], record[j] = record[j], record[i]
+	}
+	return nil
+}
+
+// addedField is a column added with -add.  at is its position, starting at
+// 1, or 0 to add it after the last column.
+type addedField struct {
+	name, value string
+	at          int
+}
+
+// parseAdd parses a column added as "name:value", at the position at given
+// with -at, or after the last column if at is empty.  The name is everything
+// before the first colon, so the value may contain colons.
+func parseAdd(spec, at string) (addedField, error) {
+	i := strings.Index(spec, ":")
+	if i < 0 {
+		return addedField{}, fmt.Errorf("%s: add must be given as name:value", spec)
+	}
+	add := addedField{name: spec[:i], value: spec[i+1:]}
+	if at == "" {
+		return add, nil
+	}
+	n, err := strconv.Atoi(at)
+	if err != nil {
+		return addedField{}, err
+	}
+	if n < 1 {
+		return addedField{}, fmt.Errorf("%d: positions start at 1", n)
+	}
+	add.at = n
+	return add, nil
+}
+
+// addFields returns a copy of record with the added fields inserted one after
+// another, each at its position in the record as the ones before it left it.
+// The header gets their names and other records their values.
+func addFields(adds []addedField, record []string, isHeader bool) ([]string, error) {
+	for _, add := range adds {
+		if add.at > len(record)+1 {
+			return nil, fmt.Errorf("%d: position beyond the end of record of length %d", add.at, len(record))
+		}
+		value := add.value
+		if isHeader {
+			value = add.name
+		}
+		record = common.InsertFields(record, add.at-1, value)
+	}
+	return record, nil
+}
+
+// joinFields adds a field holding the values of the fields at indices joined
+// together, optionally removing those fields.
+func joinFields(indices []int, record []string, isHeader bool) ([]string, error) {
+	values := make([]string, 0, len(indices))
+	for _, i := range indices {
+		if i >= len(record) {
+			return nil, fmt.Errorf("%d: no such field in record of length %d", i+1, len(record))
+		}
+		values = append(values, record[i])
+	}
+	joined := strings.Join(values, *fJoinChar)
+	if isHeader && *fJoinAs != "" {
+		joined = *fJoinAs
+	}
+	if *fJoinDrop {
+		record = common.RemoveFields(record, indices)
+	}
+	return common.InsertFields(record, *fJoinAt-1, joined), nil
+}
+
+// splitField splits the given field of record into one new field for each of
+// names, inserted after it or in its place.  Missing values are left empty,
+// and the last new field holds any values beyond the number of names.
+func splitField(field int, names []string, record []string, isHeader bool) ([]string, error) {
+	if field >= len(record) {
+		return nil, fmt.Errorf("%d: no such field in record of length %d", field+1, len(record))
+	}
+	values := names
+	if !isHeader {
+		values = make([]string, len(names))
+		copy(values, strings.SplitN(record[field], *fSplitSep, len(names)))
+	}
+	if *fSplitReplace {
+		record = common.RemoveFields(record, []int{field})
+		return common.InsertFields(record, field, values...), nil
+	}
+	return common.InsertFields(record, field+1, values...), nil
+}
+
+// explodeRecord splits the given field of record on sep, and cuts a copy of
+// the record for each of the resulting values.
+func explodeRecord(field int, sep string, fieldRanges []*common.FieldRange, record []string, buffer []string, isHeader bool, line int) ([][]string, error) {
+	if field >= len(record) {
+		return nil, fmt.Errorf("%d: no such field in record of length %d", field+1, len(record))
+	}
+	values := strings.Split(record[field], sep)
+	outputs := make([][]string, 0, len(values))
+	exploded := make([]string, len(record))
+	for _, v := range values {
+		copy(exploded, record)
+		exploded[field] = v
+		output, err := processRecord(fieldRanges, exploded, append([]string(nil), buffer...), isHeader, line)
+		if err != nil {
+			return nil, err
+		}
+		outputs = append(outputs, output)
+	}
+	return outputs, nil
+}
+
+// printNames writes the index and name of each column, aligned for reading,
+// numbering the columns from base.
+func printNames(output io.Writer, ns []string, base int) {
 	n := len(ns)
 	nchars := int(math.Ceil(math.Log10(float64(n+1)))) + 1
 	format := fmt.Sprintf("%% %dd: %%s\n", nchars)
 	for i, n := range ns {
-		fmt.Fprintf(output, format, i+1, n)
+		fmt.Fprintf(output, format, i+base, n)
 	}
 }
 
+// printNamesCSV writes a comment line giving the number of columns, then the
+// index and name of each column as CSV with a header row, for use by scripts.
+// Columns are numbered from base.
+func printNamesCSV(output io.Writer, ns []string, sep rune, base int) error {
+	fmt.Fprintf(output, "# %d columns\n", len(ns))
+	w := csv.NewWriter(output)
+	w.Comma = sep
+	w.Write([]string{"index", "name"})
+	for i, n := range ns {
+		w.Write([]string{strconv.Itoa(i + base), n})
+	}
+	w.Flush()
+	return w.Error()
+}
+
 const DESCRIPTION = `
 csvcut - remove sections from each line of CSV files
 
@@ -145,6 +740,173 @@ If <input> is not specified on the command line, csvgrep will read from
 standard in.   If no "-o" flag is provided, csvgrep will write to standard
 out.
 
+With "-log-file", error and warning messages are appended to the given file
+instead of being written to standard error.
+
+<input> may also be an "http://" or "https://" URL, which is fetched with an
+HTTP GET.  A URL ending in ".gz" is decompressed.
+
+With "-append", output is added to the end of the "-o" file instead of
+replacing it, so that the output of several runs can be collected in one
+file.  If the file already has content, the header row is not written again,
+nor is a byte order mark.
+
+With "-atomic", the output is written to a temporary file in the directory of
+the "-o" file, which is synced to disk and renamed over the "-o" file only
+once csvcut has succeeded.  Another program never sees a partly written
+file: it sees either the old file or the new one.  If csvcut fails, the
+temporary file is removed and the "-o" file is left as it was, but if csvcut
+is killed, the temporary file, named after the "-o" file with a leading dot,
+may be left behind.  The rename is atomic on Unix file systems, but not
+always on Windows or network file systems.  It cannot be combined with
+"-append".
+
+The "-etp" flag drops a trailer of any length from the end of the input, such
+as the totals at the foot of a report.  The input ends at the first line after
+the header that matches its regular expression, and that line and all that
+follow are ignored; no more of the input is read.  Each line is matched as its
+fields joined by the input separator, so -etp="^TOTAL," drops everything from
+the first line whose first field is "TOTAL".  It may be combined with "-ei",
+which then ignores that many lines before the trailer.
+
+The "-ha" flag is for files that may or may not have a header row.  It
+guesses from the first two rows: if none of the fields of the first row is a
+number, but at least one field of the second row is, the first row is taken
+to be the header.  Otherwise, as when there is only one row, a header is
+created as with "-h".  Files whose columns are all text cannot be told apart
+this way, and are taken to have no header.  Giving "-h", or "-h=false", decides
+explicitly and overrides "-ha".
+
+The "-input-multiline" flag repairs input from exporters that break a field
+across lines without quoting it properly.  A line with an odd number of
+quotes is taken to continue on the next line, and the two are joined with the
+given string in place of the line ending, until the quotes balance.  The
+string may use escapes such as \n.  This is a guess, and a stray quote will
+join lines that should be separate, so a warning is given when any lines are
+joined.
+
+The "-valid-utf8" flag checks that every field of the input is valid UTF-8,
+and fails with the line and column of the first invalid sequence rather than
+passing it on to the output, where it would show as garbled text.
+
+The "-infer-delimiter" flag chooses the input separator from the input itself,
+for files whose separator is not known in advance.  Each of the comma, tab,
+semicolon and bar is tried on the first 20 lines, after any ignored with
+"-bi", and the one splitting them most consistently into the same number of
+fields is chosen, preferring more fields when two are equally consistent.
+Separators within quoted fields are not counted.  The output uses the same
+separator unless "-os" or "-ots" is given.
+
+The "-head-sep" flag is for input whose header row uses a different separator
+from its data rows, such as a comma-separated header over tab-separated data.
+The header row is read with the "-head-sep" separator, and the rest with the
+input separator, as in -head-sep=, -its.
+
+The "-iqc" and "-oqc" flags give a quote character other than the double
+quote for the input and output, such as -iqc="'" for fields quoted with
+single quotes.  Within a quoted field, the quote character is written twice
+to stand for itself, and a double quote is an ordinary character.
+
+The "-trim-bom" flag drops the UTF-8 byte order mark that some programs,
+notably Excel, write at the start of a file, and which would otherwise be
+read as part of the first field.  It is dropped from the start of every line,
+so that a mark is also dropped from the start of each file when several are
+concatenated, as in "cat a.csv b.csv | csvcut -trim-bom".  The output only
+begins with a mark with "-excel".
+
+The "-in" flag checks that every line of the input has the given number of
+fields.  With -in=strict, that number is taken from the first line, usually
+the header, and a line with a different number fails with its line number and
+both counts.  With "-input-relaxed" as well, such lines are skipped and
+reported on standard error instead.
+
+With "-input-json-path", the input is a JSON document instead of CSV.  The
+flag gives a JSONPath selecting the objects that are the input rows, using
+".name", ".*", "[N]", "[*]" and "['name']" after a leading "$".  A selected
+array of objects gives a row for each element.  The header row holds every
+member name, in the order they are first seen.  For example, for input of the
+form {"meta":{...},"records":[{...},{...}]}:
+
+  -input-json-path='$.records[*]'
+
+The "-max" flag stops once that many data rows have been output, not counting
+the header, which is useful for previews.  It applies after rows are selected
+with "-where", so the output has that many rows if enough rows match.
+
+The "-every" flag samples the input, passing only every Nth data row to the
+rest of the processing: those whose line number modulo N is "-every-phase",
+which is 0 unless given.  Data rows are numbered from 1, or from 0 with "-z",
+so by default "-every=10" outputs rows 10, 20, 30 and so on, but with "-z" it
+outputs rows 0, 10, 20, starting with the first.  Combined with "-max", it
+gives a bounded preview of a long file.
+
+The "-byte-offset" flag helps find rows in a large file.  It inserts two
+columns at the front of the output, after the line number of "-l",
+"_byte_start" and "_byte_end", giving the byte offsets in the input at which
+each row starts and, just past its line ending, ends, counting from 0 at the
+start of the file.  They may be used with "dd" or "tail -c" to look at the
+row in place.  The offsets are those of the input as it was read, so it cannot
+be combined with flags that rewrite the input, such as "-iqc".
+
+The "-excel" flag writes output that Excel opens correctly: the output begins
+with a UTF-8 byte order mark, and lines end with CRLF.  Excel expects the
+separator of the system's locale, which is often ";", so it may be combined
+with "-os", as in -excel -os=";".
+
+The "-safe" flag guards against formula injection when the output is opened
+in a spreadsheet: every field that begins with "=", "+", "-" or "@" is
+prefixed with a single quote, or with the "-safe-escape" string, so that it is
+not run as a formula.  This changes the data, negative numbers included, so it
+is only done when asked for.
+
+The "-output-template" flag formats each row with a Go text/template instead
+of writing CSV, and the header row is not output.  Fields are available as
+.F0, .F1 and so on, counting from 0, and by their names in the header row, as
+.Name, or as index . "Full Name" for names that are not identifiers.  A line
+ending follows each row.  For example, to write SQL statements:
+
+  -output-template='INSERT INTO t VALUES ("{{.F0}}", {{.Age}});'
+
+The "-trim" flag, which may be repeated, removes white space from the given
+fields of every row, including the header, as soon as it is read.  It is given
+as ranges:mode, where ranges is a list of field ranges as for "-c" and mode is
+"all" to trim both ends, "left" or "right".  For example, -trim=1,3:all.  The
+"-trim-all" flag trims both ends of every field.
+
+The "-sq" flag removes a pair of quotes that are part of the values of the
+given fields rather than CSV quoting, such as '123', or "123" after a space
+when read with "-iq".  If a value begins and ends with the same quote, double
+or single, the two are removed, once; quotes within it are kept.  The
+"-sq-all" flag does this for every field, and -trim=ranges:quotes is the same
+as "-sq".  The quotes are removed after the input is read, so unlike quoting
+in CSV, a quoted value is still split at the separator, and a doubled quote
+within it is not undone.  For fields quoted with another character, use
+"-iqc" instead.  Quotes are removed after white space is trimmed.
+
+The "-col-fill" flag, which may be repeated, fills in missing values: every
+empty field in the given fields of the data rows is replaced with a value.  It
+is given as ranges:value, where ranges is a list of field ranges, so
+-col-fill=3:0 fills field 3 with "0" and -col-fill=4-5:N/A fills fields 4 and
+5 with "N/A".  The "-col-fill-all" flag fills every field.  Fields are filled
+after they are trimmed and before any other processing.
+
+The "-col-rename-regex" flag, which may be repeated, renames every column of
+the header whose name matches a regular expression.  It is given as
+regexp:replacement, and the replacement may refer to submatches as $1, $2 and
+so on, so that -col-rename-regex='^Q(\d+)$:Question_$1' renames Q1, Q2 and
+Q10 to Question_1, Question_2 and Question_10.  The replacement is everything
+after the last colon.  Columns are renamed as the header is read, after it is
+trimmed, so the new names are those that are output.
+
+With "-jl", each row is output as a JSON object on a line of its own, keyed by
+the names in the header row, which is not itself output.  Values are strings
+unless "-jt" is also given, in which case numbers and "true" or "false" are
+output as JSON numbers and booleans.
+
+With "-jp", the rows are output instead as a single JSON array of such
+objects, indented by two spaces for reading.  The array is only written once
+every row has been read.  "-jt" applies to it as to "-jl".
+
 The "-c" flag allows the user to specify a subset of the input fields
 for output, as a comma-separated list of field ranges.  Field ranges can
 be either a single field number, or a start field and end field separated by
@@ -155,4 +917,130 @@ fields and the "tenth" field:
 
 Field numbers start at 1.
 
+It is an error for a row to be too short to have one of the fields given with
+"-c".  With "-lenient", such fields are output as empty values instead, for
+files whose last columns are optional and left out of rows that lack them.
+Every output row then has the same number of fields.
+
+The "-pad-to" flag instead pads every row, the header included, that has
+fewer fields than it is given with empty fields, before anything else is done
+with the row.  So -pad-to=5 gives every row at least five fields for "-c",
+"-join", "-swap" and the rest to work on, and when no columns are selected,
+every row is output with at least five fields.  The "-truncate-to" flag does
+the opposite, silently dropping the fields of every row beyond the number it
+is given, for input whose rows have gained extra fields at the end.  Given
+the same number, the two flags make every row exactly that long.
+
+The "-cf" flag reads further field ranges from a file, one per line or as
+comma-separated lists.  Lines beginning with "#" are comments.  These fields
+are output after any given with "-c".
+
+The "-cre" flag selects every field whose name in the header row matches a
+regular expression, in the order they appear in the input.  These fields are
+output after any given with "-c".  For example, to output the first field and
+all the fields whose names begin with "utm_":
+
+  csvcut -c=1 -cre="^utm_" input.csv
+
+It is an error if the regular expression matches no fields, unless
+"-allow-empty" is given.
+
+The "-n" flag displays the number and name of each field in the header row,
+aligned for reading, and exits.  Fields are numbered from 1, or from 0 with
+"-z".  With "-nm" as well, the output is meant for scripts instead: a comment
+line giving the number of fields, such as "# 5 columns", then a row for each
+field with its number and name, as CSV with the header row "index,name" and
+the output separator.  Another tool may read it with -ic="#".
+
+SELECTING ROWS
+
+The "-where" flag gives an expression, and only the rows for which it is true
+are output.  Fields are referred to by their names in the header row, or as
+col(N), where N is a field number starting at 1; names containing spaces or
+other punctuation may be given as col("name").  Fields are compared as numbers
+if both sides are numbers, and as strings otherwise, so an empty field is
+never greater than a number.  Numbers may be negative, as in "Delta > -5".
+Conditions are combined with "&&" (or "and"), "||" (or "or") and "!" (or
+"not").  For example:
+
+  csvcut -where='Age > 30 && Status == "Active"' input.csv
+
+The functions len(s), lower(s), upper(s), num(s) and substr(s, start, length)
+are also available.  The expression is evaluated against the input row,
+before any transformation.
+
+TRANSFORMS
+
+The "-transform" flag, which may be repeated, passes a field of every row
+through a transformation before it is cut.  It is given as N:name, where N is
+the field number and name is one of "base64encode", "base64decode",
+"urlencode", "urldecode", "md5", "sha256", "upper", "lower" or "title".  For
+example, to replace the second field with its SHA-256 hash:
+
+  csvcut -transform=2:sha256 input.csv
+
+The "-case" flag, which may also be repeated, changes the case of several
+fields at once.  It is given as case:ranges, where case is "upper", "lower" or
+"title" and ranges is a list of field ranges as for "-c".  For example, to
+upper case the first and third fields:
+
+  csvcut -case=upper:1,3 input.csv
+
+JOINING FIELDS
+
+The "-swap" flag exchanges two columns of the output, given by their numbers
+in the output as N,M, in the header and every row.  It may be repeated, and
+the swaps are applied one after another, each to the columns as the one
+before left them.  So -swap=1,2 -swap=2,3 turns columns a,b,c into b,a,c and
+then into b,c,a, while -swap=2,5 -swap=2,5 changes nothing.  Swapping is
+simpler than listing every column with "-c" when only a few are out of place,
+and applies after "-c", so the numbers are those of the columns it selects.
+
+The "-add" flag adds a column with the same value in every row, given as
+name:value, where the value may contain colons but the name may not.  The
+column is added after the last column, or at the position given by the
+matching "-at", shifting those after it right.  Both may be repeated: the
+first "-at" gives the position of the first "-add", the second of the second,
+and so on, and any "-add" beyond the last "-at" goes after the last column.
+The columns are added one after another, each position counting the columns
+as the ones before it left them: so -add=x:1 -add=y:2 -at=2 -at=1 turns
+columns a,b,c into y,a,x,b,c.  Positions count the output columns, after
+"-c" and "-swap", and may be at most one beyond the last of them.  For
+example, to record where rows came from:
+
+  csvcut -add=source:2024.csv -at=1 2024.csv
+
+The "-join" flag creates a new field holding the values of the given fields
+joined together with the "-join-char" separator.  The new field is named with
+"-join-as", and is placed after the last field unless a position is given
+with "-join-at".  With "-join-drop-sources", the joined fields are removed.
+For example, to replace first and last name fields with a full name field:
+
+  csvcut -join=1-2 -join-as=FullName -join-at=1 -join-drop-sources input.csv
+
+The "-split-col" flag does the opposite, splitting a field on the
+"-split-sep" separator into new fields named with "-split-names".  The new
+fields follow the original, or replace it with "-split-replace".  If a value
+has too few parts, the remaining fields are left empty.  For example, to split
+a "host:port" field:
+
+  csvcut -split-col=2 -split-sep=":" -split-names=host,port input.csv
+
+Fields are joined and split before they are cut, so fields given with "-c"
+refer to the fields after joining and splitting.
+
+EXPLODE
+
+Some files store several values in one field, separated by a delimiter.  The
+"-explode" flag outputs a separate row for each of the values in the given
+field, repeating the other fields.  For example, if field 3 holds values
+separated by ";":
+
+  csvcut -explode=3 -explode-sep=";" input.csv
+
+The "-implode" flag does the reverse: consecutive output rows that are equal
+in every field except the given one are merged into a single row, joining the
+values of that field with the "-implode-sep" separator.  The field number
+refers to the output, after any "-c" selection.
+
 `
@@ -0,0 +1,341 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/laslowh/cursive/common"
+	"os"
+	"strings"
+)
+
+var (
+	fInputSeparator        = flag.String("is", ",", "input separator")
+	fInputTabSeparator     = flag.Bool("its", false, "input separator is the tab character (overrides -is)")
+	fInputComment          = flag.String("ic", "", "input beginning of line comment character")
+	fInputFieldsPerLine    = common.FieldsPerLine(-1)
+	fInputLazyQuotes       = flag.Bool("iq", false, "input allow 'lazy' quotes")
+	fInputTrimLeadingSpace = flag.Bool("it", false, "input trim leading space")
+
+	fOutputFile      = flag.String("o", "", "output file; defaults to stdout")
+	fAppendOutput    = flag.Bool("append", false, "append to the output file instead of replacing it, without repeating the header")
+	fOutputSeparator = flag.String("os", "", "output separator, which may be more than one character; defaults to input separator")
+	fOutputTabSep    = flag.Bool("ots", false, "output separator is the tab character (overrides -os)")
+	fOutputCRLF      = flag.Bool("oc", false, "output using CRLF as line ending")
+	fOutputNewline   = flag.String("newline", "lf", "output line ending: lf, crlf or cr")
+
+	fNoHeader = flag.Bool("h", false, "no header row, will create default headers")
+	fKey      = flag.String("k", "", "a comma-separated list of column indices or ranges of the old file that make up the key; default is all columns")
+	fLogFile  = flag.String("log-file", "", "append error and warning messages to this file instead of writing them to standard error")
+)
+
+func init() {
+	flag.Var(&fInputFieldsPerLine, "in", "input expected number of fields per line (-1 is any, strict is the number in the first line)")
+	flag.BoolVar(fInputTabSeparator, "input-tsv", false, "alias for -its")
+	flag.BoolVar(fOutputTabSep, "output-tsv", false, "alias for -ots")
+}
+
+var usage = func() {
+	fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [options] <old> <new>\n", os.Args[0])
+	flag.PrintDefaults()
+	fmt.Fprintf(flag.CommandLine.Output(), DESCRIPTION)
+	os.Exit(2)
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+	if err := common.SetLogFile(*fLogFile); err != nil {
+		fmt.Fprintf(os.Stderr, "%v: error opening log file\n", err)
+		os.Exit(2)
+	}
+	defer common.CloseLogFile()
+	if *fInputTabSeparator {
+		*fInputSeparator = "\t"
+	}
+	if *fOutputTabSep {
+		*fOutputSeparator = "\t"
+	}
+	if *fOutputSeparator == "" {
+		*fOutputSeparator = *fInputSeparator
+	}
+	if flag.NArg() != 2 {
+		usage()
+	}
+	keyRanges, err := common.ParseFieldRanges(*fKey)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v: error parsing key\n", err)
+		os.Exit(2)
+	}
+
+	oldProc := common.CSVProcessor{
+		InputSeparator:        *fInputSeparator,
+		InputTabSeparator:     *fInputTabSeparator,
+		InputComment:          *fInputComment,
+		InputFieldsPerLine:    int(fInputFieldsPerLine),
+		InputLazyQuotes:       *fInputLazyQuotes,
+		InputTrimLeadingSpace: *fInputTrimLeadingSpace,
+		NoHeader:              *fNoHeader,
+	}
+	err = oldProc.OpenIO(flag.Args()[:1])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v: error opening file\n", err)
+		os.Exit(2)
+	}
+	d := &differ{}
+	header, records, err := oldProc.ReadAll()
+	if err == nil {
+		err = d.load(header, records, common.FieldIndices(keyRanges))
+	}
+	if err == nil {
+		err = oldProc.Close()
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(2)
+	}
+
+	procFunc := func(record []string, buffer []string, isHeader bool, lineNo int) ([][]string, error) {
+		if isHeader {
+			if err := d.setHeader(record); err != nil {
+				return nil, err
+			}
+			return [][]string{append(buffer, d.outputHeader()...)}, nil
+		}
+		return d.compare(record)
+	}
+
+	proc := common.CSVProcessor{
+		InputSeparator:        *fInputSeparator,
+		InputTabSeparator:     *fInputTabSeparator,
+		InputComment:          *fInputComment,
+		InputFieldsPerLine:    int(fInputFieldsPerLine),
+		InputLazyQuotes:       *fInputLazyQuotes,
+		InputTrimLeadingSpace: *fInputTrimLeadingSpace,
+
+		OutputFile:      *fOutputFile,
+		AppendOutput:    *fAppendOutput,
+		OutputSeparator: *fOutputSeparator,
+		OutputCRLF:      *fOutputCRLF,
+		OutputNewline:   *fOutputNewline,
+
+		NoHeader: *fNoHeader,
+		EndFunc:  d.removed,
+	}
+
+	err = proc.OpenIO(flag.Args()[1:])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v: error opening file\n", err)
+		os.Exit(2)
+	}
+
+	err = proc.Process(procFunc, false)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(2)
+	}
+	err = proc.Close()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(2)
+	}
+	if d.differences > 0 {
+		os.Exit(1)
+	}
+}
+
+// differ holds the rows of the old file by key, and compares the rows of the
+// new file against them as they are read.
+type differ struct {
+	oldHeader []string
+	keyNames  []string
+	rows      map[string][][]string
+	order     []string
+
+	// columns maps each column of the new file to its index in the old.
+	columns     []int
+	keys        []int
+	differences int
+}
+
+func (d *differ) load(header []string, records [][]string, keys []int) error {
+	d.oldHeader = header
+	if len(keys) == 0 {
+		for i := range header {
+			keys = append(keys, i)
+		}
+	}
+	for _, i := range keys {
+		if i >= len(header) {
+			return fmt.Errorf("%d: no such field in record of length %d", i+1, len(header))
+		}
+		d.keyNames = append(d.keyNames, header[i])
+	}
+	d.rows = make(map[string][][]string)
+	for _, record := range records {
+		k, err := key(keys, record)
+		if err != nil {
+			return err
+		}
+		if _, ok := d.rows[k]; !ok {
+			d.order = append(d.order, k)
+		}
+		d.rows[k] = append(d.rows[k], record)
+	}
+	return nil
+}
+
+// setHeader matches the columns of the new file to those of the old by name.
+// The files must have the same columns, though their order may differ.
+func (d *differ) setHeader(header []string) error {
+	positions := make(map[string]int, len(d.oldHeader))
+	for i, name := range d.oldHeader {
+		positions[name] = i
+	}
+	var added []string
+	d.columns = make([]int, len(header))
+	seen := make(map[string]bool, len(header))
+	for i, name := range header {
+		j, ok := positions[name]
+		if !ok {
+			added = append(added, name)
+			continue
+		}
+		d.columns[i] = j
+		seen[name] = true
+	}
+	var removed []string
+	for _, name := range d.oldHeader {
+		if !seen[name] {
+			removed = append(removed, name)
+		}
+	}
+	if len(added) > 0 || len(removed) > 0 || len(header) != len(d.oldHeader) {
+		return fmt.Errorf("schema mismatch: columns only in old file: [%s], only in new file: [%s]",
+			strings.Join(removed, ","), strings.Join(added, ","))
+	}
+	d.keys = nil
+	for _, name := range d.keyNames {
+		for i, n := range header {
+			if n == name {
+				d.keys = append(d.keys, i)
+				break
+			}
+		}
+	}
+	return nil
+}
+
+func (d *differ) outputHeader() []string {
+	return append([]string{"status", "columns"}, d.newOrder(d.oldHeader)...)
+}
+
+// newOrder returns the fields of a record of the old file in the column order
+// of the new file.
+func (d *differ) newOrder(record []string) []string {
+	reordered := make([]string, len(d.columns))
+	for i, j := range d.columns {
+		if j < len(record) {
+			reordered[i] = record[j]
+		}
+	}
+	return reordered
+}
+
+// compare compares a record of the new file with the first remaining record
+// of the old file with the same key, so that rows with duplicate keys are
+// matched in the order they appear.
+func (d *differ) compare(record []string) ([][]string, error) {
+	k, err := key(d.keys, record)
+	if err != nil {
+		return nil, err
+	}
+	old := d.rows[k]
+	if len(old) == 0 {
+		d.differences++
+		return [][]string{append([]string{"added", ""}, record...)}, nil
+	}
+	d.rows[k] = old[1:]
+	var changed []string
+	oldRecord := d.newOrder(old[0])
+	for i := range record {
+		if i >= len(oldRecord) || record[i] != oldRecord[i] {
+			changed = append(changed, columnName(d.oldHeader, d.columns, i))
+		}
+	}
+	if len(changed) == 0 {
+		return nil, nil
+	}
+	d.differences++
+	return [][]string{append([]string{"changed", strings.Join(changed, ";")}, record...)}, nil
+}
+
+// removed returns the rows of the old file that were not matched by any row
+// of the new file, in the order their keys first appear in the old file.
+func (d *differ) removed() ([][]string, error) {
+	var records [][]string
+	for _, k := range d.order {
+		for _, record := range d.rows[k] {
+			records = append(records, append([]string{"removed", ""}, d.newOrder(record)...))
+		}
+	}
+	d.differences += len(records)
+	return records, nil
+}
+
+func columnName(header []string, columns []int, i int) string {
+	if i < len(columns) && columns[i] < len(header) {
+		return header[columns[i]]
+	}
+	return fmt.Sprintf("C%d", i+1)
+}
+
+// key joins the fields of record at indices into a single string.
+func key(indices []int, record []string) (string, error) {
+	fields := make([]string, 0, len(indices))
+	for _, i := range indices {
+		if i >= len(record) {
+			return "", fmt.Errorf("%d: no such field in record of length %d", i+1, len(record))
+		}
+		fields = append(fields, record[i])
+	}
+	return strings.Join(fields, "\x00"), nil
+}
+
+const DESCRIPTION = `
+csvdiff - compare two CSV files row by row
+
+csvdiff is part of the Cursive toolkit, and is analogous to the Unix 'diff'
+command.  Cursive is a set of utilities for reading and writing "separated
+value" formats like CSV and TSV.
+
+Rows of the two files are matched by a key, made up of the fields given with
+"-k" as a list of field ranges of the old file, or of the whole row.  The old
+file is held in memory, and the new file is read a row at a time.
+
+The output has the columns of the new file, preceded by a "status" column
+and a "columns" column.  Each row of the new file whose key is not in the old
+file is output with a status of "added".  Each row whose key is in both files
+but whose other fields differ is output as "changed", with the names of the
+fields that differ in "columns", separated by ";".  Finally, each row of the
+old file whose key is not in the new file is output as "removed".  Rows that
+are the same in both files are not output.  For example:
+
+  csvdiff -k=1 old.csv new.csv
+
+If a key appears more than once, the rows with that key are matched in the
+order they appear in each file.
+
+Columns are matched by name, so their order may differ between the files, but
+it is an error if either file has a column that the other does not.  With
+"-h", columns are named C1, C2 and so on, and both files must have the same
+number of columns.
+
+With "-log-file", error and warning messages are appended to the given file
+instead of being written to standard error.
+
+EXIT STATUS
+
+csvdiff exits with status 0 if the files do not differ, 1 if they do, and 2 if
+an error occurred.
+
+`
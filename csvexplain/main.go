@@ -0,0 +1,275 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"github.com/laslowh/cursive/common"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"unicode/utf8"
+)
+
+var (
+	fInputSeparator    = flag.String("is", "", "input separator; detected from the input unless given")
+	fInputTabSeparator = flag.Bool("its", false, "input separator is the tab character (overrides -is)")
+	fInputLazyQuotes   = flag.Bool("iq", false, "input allow 'lazy' quotes")
+
+	fNoHeader  = flag.Bool("h", false, "no header row, will create default headers")
+	fZeroBased = flag.Bool("z", false, "when displaying column numbers, use zero-based numbering")
+	fLogFile   = flag.String("log-file", "", "append error and warning messages to this file instead of writing them to standard error")
+)
+
+func init() {
+	flag.BoolVar(fInputTabSeparator, "input-tsv", false, "alias for -its")
+}
+
+// sampleSize is the number of bytes at the start of the input from which the
+// byte order mark, separator and line endings are detected.
+const sampleSize = 64 * 1024
+
+var usage = func() {
+	fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [options] [ <input> ]\n", os.Args[0])
+	flag.PrintDefaults()
+	fmt.Fprintf(flag.CommandLine.Output(), DESCRIPTION)
+	os.Exit(1)
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+	if err := common.SetLogFile(*fLogFile); err != nil {
+		fmt.Fprintf(os.Stderr, "%v: error opening log file\n", err)
+		os.Exit(1)
+	}
+	defer common.CloseLogFile()
+	if *fInputTabSeparator {
+		*fInputSeparator = "\t"
+	}
+	if flag.NArg() > 1 {
+		usage()
+	}
+
+	name := "(standard input)"
+	var input io.Reader = os.Stdin
+	if flag.NArg() == 1 {
+		name = flag.Arg(0)
+		f, err := os.Open(name)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v: error opening file\n", err)
+			os.Exit(1)
+		}
+		defer f.Close()
+		input = f
+	}
+
+	e, err := explain(input)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+	err = e.write(os.Stdout, name)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+}
+
+// explanation is what csvexplain finds out about its input.
+type explanation struct {
+	size       int64
+	bom        bool
+	delimiter  rune
+	detected   bool
+	lineEnding string
+	rows       int
+	header     []string
+}
+
+// explain reads all of r, detecting its format from the start of it and then
+// counting its rows and columns.
+func explain(r io.Reader) (*explanation, error) {
+	counter := &countingReader{r: r}
+	br := bufio.NewReaderSize(counter, sampleSize)
+	sample, err := br.Peek(sampleSize)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	e := &explanation{bom: common.HasBOM(sample)}
+	skip := 0
+	if e.bom {
+		skip = len("\xef\xbb\xbf")
+	}
+	sample = sample[skip:]
+	e.lineEnding = common.DetectLineEnding(sample)
+	if *fInputSeparator != "" {
+		e.delimiter, _ = utf8.DecodeRuneInString(*fInputSeparator)
+	} else {
+		e.delimiter, err = inferDelimiter(sample, err == io.EOF, e.lineEnding)
+		if err != nil {
+			return nil, err
+		}
+		e.detected = true
+	}
+	br.Discard(skip)
+
+	var data io.Reader = br
+	if e.lineEnding == "cr" {
+		data = common.NewCRReader(br)
+	}
+	csvr := csv.NewReader(data)
+	csvr.Comma = e.delimiter
+	csvr.FieldsPerRecord = -1
+	csvr.LazyQuotes = *fInputLazyQuotes
+	width := 0
+	for {
+		record, err := csvr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if e.header == nil && !*fNoHeader {
+			e.header = record
+			continue
+		}
+		if len(record) > width {
+			width = len(record)
+		}
+		e.rows++
+	}
+	if *fNoHeader {
+		for i := 0; i < width; i++ {
+			e.header = append(e.header, fmt.Sprintf("C%d", i+1))
+		}
+	}
+	e.size = counter.n
+	return e, nil
+}
+
+// inferDelimiter chooses the separator of the input from sample, the start
+// of it, with common.InferDelimiter.  Unless the sample is the whole input,
+// its last line may be incomplete, and is left out if there are others.
+func inferDelimiter(sample []byte, atEOF bool, lineEnding string) (rune, error) {
+	if !atEOF {
+		if i := bytes.LastIndexAny(sample, "\r\n"); i >= 0 {
+			sample = sample[:i+1]
+		}
+	}
+	var r io.Reader = bytes.NewReader(sample)
+	if lineEnding == "cr" {
+		r = common.NewCRReader(r)
+	}
+	delimiter, _, err := common.InferDelimiter(r, nil, 0)
+	return delimiter, err
+}
+
+// write outputs the explanation of the input called name in two parts: the
+// properties of the file, then the index and name of each column.
+func (e *explanation) write(w io.Writer, name string) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	delimiter := delimiterName(e.delimiter)
+	if e.detected {
+		delimiter += " (detected)"
+	}
+	lineEnding := strings.ToUpper(e.lineEnding)
+	if lineEnding == "" {
+		lineEnding = "none"
+	}
+	bom := "no"
+	if e.bom {
+		bom = "yes"
+	}
+	fmt.Fprintf(tw, "file:\t%s\n", name)
+	fmt.Fprintf(tw, "size:\t%d bytes\n", e.size)
+	fmt.Fprintf(tw, "bom:\t%s\n", bom)
+	fmt.Fprintf(tw, "delimiter:\t%s\n", delimiter)
+	fmt.Fprintf(tw, "line endings:\t%s\n", lineEnding)
+	fmt.Fprintf(tw, "rows:\t%d\n", e.rows)
+	fmt.Fprintf(tw, "columns:\t%d\n", len(e.header))
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	if len(e.header) == 0 {
+		return nil
+	}
+	offset := 1
+	if *fZeroBased {
+		offset = 0
+	}
+	width := len(fmt.Sprint(len(e.header) - 1 + offset))
+	fmt.Fprintln(w)
+	for i, column := range e.header {
+		if _, err := fmt.Fprintf(w, "  %*d  %s\n", width, i+offset, column); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func delimiterName(r rune) string {
+	switch r {
+	case ',':
+		return "comma"
+	case '\t':
+		return "tab"
+	case ';':
+		return "semicolon"
+	case '|':
+		return "pipe"
+	}
+	return fmt.Sprintf("%q", r)
+}
+
+// countingReader counts the bytes read from r.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (cr *countingReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	cr.n += int64(n)
+	return n, err
+}
+
+const DESCRIPTION = `
+csvexplain - describe the format and shape of a CSV file
+
+csvexplain is part of the Cursive toolkit.  Cursive is a set of utilities for
+reading and writing "separated value" formats like CSV and TSV.
+
+csvexplain reads the whole input and prints, for a person rather than another
+program, the name and size of the file, whether it begins with a UTF-8 byte
+order mark, its separator, its line endings, and the number of data rows and
+columns, followed by the index and name of each column.  For example:
+
+  csvexplain input.csv
+
+The byte order mark, separator and line endings are detected from the first
+64KB of the input.  The separator is taken to be whichever of comma, tab,
+semicolon and pipe splits the first lines most consistently into the same
+number of fields, as with the "-infer-delimiter" flag of csvcut; the "-is" or
+"-its" flags give it instead.  The line endings are LF, CRLF or CR, as found
+at the end of the first line.
+
+The number of rows does not include the header row, unless there is none
+("-h"), in which case the columns are named C1, C2 and so on.  Columns are
+numbered from 1, or from 0 with "-z".
+
+INPUT AND OUTPUT
+
+If <input> is not specified on the command line, csvexplain will read from
+standard in.  csvexplain always writes to standard out.
+
+With "-log-file", error and warning messages are appended to the given file
+instead of being written to standard error.
+
+`
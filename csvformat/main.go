@@ -0,0 +1,158 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/laslowh/cursive/common"
+	"os"
+)
+
+var (
+	fInputSeparator        = flag.String("is", ",", "input separator")
+	fInputTabSeparator     = flag.Bool("its", false, "input separator is the tab character (overrides -is)")
+	fInputComment          = flag.String("ic", "", "input beginning of line comment character")
+	fInputFieldsPerLine    = common.FieldsPerLine(-1)
+	fInputLazyQuotes       = flag.Bool("iq", false, "input allow 'lazy' quotes")
+	fInputTrimLeadingSpace = flag.Bool("it", false, "input trim leading space")
+
+	fOutputFile      = flag.String("o", "", "output file; defaults to stdout")
+	fAppendOutput    = flag.Bool("append", false, "append to the output file instead of replacing it, without repeating the header")
+	fOutputSeparator = flag.String("os", "", "output separator, which may be more than one character; defaults to input separator")
+	fOutputTabSep    = flag.Bool("ots", false, "output separator is the tab character (overrides -os)")
+	fOutputCRLF      = flag.Bool("oc", false, "output using CRLF as line ending")
+	fOutputNewline   = flag.String("newline", "lf", "output line ending: lf, crlf or cr")
+	fOutputExcel     = flag.Bool("excel", false, "output for Excel, starting with a UTF-8 byte order mark and using CRLF as line ending")
+
+	fIgnoreBeginning = flag.Int("bi", 0, "number of lines to ignore at beginning of file")
+	fIgnoreEnd       = flag.Int("ei", 0, "number of lines to ignore at end of file")
+	fNoHeader        = flag.Bool("h", false, "no header row, will create default headers")
+	fDateColumns     = flag.String("date-cols", "", "a comma-separated list of column indices or ranges holding dates to be reformatted")
+	fDateFormat      = flag.String("date-fmt", "2006-01-02", "Go time layout of the dates in the input, such as 2006-01-02 or 02.01.2006 15:04")
+	fExcelDateFormat = flag.String("output-excel-date-fmt", "01/02/2006", "Go time layout of the dates in the output, which Excel should recognize as dates")
+	fLogFile         = flag.String("log-file", "", "append error and warning messages to this file instead of writing them to standard error")
+)
+
+func init() {
+	flag.Var(&fInputFieldsPerLine, "in", "input expected number of fields per line (-1 is any, strict is the number in the first line)")
+	flag.BoolVar(fInputTabSeparator, "input-tsv", false, "alias for -its")
+	flag.BoolVar(fOutputTabSep, "output-tsv", false, "alias for -ots")
+}
+
+var usage = func() {
+	fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [options] [ <input> ]\n", os.Args[0])
+	flag.PrintDefaults()
+	fmt.Fprintf(flag.CommandLine.Output(), DESCRIPTION)
+	os.Exit(1)
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+	if err := common.SetLogFile(*fLogFile); err != nil {
+		fmt.Fprintf(os.Stderr, "%v: error opening log file\n", err)
+		os.Exit(1)
+	}
+	defer common.CloseLogFile()
+	if *fInputTabSeparator {
+		*fInputSeparator = "\t"
+	}
+	if *fOutputTabSep {
+		*fOutputSeparator = "\t"
+	}
+	if *fOutputSeparator == "" {
+		*fOutputSeparator = *fInputSeparator
+	}
+	if *fDateColumns == "" {
+		usage()
+	}
+	transforms, err := common.ParseDateTransforms(*fDateColumns, *fDateFormat, *fExcelDateFormat)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v: error parsing date columns\n", err)
+		os.Exit(1)
+	}
+
+	procFunc := func(record []string, buffer []string, isHeader bool, lineNo int) ([][]string, error) {
+		if !isHeader {
+			var err error
+			record, err = common.ApplyTransforms(transforms, record)
+			if err != nil {
+				return nil, fmt.Errorf("row %d: %v", lineNo, err)
+			}
+		}
+		return [][]string{append(buffer, record...)}, nil
+	}
+
+	proc := common.CSVProcessor{
+		InputSeparator:        *fInputSeparator,
+		InputTabSeparator:     *fInputTabSeparator,
+		InputComment:          *fInputComment,
+		InputFieldsPerLine:    int(fInputFieldsPerLine),
+		InputLazyQuotes:       *fInputLazyQuotes,
+		InputTrimLeadingSpace: *fInputTrimLeadingSpace,
+
+		OutputFile:      *fOutputFile,
+		AppendOutput:    *fAppendOutput,
+		OutputSeparator: *fOutputSeparator,
+		OutputCRLF:      *fOutputCRLF || *fOutputExcel,
+		OutputNewline:   *fOutputNewline,
+		OutputBOM:       *fOutputExcel,
+
+		IgnoreBeginning: *fIgnoreBeginning,
+		IgnoreEnd:       *fIgnoreEnd,
+		NoHeader:        *fNoHeader,
+	}
+
+	err = proc.OpenIO(flag.Args())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v: error opening file\n", err)
+		os.Exit(1)
+	}
+
+	err = proc.Process(procFunc, false)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+	err = proc.Close()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+}
+
+const DESCRIPTION = `
+csvformat - reformat the dates of a CSV file for Excel
+
+csvformat is part of the Cursive toolkit.  Cursive is a set of utilities for
+reading and writing "separated value" formats like CSV and TSV.
+
+Excel does not take every way of writing a date as a date: depending on the
+locale, it may keep 2024-01-05 as text but read 01/05/2024 as the 5th of
+January.  csvformat rewrites the dates in the columns given with "-date-cols",
+as a comma-separated list of indices or ranges starting at 1, in a form that
+Excel reads as a date.
+
+Each date is parsed with the "-date-fmt" layout, and written with the
+"-output-excel-date-fmt" layout.  Layouts are written as in Go, by showing how
+the reference time, Mon Jan 2 15:04:05 2006, would look: 2006-01-02, the
+default input layout, is year-month-day, and 01/02/2006, the default output
+layout, is month/day/year.  For a locale that puts the day first, such as the
+United Kingdom, use -output-excel-date-fmt=02/01/2006.  For example:
+
+  csvformat -date-cols=3,5 -date-fmt="02.01.2006" -excel input.csv
+
+Empty values are left empty.  A value that does not match the input layout is
+an error, giving its row and field.  The header row is not changed.  The
+"-excel" flag also writes the output as Excel expects it, starting with a
+UTF-8 byte order mark and using CRLF as line ending.
+
+INPUT AND OUTPUT
+
+If <input> is not specified on the command line, csvformat will read from
+standard in.   If no "-o" flag is provided, csvformat will write to standard
+out.
+
+With "-log-file", error and warning messages are appended to the given file
+instead of being written to standard error.
+
+`
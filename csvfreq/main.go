@@ -0,0 +1,187 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/laslowh/cursive/common"
+	"os"
+	"strconv"
+)
+
+var (
+	fInputSeparator        = flag.String("is", ",", "input separator")
+	fInputTabSeparator     = flag.Bool("its", false, "input separator is the tab character (overrides -is)")
+	fInputComment          = flag.String("ic", "", "input beginning of line comment character")
+	fInputFieldsPerLine    = common.FieldsPerLine(-1)
+	fInputLazyQuotes       = flag.Bool("iq", false, "input allow 'lazy' quotes")
+	fInputTrimLeadingSpace = flag.Bool("it", false, "input trim leading space")
+
+	fOutputFile      = flag.String("o", "", "output file; defaults to stdout")
+	fAppendOutput    = flag.Bool("append", false, "append to the output file instead of replacing it, without repeating the header")
+	fOutputSeparator = flag.String("os", "", "output separator, which may be more than one character; defaults to input separator")
+	fOutputTabSep    = flag.Bool("ots", false, "output separator is the tab character (overrides -os)")
+	fOutputCRLF      = flag.Bool("oc", false, "output using CRLF as line ending")
+	fOutputNewline   = flag.String("newline", "lf", "output line ending: lf, crlf or cr")
+
+	fIgnoreBeginning = flag.Int("bi", 0, "number of lines to ignore at beginning of file")
+	fIgnoreEnd       = flag.Int("ei", 0, "number of lines to ignore at end of file")
+	fNoHeader        = flag.Bool("h", false, "no header row, will create default headers")
+	fColumn          = flag.String("c", "", "name or number of the column whose values are counted")
+	fFoldCase        = flag.Bool("hci", false, "match the column names given with -c and -col regardless of case")
+	fColumns         common.StringList
+	fTop             = flag.Int("top", 0, "output only this many of the most frequent values of each column (0 is all)")
+	fLogFile         = flag.String("log-file", "", "append error and warning messages to this file instead of writing them to standard error")
+)
+
+func init() {
+	flag.Var(&fInputFieldsPerLine, "in", "input expected number of fields per line (-1 is any, strict is the number in the first line)")
+	flag.BoolVar(fInputTabSeparator, "input-tsv", false, "alias for -its")
+	flag.BoolVar(fOutputTabSep, "output-tsv", false, "alias for -ots")
+	flag.Var(&fColumns, "col", "name or number of a further column whose values are counted; may be repeated")
+}
+
+var usage = func() {
+	fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [options] [ <input> ]\n", os.Args[0])
+	flag.PrintDefaults()
+	fmt.Fprintf(flag.CommandLine.Output(), DESCRIPTION)
+	os.Exit(1)
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+	if err := common.SetLogFile(*fLogFile); err != nil {
+		fmt.Fprintf(os.Stderr, "%v: error opening log file\n", err)
+		os.Exit(1)
+	}
+	defer common.CloseLogFile()
+	if *fInputTabSeparator {
+		*fInputSeparator = "\t"
+	}
+	if *fOutputTabSep {
+		*fOutputSeparator = "\t"
+	}
+	if *fOutputSeparator == "" {
+		*fOutputSeparator = *fInputSeparator
+	}
+	var names []string
+	if *fColumn != "" {
+		names = append(names, *fColumn)
+	}
+	names = append(names, fColumns...)
+	if len(names) == 0 {
+		usage()
+	}
+
+	var indices []int
+	counters := make([]*common.FrequencyCounter, len(names))
+	for i := range counters {
+		counters[i] = common.NewFrequencyCounter()
+	}
+	procFunc := func(record []string, buffer []string, isHeader bool, lineNo int) ([][]string, error) {
+		if isHeader {
+			var err error
+			indices, err = common.FindColumns(record, names, *fFoldCase)
+			return nil, err
+		}
+		for i, index := range indices {
+			if index >= len(record) {
+				return nil, fmt.Errorf("%d: no such field in record of length %d", index+1, len(record))
+			}
+			counters[i].Add(record[index])
+		}
+		return nil, nil
+	}
+	endFunc := func() ([][]string, error) {
+		var records [][]string
+		for i, fc := range counters {
+			if i > 0 {
+				records = append(records, []string{})
+			}
+			records = append(records, []string{"value", "count", "pct"})
+			counts := fc.Sorted()
+			if *fTop > 0 && len(counts) > *fTop {
+				counts = counts[:*fTop]
+			}
+			for _, vc := range counts {
+				pct := 100 * float64(vc.Count) / float64(fc.Total())
+				records = append(records, []string{vc.Value, strconv.Itoa(vc.Count), strconv.FormatFloat(pct, 'f', 2, 64)})
+			}
+		}
+		return records, nil
+	}
+
+	proc := common.CSVProcessor{
+		InputSeparator:        *fInputSeparator,
+		InputTabSeparator:     *fInputTabSeparator,
+		InputComment:          *fInputComment,
+		InputFieldsPerLine:    int(fInputFieldsPerLine),
+		InputLazyQuotes:       *fInputLazyQuotes,
+		InputTrimLeadingSpace: *fInputTrimLeadingSpace,
+
+		OutputFile:      *fOutputFile,
+		AppendOutput:    *fAppendOutput,
+		OutputSeparator: *fOutputSeparator,
+		OutputCRLF:      *fOutputCRLF,
+		OutputNewline:   *fOutputNewline,
+
+		IgnoreBeginning: *fIgnoreBeginning,
+		IgnoreEnd:       *fIgnoreEnd,
+		NoHeader:        *fNoHeader,
+
+		EndFunc: endFunc,
+	}
+
+	err := proc.OpenIO(flag.Args())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v: error opening file\n", err)
+		os.Exit(1)
+	}
+
+	err = proc.Process(procFunc, false)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+	err = proc.Close()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+}
+
+const DESCRIPTION = `
+csvfreq - count the frequency of the values of CSV columns
+
+csvfreq is part of the Cursive toolkit.  Cursive is a set of utilities for
+reading and writing "separated value" formats like CSV and TSV.
+
+For the column given with "-c", by name or by number starting at 1, csvfreq
+outputs each distinct value with the number of rows in which it occurs and
+that number as a percentage of all rows.  The output has the columns "value",
+"count" and "pct", and is sorted with the most frequent value first.  With
+"-top", only that many of the most frequent values are output.  For example:
+
+  csvfreq -c=Status -top=10 input.csv
+
+Further columns may be given with the repeatable "-col" flag.  Each column is
+output as a separate section, with its own header row, in the order the
+columns were given.  Sections are separated by an empty line.
+
+With "-hci", column names match the header regardless of case, so -c=status
+counts a column named "Status".  A column named exactly as given is
+preferred, and if columns whose names differ only in case both match, a
+warning is printed and the first is used.
+
+Only the distinct values of each column are kept in memory.
+
+INPUT AND OUTPUT
+
+If <input> is not specified on the command line, csvfreq will read from
+standard in.   If no "-o" flag is provided, csvfreq will write to standard
+out.
+
+With "-log-file", error and warning messages are appended to the given file
+instead of being written to standard error.
+
+`
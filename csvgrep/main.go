@@ -1,35 +1,110 @@
 package main
 
 import (
+	"bufio"
 	"flag"
 	"fmt"
 	"github.com/laslowh/cursive/common"
+	"hash/fnv"
 	"os"
 	"regexp"
 	"strconv"
 	"strings"
+	"text/template"
+	"time"
+	"unicode/utf8"
 )
 
 var (
 	fInputSeparator        = flag.String("is", ",", "input separator")
 	fInputTabSeparator     = flag.Bool("its", false, "input separator is the tab character (overrides -is)")
+	fInputHeadSeparator    = flag.String("head-sep", "", "input separator of the header row, when it differs from that of the data rows")
 	fInputComment          = flag.String("ic", "", "input beginning of line comment character")
-	fInputFieldsPerLine    = flag.Int("in", -1, "input expected number of fields per line (-1 is any)")
+	fInputFieldsPerLine    = common.FieldsPerLine(-1)
 	fInputLazyQuotes       = flag.Bool("iq", false, "input allow 'lazy' quotes")
+	fInputQuoteChar        = flag.String("iqc", "", "input quote character, instead of the double quote")
+	fInputTrimBOM          = flag.Bool("trim-bom", false, "input drop a byte order mark from the start of the input and of every line, as in files concatenated together")
 	fInputTrimLeadingSpace = flag.Bool("it", false, "input trim leading space")
+	fInputTrailingComma    = flag.Bool("il", false, "input allow a trailing comma (always allowed; accepted for compatibility)")
+	fInputURL              = flag.String("input-url", "", "input URL to read with an HTTP GET instead of a file")
+	fInputURLHeaders       common.StringList
+	fInputURLTimeout       = flag.Duration("timeout", 30*time.Second, "input time to wait for a response from an input URL (0 is no limit)")
+	fInputURLRetries       = flag.Int("retries", 3, "input number of times to retry an input URL after a transient failure")
+	fInputJSONPath         = flag.String("input-json-path", "", "input is JSON, and this JSONPath, such as $.records[*], selects the objects that are rows")
+	fInputMultiline        = flag.String("input-multiline", "", "input join each line with unbalanced quotes to the next with this string, such as \\n or a space, repairing broken fields")
+	fInputValidUTF8        = flag.Bool("valid-utf8", false, "input fail at the first field that is not valid UTF-8, giving its line and column")
+	fInputRelaxed          = flag.Bool("input-relaxed", false, "input skip records with parse errors, reporting them on stderr")
 
 	fOutputFile      = flag.String("o", "", "output file; defaults to stdout")
-	fOutputSeparator = flag.String("os", "", "output separator; defaults to input separator")
+	fAppendOutput    = flag.Bool("append", false, "append to the output file instead of replacing it, without repeating the header")
+	fAtomicOutput    = flag.Bool("atomic", false, "write the output file under a temporary name, renaming it over the -o file only once it is complete")
+	fOutputURL       = flag.String("output-url", "", "output URL to which the output is sent with an HTTP request instead of a file")
+	fOutputURLMethod = flag.String("output-url-method", "POST", "output HTTP method used with -output-url: POST or PUT")
+	fOutputURLHeader common.StringList
+	fOutputSeparator = flag.String("os", "", "output separator, which may be more than one character; defaults to input separator")
+	fOutputQuoteChar = flag.String("oqc", "", "output quote character, instead of the double quote")
+	fOutputTabSep    = flag.Bool("ots", false, "output separator is the tab character (overrides -os)")
 	fOutputCRLF      = flag.Bool("oc", false, "output using CRLF as line ending")
+	fOutputNewline   = flag.String("newline", "lf", "output line ending: lf, crlf or cr")
+	fOutputWidth     = flag.Int("field-width", 0, "output pad or truncate every field to this many characters (0 is unlimited)")
+	fOutputPadChar   = flag.String("pad-char", " ", "output character used to pad fields with -field-width")
+	fOutputJSONLines = flag.Bool("jl", false, "output each row as a JSON object on its own line, keyed by the header")
+	fOutputJSONArray = flag.Bool("jp", false, "output all rows as a single JSON array of objects keyed by the header, indented for reading")
+	fOutputJSONTypes = flag.Bool("jt", false, "with -jl or -jp, output numbers and true/false as JSON numbers and booleans instead of strings")
+	fOutputExcel     = flag.Bool("excel", false, "output for Excel, starting with a UTF-8 byte order mark and using CRLF as line ending")
+	fOutputSafe      = flag.Bool("safe", false, "output fields beginning with =, +, - or @ prefixed with -safe-escape, so spreadsheets do not run them as formulas")
+	fOutputSafeEsc   = flag.String("safe-escape", "'", "prefix written before fields that look like formulas with -safe")
+	fOutputTemplate  = flag.String("output-template", "", "a Go text/template with which each row is output instead of as CSV")
 
 	fIgnoreBeginning = flag.Int("bi", 0, "number of lines to ignore at beginning of file")
 	fIgnoreEnd       = flag.Int("ei", 0, "number of lines to ignore at end of file")
+	fEndPattern      = flag.String("etp", "", "a regular expression; input ends at the first line after the header that matches it, which is dropped with all that follow")
 	fNoHeader        = flag.Bool("h", false, "no header row, will create default headers")
+	fDetectHeader    = flag.Bool("ha", false, "guess whether the input has a header row from its first two rows, unless -h is given")
+	fMaxRows         = flag.Int("max", 0, "output at most this many data rows, then stop (0 is unlimited)")
+	fEvery           = flag.Int("every", 0, "output only every Nth data row, those whose line number modulo N is -every-phase (0 is all rows)")
+	fEveryPhase      = flag.Int("every-phase", 0, "line number modulo -every of the data rows that are output")
+	fNormalizeHeader = flag.Bool("hn", false, "normalize the output header to lower case names made of letters, digits and underscores")
 
 	fFilterMode   = flag.Bool("f", true, "filter non matching rows")
 	fInvertFilter = flag.Bool("v", false, "invert filter (filter matching rows)")
+	fTransforms   common.StringList
+	fCases        common.StringList
+	fTrims        common.StringList
+	fTrimAll      = flag.Bool("trim-all", false, "trim leading and trailing white space from every field")
+	fUnquote      = flag.String("sq", "", "a comma-separated list of column indices or ranges from whose values a pair of surrounding quotes is removed")
+	fUnquoteAll   = flag.Bool("sq-all", false, "remove a pair of surrounding quotes from the values of every field")
+	fFills        common.StringList
+	fFillAll      = flag.String("col-fill-all", "", "replace every empty field of every data row with this value")
+	fRenames      common.StringList
+	fRejectFile   = flag.String("reject", "", "file to which rows removed by the filter are written")
+	fPreserve     = flag.Bool("preserve-quotes", false, "copy fields that are not replaced to the output exactly as they appear in the input")
+	fIgnoreCase   = flag.Bool("i", false, "compare fields with the sets of -inN and -notinN case-insensitively")
+	fOnlyChanged  = flag.Bool("oc-changed", false, "output only rows in which a replacement or transform changed at least one field")
+	fSampleHash   = flag.Int("samplehash", 0, "output only rows whose key hashes to 0 modulo N, about 1 in N rows whatever their order (0 is all rows)")
+	fFindNull     = flag.Int("find-null", 0, "pass only rows where field N is empty or -null-value (0 is off)")
+	fNullValue    = flag.String("null-value", "", "a token that stands for a missing value, such as NULL, matched by -find-null as well as the empty string")
+	fKeyColumns   = flag.String("c", "", "a comma-separated list of column indices or ranges that make up the key for -samplehash; default is all columns")
+	fLogFile      = flag.String("log-file", "", "append error and warning messages to this file instead of writing them to standard error")
 )
 
+// hashSample passes only rows whose key fields hash to 0 modulo n, so that
+// the same keys are always sampled whatever the order of the rows.
+type hashSample struct {
+	n   uint64
+	key []int
+}
+
+// membership passes only rows whose field is in, or with notIn is not in,
+// the set of lines of a file.
+type membership struct {
+	field      int
+	file       string
+	notIn      bool
+	ignoreCase bool
+	set        map[string]bool
+}
+
 type replacement struct {
 	field     int
 	res       string
@@ -38,76 +113,337 @@ type replacement struct {
 	with      string
 }
 
+func init() {
+	flag.Var(&fInputFieldsPerLine, "in", "input expected number of fields per line (-1 is any, strict is the number in the first line)")
+	flag.BoolVar(fInputTabSeparator, "input-tsv", false, "alias for -its")
+	flag.BoolVar(fOutputTabSep, "output-tsv", false, "alias for -ots")
+	flag.Var(&fInputURLHeaders, "input-url-header", "input HTTP header as Key:Value sent with -input-url; may be repeated")
+	flag.Var(&fOutputURLHeader, "output-url-header", "output HTTP header as Key:Value sent with -output-url; may be repeated")
+	flag.Var(&fFills, "col-fill", "replace empty fields with a value as ranges:value, such as 3:0 or 4:N/A; may be repeated")
+	flag.Var(&fRenames, "col-rename-regex", "rename the header columns matching a regular expression as regexp:replacement, such as ^Q(\\d+)$:Question_$1; may be repeated")
+	flag.Var(&fTrims, "trim", "trim white space from fields as ranges:mode, where mode is all, left, right or quotes; may be repeated")
+	flag.Var(&fCases, "case", "change the case of fields as case:ranges, where case is upper, lower or title; may be repeated")
+	flag.Var(&fTransforms, "transform", "transform field N as N:name, where name is one of base64encode, base64decode, urlencode, urldecode, md5, sha256, upper, lower or title; may be repeated")
+}
+
 var usage = func() {
-	fmt.Fprintf(os.Stderr, "usage: %s [options] [ <input> ]\n", os.Args[0])
+	fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [options] [ <input> ]\n", os.Args[0])
 	flag.PrintDefaults()
-	fmt.Fprintf(os.Stderr, "  -rN=<regexp>: regular expression to match in field N\n")
-	fmt.Fprintf(os.Stderr, "  -wN=<replacement>: replacement for field N, where $X denotes submatch\n")
-	fmt.Fprintf(os.Stderr, DESCRIPTION)
-	os.Exit(1)
+	fmt.Fprintf(flag.CommandLine.Output(), "  -rN=<regexp>: regular expression to match in field N\n")
+	fmt.Fprintf(flag.CommandLine.Output(), "  -wN=<replacement>: replacement for field N, where $X denotes submatch\n")
+	fmt.Fprintf(flag.CommandLine.Output(), "  -inN=<file>: pass only rows where field N is one of the lines of file\n")
+	fmt.Fprintf(flag.CommandLine.Output(), "  -notinN=<file>: pass only rows where field N is not one of the lines of file\n")
+	fmt.Fprintf(flag.CommandLine.Output(), DESCRIPTION)
+	os.Exit(2)
 }
 
 func main() {
-	replacements, err := preparseFlags()
+	replacements, memberships, err := preparseFlags()
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "%s", err)
 		usage()
 	}
 	flag.Usage = usage
 	flag.Parse()
+	if err := common.SetLogFile(*fLogFile); err != nil {
+		fmt.Fprintf(os.Stderr, "%v: error opening log file\n", err)
+		os.Exit(2)
+	}
+	defer common.CloseLogFile()
+	if *fFindNull < 0 {
+		fmt.Fprintf(os.Stderr, "%d: invalid field for -find-null\n", *fFindNull)
+		os.Exit(2)
+	}
+	if *fFindNull > 0 {
+		res := "^(?:" + regexp.QuoteMeta(*fNullValue) + ")?$"
+		replacements = append(replacements, replacement{field: *fFindNull - 1, res: res, re: regexp.MustCompile(res)})
+	}
+	for i := range memberships {
+		memberships[i].ignoreCase = *fIgnoreCase
+		memberships[i].set, err = readSet(memberships[i].file, *fIgnoreCase)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v: error reading set\n", err)
+			os.Exit(2)
+		}
+	}
 
 	if *fInputTabSeparator {
 		*fInputSeparator = "\t"
 	}
+	if *fOutputTabSep {
+		*fOutputSeparator = "\t"
+	}
 	if *fOutputSeparator == "" {
 		*fOutputSeparator = *fInputSeparator
 	}
+	if !*fOutputSafe {
+		*fOutputSafeEsc = ""
+	}
+	if utf8.RuneCountInString(*fInputQuoteChar) > 1 || utf8.RuneCountInString(*fOutputQuoteChar) > 1 {
+		fmt.Fprintf(os.Stderr, "-iqc and -oqc must be a single character\n")
+		os.Exit(2)
+	}
+	if *fInputMultiline != "" {
+		var err error
+		*fInputMultiline, err = common.ParseEscapes(*fInputMultiline)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v: error parsing -input-multiline\n", err)
+			os.Exit(2)
+		}
+	}
+	var outputTemplate *template.Template
+	if *fOutputTemplate != "" {
+		var err error
+		outputTemplate, err = common.ParseOutputTemplate(*fOutputTemplate)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v: error parsing output template\n", err)
+			os.Exit(2)
+		}
+	}
+	var ignoreEndPattern *regexp.Regexp
+	if *fEndPattern != "" {
+		var err error
+		ignoreEndPattern, err = regexp.Compile(*fEndPattern)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v: error parsing end pattern\n", err)
+			os.Exit(2)
+		}
+	}
 
-	procFunc := func(record []string, buffer []string, isHeader bool, lineNo int) ([]string, error) {
-		return processRecord(replacements, record, buffer, isHeader, lineNo, *fFilterMode, *fInvertFilter)
+	transforms, err := common.ParseFieldTransforms(fTransforms)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v: error parsing transforms\n", err)
+		os.Exit(2)
+	}
+	for _, spec := range fCases {
+		cases, err := common.ParseCaseTransforms(spec)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v: error parsing case\n", err)
+			os.Exit(2)
+		}
+		transforms = append(transforms, cases...)
+	}
+
+	var trims []*common.FieldTrim
+	for _, spec := range fTrims {
+		t, err := common.ParseFieldTrim(spec)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v: error parsing trim\n", err)
+			os.Exit(2)
+		}
+		trims = append(trims, t)
+	}
+	if *fTrimAll {
+		trims = append(trims, &common.FieldTrim{Mode: "all"})
+	}
+	if *fUnquote != "" {
+		t, err := common.ParseFieldTrim(*fUnquote + ":quotes")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v: error parsing -sq\n", err)
+			os.Exit(2)
+		}
+		trims = append(trims, t)
+	}
+	if *fUnquoteAll {
+		trims = append(trims, &common.FieldTrim{Mode: "quotes"})
+	}
+
+	var fills []*common.FieldFill
+	for _, spec := range fFills {
+		f, err := common.ParseFieldFill(spec)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v: error parsing fill\n", err)
+			os.Exit(2)
+		}
+		fills = append(fills, f)
+	}
+	if *fFillAll != "" {
+		fills = append(fills, &common.FieldFill{Value: *fFillAll})
+	}
+
+	var renames []*common.HeaderRename
+	for _, spec := range fRenames {
+		r, err := common.ParseHeaderRename(spec)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v: error parsing rename\n", err)
+			os.Exit(2)
+		}
+		renames = append(renames, r)
+	}
+
+	if *fEvery < 0 || (*fEvery > 0 && (*fEveryPhase < 0 || *fEveryPhase >= *fEvery)) {
+		fmt.Fprintf(os.Stderr, "%d: -every-phase must be at least 0 and less than -every\n", *fEveryPhase)
+		os.Exit(2)
+	}
+
+	if *fSampleHash < 0 {
+		fmt.Fprintf(os.Stderr, "%d: -samplehash must not be negative\n", *fSampleHash)
+		os.Exit(2)
+	}
+	var sample *hashSample
+	if *fSampleHash > 0 {
+		keyRanges, err := common.ParseFieldRanges(*fKeyColumns)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v: error parsing key columns\n", err)
+			os.Exit(2)
+		}
+		sample = &hashSample{n: uint64(*fSampleHash), key: common.FieldIndices(keyRanges)}
+	}
+
+	matched := false
+	procFunc := func(record []string, buffer []string, isHeader bool, lineNo int) ([][]string, error) {
+		original := record
+		if !isHeader {
+			var err error
+			record, err = common.ApplyTransforms(transforms, record)
+			if err != nil {
+				return nil, err
+			}
+		}
+		output, err := processRecord(replacements, memberships, sample, record, buffer, isHeader, lineNo, *fFilterMode, *fInvertFilter)
+		if output == nil || err != nil {
+			return nil, err
+		}
+		if *fOnlyChanged && !isHeader && !changed(original, output[len(buffer):]) {
+			return nil, nil
+		}
+		if !isHeader {
+			matched = true
+		}
+		return [][]string{output}, nil
 	}
 
 	proc := common.CSVProcessor{
 		InputSeparator:        *fInputSeparator,
 		InputTabSeparator:     *fInputTabSeparator,
 		InputComment:          *fInputComment,
-		InputFieldsPerLine:    *fInputFieldsPerLine,
+		InputFieldsPerLine:    int(fInputFieldsPerLine),
 		InputLazyQuotes:       *fInputLazyQuotes,
 		InputTrimLeadingSpace: *fInputTrimLeadingSpace,
+		InputTrailingComma:    *fInputTrailingComma,
+		InputURL:              *fInputURL,
+		InputURLHeaders:       fInputURLHeaders,
+		InputURLTimeout:       *fInputURLTimeout,
+		InputURLRetries:       *fInputURLRetries,
+		InputJSONPath:         *fInputJSONPath,
+		InputMultiline:        *fInputMultiline,
 
 		OutputFile:      *fOutputFile,
+		AppendOutput:    *fAppendOutput,
+		AtomicOutput:    *fAtomicOutput,
+		OutputURL:       *fOutputURL,
+		OutputURLMethod: *fOutputURLMethod,
+		OutputURLHeader: fOutputURLHeader,
 		OutputSeparator: *fOutputSeparator,
-		OutputCRLF:      *fOutputCRLF,
-
+		OutputCRLF:      *fOutputCRLF || *fOutputExcel,
+		RejectFile:      *fRejectFile,
+		OutputNewline:   *fOutputNewline,
+		OutputWidth:     *fOutputWidth,
+		OutputPadChar:   *fOutputPadChar,
+		OutputJSONLines: *fOutputJSONLines,
+		OutputJSONArray: *fOutputJSONArray,
+		OutputJSONTypes: *fOutputJSONTypes,
+		OutputBOM:       *fOutputExcel,
+
+		OutputFormulaEscape: *fOutputSafeEsc,
+		OutputTemplate:      outputTemplate,
+		IgnoreEndPattern:    ignoreEndPattern,
+		DetectHeader:        *fDetectHeader && !common.FlagSet("h"),
+		ValidUTF8:           *fInputValidUTF8,
+		HeadSeparator:       *fInputHeadSeparator,
+		InputQuote:          *fInputQuoteChar,
+		InputTrimBOM:        *fInputTrimBOM,
+		OutputQuote:         *fOutputQuoteChar,
+
+		Trims:           trims,
+		Fills:           fills,
+		HeaderRenames:   renames,
 		IgnoreBeginning: *fIgnoreBeginning,
 		IgnoreEnd:       *fIgnoreEnd,
 		NoHeader:        *fNoHeader,
+		MaxRows:         *fMaxRows,
+		Every:           *fEvery,
+		EveryPhase:      *fEveryPhase,
+		NormalizeHeader: *fNormalizeHeader,
+		RelaxedMode:     *fInputRelaxed,
 	}
 
 	err = proc.OpenIO(flag.Args())
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "%v: error opening file\n", err)
-		os.Exit(1)
+		os.Exit(2)
 	}
 
-	err = proc.Process(procFunc, false)
+	if *fPreserve {
+		if *fOutputSeparator != *fInputSeparator || *fOutputCRLF || *fOutputNewline != "lf" ||
+			*fOutputWidth > 0 || *fOutputJSONLines || *fOutputJSONArray || *fOutputExcel || *fOutputSafe || *fOutputTemplate != "" || *fOutputQuoteChar != "" || *fNormalizeHeader || len(fRenames) > 0 || *fInputRelaxed {
+			fmt.Fprintf(os.Stderr, "-preserve-quotes cannot be combined with options that change the format of the output\n")
+			proc.Abort()
+			os.Exit(2)
+		}
+		if proc.DetectHeader || proc.ValidUTF8 || proc.HeadSeparator != "" || proc.InputQuote != "" {
+			fmt.Fprintf(os.Stderr, "-preserve-quotes cannot be combined with -ha, -valid-utf8, -head-sep or -iqc\n")
+			proc.Abort()
+			os.Exit(2)
+		}
+		rawFunc := func(record []string, isHeader bool, lineNo int) (bool, error) {
+			output, err := procFunc(record, nil, isHeader, lineNo)
+			if len(output) == 0 || err != nil {
+				return false, err
+			}
+			copy(record, output[0])
+			return true, nil
+		}
+		err = proc.ProcessRaw(rawFunc)
+	} else {
+		err = proc.Process(procFunc, false)
+	}
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "%v\n", err)
+		proc.Abort()
+		os.Exit(2)
+	}
+	err = proc.Close()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(2)
+	}
+	if !matched {
 		os.Exit(1)
 	}
 }
 
-func processRecord(replacements []replacement, record []string, buffer []string, isheader bool, lineNo int, filterMode, invert bool) ([]string, error) {
+func processRecord(replacements []replacement, memberships []membership, sample *hashSample, record []string, buffer []string, isheader bool, lineNo int, filterMode, invert bool) ([]string, error) {
 	buflen := len(buffer)
 	buffer = append(buffer, record...)
 	record = buffer[buflen:]
-	if replacements == nil || len(replacements) == 0 || isheader {
+	if isheader {
 		return buffer, nil
 	}
 
+	if sample != nil {
+		keep, err := sample.keep(record)
+		if !keep || err != nil {
+			return nil, err
+		}
+	}
+
+	for _, m := range memberships {
+		if m.field < 0 || m.field >= len(record) {
+			return nil, fmt.Errorf("%d: no such field in record of length %d", m.field+1, len(record))
+		}
+		value := record[m.field]
+		if m.ignoreCase {
+			value = strings.ToLower(value)
+		}
+		if (m.set[value] != m.notIn) == invert {
+			return nil, nil
+		}
+	}
+
 	for _, r := range replacements {
 		if r.field < 0 || r.field >= len(record) {
-			return nil, fmt.Errorf("%d: no such field in record of length %d", r.field, len(record))
+			return nil, fmt.Errorf("%d: no such field in record of length %d", r.field+1, len(record))
 		}
 		if filterMode && r.re.MatchString(record[r.field]) == invert {
 			return nil, nil
@@ -119,27 +455,78 @@ func processRecord(replacements []replacement, record []string, buffer []string,
 	return buffer, nil
 }
 
-func preparseFlags() ([]replacement, error) {
+// keep hashes the key fields of record with FNV-1a, separating them with a
+// zero byte, and reports whether the hash is 0 modulo n.  If no key fields
+// were given, the whole record is the key.
+func (s *hashSample) keep(record []string) (bool, error) {
+	h := fnv.New64a()
+	write := func(i int, field string) {
+		if i > 0 {
+			h.Write([]byte{0})
+		}
+		h.Write([]byte(field))
+	}
+	if len(s.key) == 0 {
+		for i, field := range record {
+			write(i, field)
+		}
+	}
+	for i, index := range s.key {
+		if index >= len(record) {
+			return false, fmt.Errorf("%d: no such field in record of length %d", index+1, len(record))
+		}
+		write(i, record[index])
+	}
+	return h.Sum64()%s.n == 0, nil
+}
+
+// changed reports whether any field of after differs from before.
+func changed(before, after []string) bool {
+	if len(before) != len(after) {
+		return true
+	}
+	for i := range before {
+		if before[i] != after[i] {
+			return true
+		}
+	}
+	return false
+}
+
+func preparseFlags() ([]replacement, []membership, error) {
 	args := os.Args
 	newArgs := make([]string, 0, len(args))
 	replacements := make([]replacement, 0)
+	var memberships []membership
 	for i, a := range args {
 		if i == 0 {
 			newArgs = append(newArgs, args[0])
 			continue
-		} else if strings.HasPrefix(a, "-r") {
+		} else if isFieldFlag(a, "-r") {
 			r, value, err := createOrFindReplacer(a[2:], &replacements)
 			if err != nil {
-				return nil, err
+				return nil, nil, err
 			}
 			r.res = value
-		} else if strings.HasPrefix(a, "-w") {
+		} else if isFieldFlag(a, "-w") {
 			r, value, err := createOrFindReplacer(a[2:], &replacements)
 			if err != nil {
-				return nil, err
+				return nil, nil, err
 			}
 			r.isReplace = true
 			r.with = value
+		} else if isFieldFlag(a, "-in") {
+			m, err := parseMembership(a[3:], false)
+			if err != nil {
+				return nil, nil, err
+			}
+			memberships = append(memberships, m)
+		} else if isFieldFlag(a, "-notin") {
+			m, err := parseMembership(a[6:], true)
+			if err != nil {
+				return nil, nil, err
+			}
+			memberships = append(memberships, m)
 		} else if !strings.HasPrefix(a, "-") {
 			newArgs = append(newArgs, args[i:]...)
 			break
@@ -152,10 +539,55 @@ func preparseFlags() ([]replacement, error) {
 		var err error
 		replacements[i].re, err = regexp.Compile(replacements[i].res)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
+		}
+	}
+	return replacements, memberships, nil
+}
+
+func parseMembership(flag string, notIn bool) (membership, error) {
+	splits := strings.SplitN(flag, "=", 2)
+	if len(splits) != 2 {
+		return membership{}, fmt.Errorf("%s: invalid flag", flag)
+	}
+	field, err := strconv.ParseUint(splits[0], 10, 32)
+	if err != nil {
+		return membership{}, err
+	}
+	return membership{field: int(field) - 1, file: splits[1], notIn: notIn}, nil
+}
+
+// readSet reads the lines of the named file into a set, lower casing them if
+// ignoreCase is set.  Empty lines are skipped.
+func readSet(name string, ignoreCase bool) (map[string]bool, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	set := make(map[string]bool)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSuffix(scanner.Text(), "\r")
+		if line == "" {
+			continue
+		}
+		if ignoreCase {
+			line = strings.ToLower(line)
 		}
+		set[line] = true
 	}
-	return replacements, nil
+	return set, scanner.Err()
+}
+
+// isFieldFlag reports whether arg is a per-field flag such as "-r3=...",
+// rather than an ordinary flag that happens to share its prefix.
+func isFieldFlag(arg, prefix string) bool {
+	if !strings.HasPrefix(arg, prefix) || len(arg) == len(prefix) {
+		return false
+	}
+	c := arg[len(prefix)]
+	return c >= '0' && c <= '9'
 }
 
 func createOrFindReplacer(flag string, replacements *[]replacement) (*replacement, string, error) {
@@ -203,6 +635,171 @@ If <input> is not specified on the command line, csvgrep will read from
 standard in.   If no "-o" flag is provided, csvgrep will write to standard
 out.
 
+With "-log-file", error and warning messages are appended to the given file
+instead of being written to standard error.
+
+<input> may also be an "http://" or "https://" URL, which is fetched with an
+HTTP GET.  A URL ending in ".gz" is decompressed.
+
+With "-append", output is added to the end of the "-o" file instead of
+replacing it, so that the output of several runs can be collected in one
+file.  If the file already has content, the header row is not written again,
+nor is a byte order mark.
+
+With "-atomic", the output is written to a temporary file in the directory of
+the "-o" file, which is synced to disk and renamed over the "-o" file only
+once csvgrep has succeeded.  Another program never sees a partly written
+file: it sees either the old file or the new one.  If csvgrep fails, the
+temporary file is removed and the "-o" file is left as it was, but if csvgrep
+is killed, the temporary file, named after the "-o" file with a leading dot,
+may be left behind.  The rename is atomic on Unix file systems, but not
+always on Windows or network file systems.  It cannot be combined with
+"-append".
+
+The "-etp" flag drops a trailer of any length from the end of the input, such
+as the totals at the foot of a report.  The input ends at the first line after
+the header that matches its regular expression, and that line and all that
+follow are ignored; no more of the input is read.  Each line is matched as its
+fields joined by the input separator, so -etp="^TOTAL," drops everything from
+the first line whose first field is "TOTAL".  It may be combined with "-ei",
+which then ignores that many lines before the trailer.
+
+The "-ha" flag is for files that may or may not have a header row.  It
+guesses from the first two rows: if none of the fields of the first row is a
+number, but at least one field of the second row is, the first row is taken
+to be the header.  Otherwise, as when there is only one row, a header is
+created as with "-h".  Files whose columns are all text cannot be told apart
+this way, and are taken to have no header.  Giving "-h", or "-h=false", decides
+explicitly and overrides "-ha".
+
+The "-input-multiline" flag repairs input from exporters that break a field
+across lines without quoting it properly.  A line with an odd number of
+quotes is taken to continue on the next line, and the two are joined with the
+given string in place of the line ending, until the quotes balance.  The
+string may use escapes such as \n.  This is a guess, and a stray quote will
+join lines that should be separate, so a warning is given when any lines are
+joined.
+
+The "-valid-utf8" flag checks that every field of the input is valid UTF-8,
+and fails with the line and column of the first invalid sequence rather than
+passing it on to the output, where it would show as garbled text.
+
+The "-head-sep" flag is for input whose header row uses a different separator
+from its data rows, such as a comma-separated header over tab-separated data.
+The header row is read with the "-head-sep" separator, and the rest with the
+input separator, as in -head-sep=, -its.
+
+The "-iqc" and "-oqc" flags give a quote character other than the double
+quote for the input and output, such as -iqc="'" for fields quoted with
+single quotes.  Within a quoted field, the quote character is written twice
+to stand for itself, and a double quote is an ordinary character.
+
+The "-trim-bom" flag drops the UTF-8 byte order mark that some programs,
+notably Excel, write at the start of a file, and which would otherwise be
+read as part of the first field.  It is dropped from the start of every line,
+so that a mark is also dropped from the start of each file when several are
+concatenated, as in "cat a.csv b.csv | csvgrep -trim-bom".  The output only
+begins with a mark with "-excel".
+
+The "-in" flag checks that every line of the input has the given number of
+fields.  With -in=strict, that number is taken from the first line, usually
+the header, and a line with a different number fails with its line number and
+both counts.  With "-input-relaxed" as well, such lines are skipped and
+reported on standard error instead.
+
+With "-input-json-path", the input is a JSON document instead of CSV.  The
+flag gives a JSONPath selecting the objects that are the input rows, using
+".name", ".*", "[N]", "[*]" and "['name']" after a leading "$".  A selected
+array of objects gives a row for each element.  The header row holds every
+member name, in the order they are first seen.  For example, for input of the
+form {"meta":{...},"records":[{...},{...}]}:
+
+  -input-json-path='$.records[*]'
+
+The "-max" flag stops once that many data rows have been output, not counting
+the header, which is useful for previews.  It applies after rows are filtered
+and replaced, so the output has that many rows if enough rows match.
+
+The "-every" flag samples the input, passing only every Nth data row to the
+rest of the processing: those whose line number modulo N is "-every-phase",
+which is 0 unless given.  Data rows are numbered from 1, so "-every=10"
+outputs rows 10, 20, 30 and so on, and "-every=10 -every-phase=1" outputs rows
+1, 11, 21, starting with the first.  Combined with "-max", it gives a bounded
+preview of a long file.  Rows that are not sampled are not matched either, so
+they are not written to the "-reject" file.
+
+The "-samplehash" flag also samples the input, but by key rather than by
+position: a row is output only if the FNV-1a hash of its key is 0 modulo N,
+which keeps about 1 in N rows.  The key is made up of the fields given with
+"-c", as a comma-separated list of field ranges, or of the whole row.  The
+same keys are sampled however the rows are ordered or split between files,
+which gives consistent test data.  For example:
+
+  csvgrep -samplehash=100 -c=1 input.csv
+
+The "-excel" flag writes output that Excel opens correctly: the output begins
+with a UTF-8 byte order mark, and lines end with CRLF.  Excel expects the
+separator of the system's locale, which is often ";", so it may be combined
+with "-os", as in -excel -os=";".
+
+The "-safe" flag guards against formula injection when the output is opened
+in a spreadsheet: every field that begins with "=", "+", "-" or "@" is
+prefixed with a single quote, or with the "-safe-escape" string, so that it is
+not run as a formula.  This changes the data, negative numbers included, so it
+is only done when asked for.
+
+The "-output-template" flag formats each row with a Go text/template instead
+of writing CSV, and the header row is not output.  Fields are available as
+.F0, .F1 and so on, counting from 0, and by their names in the header row, as
+.Name, or as index . "Full Name" for names that are not identifiers.  A line
+ending follows each row.  For example, to write SQL statements:
+
+  -output-template='INSERT INTO t VALUES ("{{.F0}}", {{.Age}});'
+
+The "-trim" flag, which may be repeated, removes white space from the given
+fields of every row, including the header, as soon as it is read.  It is given
+as ranges:mode, where ranges is a list of field ranges as for "-c" and mode is
+"all" to trim both ends, "left" or "right".  For example, -trim=1,3:all.  The
+"-trim-all" flag trims both ends of every field.
+
+The "-sq" flag removes a pair of quotes that are part of the values of the
+given fields rather than CSV quoting, such as '123', or "123" after a space
+when read with "-iq".  If a value begins and ends with the same quote, double
+or single, the two are removed, once; quotes within it are kept.  The
+"-sq-all" flag does this for every field, and -trim=ranges:quotes is the same
+as "-sq".  The quotes are removed after the input is read, so unlike quoting
+in CSV, a quoted value is still split at the separator, and a doubled quote
+within it is not undone.  For fields quoted with another character, use
+"-iqc" instead.  Quotes are removed after white space is trimmed.
+
+The "-col-fill" flag, which may be repeated, fills in missing values: every
+empty field in the given fields of the data rows is replaced with a value.  It
+is given as ranges:value, where ranges is a list of field ranges, so
+-col-fill=3:0 fills field 3 with "0" and -col-fill=4-5:N/A fills fields 4 and
+5 with "N/A".  The "-col-fill-all" flag fills every field.  Fields are filled
+after they are trimmed and before any other processing.
+
+The "-col-rename-regex" flag, which may be repeated, renames every column of
+the header whose name matches a regular expression.  It is given as
+regexp:replacement, and the replacement may refer to submatches as $1, $2 and
+so on, so that -col-rename-regex='^Q(\d+)$:Question_$1' renames Q1, Q2 and
+Q10 to Question_1, Question_2 and Question_10.  The replacement is everything
+after the last colon.  Columns are renamed as the header is read, after it is
+trimmed, so the new names are those that are output.
+
+With "-jl", each row is output as a JSON object on a line of its own, keyed by
+the names in the header row, which is not itself output.  Values are strings
+unless "-jt" is also given, in which case numbers and "true" or "false" are
+output as JSON numbers and booleans.
+
+With "-jp", the rows are output instead as a single JSON array of such
+objects, indented by two spaces for reading.  The array is only written once
+every row has been read.  "-jt" applies to it as to "-jl".
+
+If a "-reject" file is given, every row that is removed by the filter is
+written to that file unaltered, so that nothing is lost.  The header row is
+written to both outputs.
+
 REPLACEMENT
 
 csvgrep can do a "find-and-replace" operation on specific columns in the
@@ -221,5 +818,45 @@ first column you would use
 
   cursive -r0="^\d(.*)" -w0="$1" input.csv
 
+Fields may also be passed through a transformation with the "-transform"
+flag, given as N:name, where name is one of "base64encode", "base64decode",
+"urlencode", "urldecode", "md5", "sha256", "upper", "lower" or "title".  The
+"-case" flag changes the case of several fields at once, given as case:ranges,
+such as -case=upper:1,3-4.  Transformations are applied before matching and
+replacement.
+
+The "-inN" flag passes only the rows whose field N is one of the lines of a
+file, such as a list of IDs, and "-notinN" only those whose field N is not.
+With "-i", the comparison ignores case, and with "-v", each is reversed, as
+for the regular expressions.  These are faster and clearer than a regular
+expression listing every value:
+
+  csvgrep -in1=ids.txt input.csv
+
+The "-find-null" flag passes only the rows whose field N is missing: either
+empty, or equal to the "-null-value" token, such as "NULL" or "\N", if one is
+given.  No regular expression is needed, and with "-v", only the rows in which
+the field has a value are passed.  For example:
+
+  csvgrep -find-null=3 -null-value=NULL input.csv
+
+To audit what the replacements and transformations touch, the "-oc-changed"
+flag outputs only the rows in which at least one field was changed.
+
 The regular expression language supported by cursive is re2. Documentation can
-be found here: https://code.google.com/p/re2/wiki/Syntax `
+be found here: https://code.google.com/p/re2/wiki/Syntax
+
+PRESERVING QUOTES
+
+Fields are normally written quoted only where necessary, so that a field that
+was quoted in the input may not be in the output.  With "-preserve-quotes",
+every field that is not changed by a "-w" replacement or "-transform" is
+copied to the output exactly as it appears in the input, along with its line
+ending.  Only the changed fields are written anew.  Options that change the
+format of the output, such as "-os", cannot be used with it.
+
+EXIT STATUS
+
+Like grep, csvgrep exits with status 0 if at least one data row was output, 1
+if no data rows were output, and 2 if an error occurred.
+`
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"github.com/laslowh/cursive/common"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+)
+
+var (
+	fInputSeparator        = flag.String("is", ",", "input separator")
+	fInputTabSeparator     = flag.Bool("its", false, "input separator is the tab character (overrides -is)")
+	fInputComment          = flag.String("ic", "", "input beginning of line comment character")
+	fInputFieldsPerLine    = common.FieldsPerLine(-1)
+	fInputLazyQuotes       = flag.Bool("iq", false, "input allow 'lazy' quotes")
+	fInputTrimLeadingSpace = flag.Bool("it", false, "input trim leading space")
+
+	fIgnoreBeginning = flag.Int("bi", 0, "number of lines to ignore at beginning of file")
+	fIgnoreEnd       = flag.Int("ei", 0, "number of lines to ignore at end of file")
+	fNoHeader        = flag.Bool("h", false, "no header row, will create default headers")
+	fColumn          = flag.String("c", "", "name or number of the numeric column to chart")
+	fFoldCase        = flag.Bool("hci", false, "match the column name given with -c regardless of case")
+	fBins            = flag.Int("bins", 10, "number of bins")
+	fLog             = flag.Bool("log", false, "use bins of equal width on a log scale; values that are not positive are skipped")
+	fWidth           = flag.Int("width", 50, "number of characters in the longest bar")
+	fLogFile         = flag.String("log-file", "", "append error and warning messages to this file instead of writing them to standard error")
+)
+
+func init() {
+	flag.Var(&fInputFieldsPerLine, "in", "input expected number of fields per line (-1 is any, strict is the number in the first line)")
+	flag.BoolVar(fInputTabSeparator, "input-tsv", false, "alias for -its")
+}
+
+var usage = func() {
+	fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [options] [ <input> ]\n", os.Args[0])
+	flag.PrintDefaults()
+	fmt.Fprintf(flag.CommandLine.Output(), DESCRIPTION)
+	os.Exit(1)
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+	if err := common.SetLogFile(*fLogFile); err != nil {
+		fmt.Fprintf(os.Stderr, "%v: error opening log file\n", err)
+		os.Exit(1)
+	}
+	defer common.CloseLogFile()
+	if *fInputTabSeparator {
+		*fInputSeparator = "\t"
+	}
+	if *fColumn == "" || *fBins < 1 || *fWidth < 1 {
+		usage()
+	}
+
+	h := &histogram{log: *fLog}
+	index := -1
+	procFunc := func(record []string, buffer []string, isHeader bool, lineNo int) ([][]string, error) {
+		if isHeader {
+			indices, err := common.FindColumns(record, []string{*fColumn}, *fFoldCase)
+			if err != nil {
+				return nil, err
+			}
+			index = indices[0]
+			return nil, nil
+		}
+		v := ""
+		if index < len(record) {
+			v = record[index]
+		}
+		h.add(v)
+		return nil, nil
+	}
+
+	proc := common.CSVProcessor{
+		InputSeparator:        *fInputSeparator,
+		InputTabSeparator:     *fInputTabSeparator,
+		InputComment:          *fInputComment,
+		InputFieldsPerLine:    int(fInputFieldsPerLine),
+		InputLazyQuotes:       *fInputLazyQuotes,
+		InputTrimLeadingSpace: *fInputTrimLeadingSpace,
+
+		IgnoreBeginning: *fIgnoreBeginning,
+		IgnoreEnd:       *fIgnoreEnd,
+		NoHeader:        *fNoHeader,
+	}
+
+	err := proc.OpenIO(flag.Args())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v: error opening file\n", err)
+		os.Exit(1)
+	}
+
+	err = proc.Process(procFunc, false)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+	err = proc.Close()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+
+	err = h.write(os.Stdout, *fBins, *fWidth)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+}
+
+// histogram collects the numeric values of a column, counting the values
+// that are skipped.  With log set, values are binned by their logarithm, so
+// those that are not positive are skipped too.
+type histogram struct {
+	log         bool
+	values      []float64
+	empty       int
+	nonNumeric  int
+	nonPositive int
+}
+
+func (h *histogram) add(v string) {
+	v = strings.TrimSpace(v)
+	if v == "" {
+		h.empty++
+		return
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	switch {
+	case err != nil || math.IsNaN(f) || math.IsInf(f, 0):
+		h.nonNumeric++
+	case h.log && f <= 0:
+		h.nonPositive++
+	case h.log:
+		h.values = append(h.values, math.Log10(f))
+	default:
+		h.values = append(h.values, f)
+	}
+}
+
+// scale converts a bin edge back from the scale on which values are binned.
+func (h *histogram) scale(x float64) float64 {
+	if h.log {
+		return math.Pow(10, x)
+	}
+	return x
+}
+
+// write outputs a bar chart of the values in n bins of equal width between
+// the least and the greatest value, with the longest bar width characters
+// long, followed by the counts of the values that were skipped.
+func (h *histogram) write(w io.Writer, n, width int) error {
+	bw := bufio.NewWriter(w)
+	if len(h.values) > 0 {
+		min, max := h.values[0], h.values[0]
+		for _, v := range h.values {
+			min = math.Min(min, v)
+			max = math.Max(max, v)
+		}
+		step := (max - min) / float64(n)
+		counts := make([]int, n)
+		for _, v := range h.values {
+			i := n - 1
+			if step > 0 {
+				i = int((v - min) / step)
+			}
+			if i >= n {
+				i = n - 1
+			}
+			counts[i]++
+		}
+		most := 0
+		for _, c := range counts {
+			if c > most {
+				most = c
+			}
+		}
+
+		labels := make([]string, n)
+		labelWidth, countWidth := 0, len(strconv.Itoa(most))
+		for i := range labels {
+			lo, hi := h.scale(min+float64(i)*step), h.scale(min+float64(i+1)*step)
+			if i == n-1 {
+				labels[i] = fmt.Sprintf("[%s, %s]", formatEdge(lo), formatEdge(h.scale(max)))
+			} else {
+				labels[i] = fmt.Sprintf("[%s, %s)", formatEdge(lo), formatEdge(hi))
+			}
+			if len(labels[i]) > labelWidth {
+				labelWidth = len(labels[i])
+			}
+		}
+		for i, c := range counts {
+			bar := strings.Repeat("#", (c*width+most-1)/most)
+			line := fmt.Sprintf("%-*s  %*d  %s", labelWidth, labels[i], countWidth, c, bar)
+			fmt.Fprintln(bw, strings.TrimRight(line, " "))
+		}
+	}
+	fmt.Fprintf(bw, "%d values", len(h.values))
+	if h.empty > 0 {
+		fmt.Fprintf(bw, ", %d empty", h.empty)
+	}
+	if h.nonNumeric > 0 {
+		fmt.Fprintf(bw, ", %d not numeric", h.nonNumeric)
+	}
+	if h.nonPositive > 0 {
+		fmt.Fprintf(bw, ", %d not positive", h.nonPositive)
+	}
+	fmt.Fprintln(bw)
+	return bw.Flush()
+}
+
+func formatEdge(v float64) string {
+	return strconv.FormatFloat(v, 'g', 4, 64)
+}
+
+const DESCRIPTION = `
+csvhist - chart the distribution of a numeric CSV column
+
+csvhist is part of the Cursive toolkit.  Cursive is a set of utilities for
+reading and writing "separated value" formats like CSV and TSV.
+
+For the column given with "-c", by name or by number starting at 1, csvhist
+divides the range from the least to the greatest value into "-bins" bins of
+equal width, 10 unless given, and prints a text bar chart of the number of
+values in each.  Each bin includes its lower bound but not its upper, except
+the last, which includes both.  For example:
+
+  csvhist -c=3 -bins=20 input.csv
+
+With "-log", the bins are of equal width on a log scale instead, which suits
+values spread over several orders of magnitude.  Values that are not positive
+cannot be placed on a log scale, and are skipped.
+
+With "-hci", the name given with "-c" matches the header regardless of case,
+so -c=price finds a column named "Price".  A column named exactly as given is
+preferred, and a warning is printed if columns whose names differ only in
+case, such as "Price" and "PRICE", both match.
+
+Empty values and values that are not numbers are skipped.  The chart is
+followed by the number of values charted and of those skipped.  Every value
+of the column is kept in memory.
+
+INPUT AND OUTPUT
+
+If <input> is not specified on the command line, csvhist will read from
+standard in.  csvhist always writes to standard out.
+
+With "-log-file", error and warning messages are appended to the given file
+instead of being written to standard error.
+
+`
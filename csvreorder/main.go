@@ -0,0 +1,174 @@
+package main
+
+import (
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"github.com/laslowh/cursive/common"
+	"os"
+	"strings"
+)
+
+var (
+	fInputSeparator        = flag.String("is", ",", "input separator")
+	fInputTabSeparator     = flag.Bool("its", false, "input separator is the tab character (overrides -is)")
+	fInputComment          = flag.String("ic", "", "input beginning of line comment character")
+	fInputFieldsPerLine    = common.FieldsPerLine(-1)
+	fInputLazyQuotes       = flag.Bool("iq", false, "input allow 'lazy' quotes")
+	fInputTrimLeadingSpace = flag.Bool("it", false, "input trim leading space")
+
+	fOutputFile      = flag.String("o", "", "output file; defaults to stdout")
+	fAppendOutput    = flag.Bool("append", false, "append to the output file instead of replacing it, without repeating the header")
+	fOutputSeparator = flag.String("os", "", "output separator, which may be more than one character; defaults to input separator")
+	fOutputTabSep    = flag.Bool("ots", false, "output separator is the tab character (overrides -os)")
+	fOutputCRLF      = flag.Bool("oc", false, "output using CRLF as line ending")
+	fOutputNewline   = flag.String("newline", "lf", "output line ending: lf, crlf or cr")
+
+	fIgnoreBeginning = flag.Int("bi", 0, "number of lines to ignore at beginning of file")
+	fIgnoreEnd       = flag.Int("ei", 0, "number of lines to ignore at end of file")
+	fNoHeader        = flag.Bool("h", false, "no header row, will create default headers")
+	fMaxRows         = flag.Int("max", 0, "output at most this many data rows, then stop (0 is unlimited)")
+	fColumns         = flag.String("c", "", "a comma-separated list of the names of the columns to output, in order")
+	fFoldCase        = flag.Bool("hci", false, "match the names given with -c regardless of case")
+	fLogFile         = flag.String("log-file", "", "append error and warning messages to this file instead of writing them to standard error")
+)
+
+func init() {
+	flag.Var(&fInputFieldsPerLine, "in", "input expected number of fields per line (-1 is any, strict is the number in the first line)")
+	flag.BoolVar(fInputTabSeparator, "input-tsv", false, "alias for -its")
+	flag.BoolVar(fOutputTabSep, "output-tsv", false, "alias for -ots")
+}
+
+var usage = func() {
+	fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [options] [ <input> ]\n", os.Args[0])
+	flag.PrintDefaults()
+	fmt.Fprintf(flag.CommandLine.Output(), DESCRIPTION)
+	os.Exit(1)
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+	if err := common.SetLogFile(*fLogFile); err != nil {
+		fmt.Fprintf(os.Stderr, "%v: error opening log file\n", err)
+		os.Exit(1)
+	}
+	defer common.CloseLogFile()
+	if *fInputTabSeparator {
+		*fInputSeparator = "\t"
+	}
+	if *fOutputTabSep {
+		*fOutputSeparator = "\t"
+	}
+	if *fOutputSeparator == "" {
+		*fOutputSeparator = *fInputSeparator
+	}
+	names, err := parseNames(*fColumns)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v: error parsing columns\n", err)
+		os.Exit(1)
+	}
+	if len(names) == 0 {
+		usage()
+	}
+
+	var indices []int
+	procFunc := func(record []string, buffer []string, isHeader bool, lineNo int) ([][]string, error) {
+		if isHeader {
+			var err error
+			indices, err = common.FindColumns(record, names, *fFoldCase)
+			if err != nil {
+				return nil, err
+			}
+		}
+		output := buffer
+		for _, i := range indices {
+			if i >= len(record) {
+				return nil, fmt.Errorf("%d: no such field in record of length %d", i+1, len(record))
+			}
+			output = append(output, record[i])
+		}
+		return [][]string{output}, nil
+	}
+
+	proc := common.CSVProcessor{
+		InputSeparator:        *fInputSeparator,
+		InputTabSeparator:     *fInputTabSeparator,
+		InputComment:          *fInputComment,
+		InputFieldsPerLine:    int(fInputFieldsPerLine),
+		InputLazyQuotes:       *fInputLazyQuotes,
+		InputTrimLeadingSpace: *fInputTrimLeadingSpace,
+
+		OutputFile:      *fOutputFile,
+		AppendOutput:    *fAppendOutput,
+		OutputSeparator: *fOutputSeparator,
+		OutputCRLF:      *fOutputCRLF,
+		OutputNewline:   *fOutputNewline,
+
+		IgnoreBeginning: *fIgnoreBeginning,
+		IgnoreEnd:       *fIgnoreEnd,
+		NoHeader:        *fNoHeader,
+		MaxRows:         *fMaxRows,
+	}
+
+	err = proc.OpenIO(flag.Args())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v: error opening file\n", err)
+		os.Exit(1)
+	}
+
+	err = proc.Process(procFunc, false)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+	err = proc.Close()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+}
+
+// parseNames splits a comma-separated list of column names, which may be
+// quoted as in a CSV file if they contain commas.
+func parseNames(list string) ([]string, error) {
+	if strings.TrimSpace(list) == "" {
+		return nil, nil
+	}
+	r := csv.NewReader(strings.NewReader(list))
+	return r.Read()
+}
+
+const DESCRIPTION = `
+csvreorder - reorder the columns of a CSV file by name
+
+csvreorder is part of the Cursive toolkit.  Cursive is a set of utilities for
+reading and writing "separated value" formats like CSV and TSV.
+
+The "-c" flag gives the names of the columns to output, as they appear in the
+header row, or their numbers starting at 1, in the order they are to be
+output.  Columns that are not named
+are dropped, and a column may be named more than once.  For example:
+
+  csvreorder -c=Name,Age,Salary input.csv
+
+It is an error if a name does not appear in the header and is not a column
+number.  Names containing
+commas may be quoted as in a CSV file, such as -c='Name,"City, State"'.  With
+"-h", the columns are named C1, C2 and so on.
+
+With "-hci", names match the header regardless of case, so -c=name,age finds
+the columns "Name" and "Age".  A column named exactly as given is preferred;
+if columns whose names differ only in case, such as "Age" and "AGE", both
+match, the first is used and a warning is printed.
+
+INPUT AND OUTPUT
+
+If <input> is not specified on the command line, csvreorder will read from
+standard in.   If no "-o" flag is provided, csvreorder will write to standard
+out.
+
+With "-log-file", error and warning messages are appended to the given file
+instead of being written to standard error.
+
+`
@@ -1,78 +1,258 @@
 package main
 
 import (
+	"encoding/binary"
 	"flag"
 	"fmt"
 	"github.com/laslowh/cursive/common"
+	"hash/fnv"
+	"io"
 	"os"
-	"strconv"
-	"strings"
+	"regexp"
+	"text/template"
+	"time"
+	"unicode/utf8"
 )
 
 var (
 	fInputSeparator        = flag.String("is", ",", "input separator")
 	fInputTabSeparator     = flag.Bool("its", false, "input separator is the tab character (overrides -is)")
+	fInputHeadSeparator    = flag.String("head-sep", "", "input separator of the header row, when it differs from that of the data rows")
 	fInputComment          = flag.String("ic", "", "input beginning of line comment character")
-	fInputFieldsPerLine    = flag.Int("in", -1, "input expected number of fields per line (-1 is any)")
+	fInputFieldsPerLine    = common.FieldsPerLine(-1)
 	fInputLazyQuotes       = flag.Bool("iq", false, "input allow 'lazy' quotes")
+	fInputQuoteChar        = flag.String("iqc", "", "input quote character, instead of the double quote")
+	fInputTrimBOM          = flag.Bool("trim-bom", false, "input drop a byte order mark from the start of the input and of every line, as in files concatenated together")
 	fInputTrimLeadingSpace = flag.Bool("it", false, "input trim leading space")
+	fInputURL              = flag.String("input-url", "", "input URL to read with an HTTP GET instead of a file")
+	fInputURLHeaders       common.StringList
+	fInputURLTimeout       = flag.Duration("timeout", 30*time.Second, "input time to wait for a response from an input URL (0 is no limit)")
+	fInputURLRetries       = flag.Int("retries", 3, "input number of times to retry an input URL after a transient failure")
+	fInputJSONPath         = flag.String("input-json-path", "", "input is JSON, and this JSONPath, such as $.records[*], selects the objects that are rows")
+	fInputMultiline        = flag.String("input-multiline", "", "input join each line with unbalanced quotes to the next with this string, such as \\n or a space, repairing broken fields")
+	fInputValidUTF8        = flag.Bool("valid-utf8", false, "input fail at the first field that is not valid UTF-8, giving its line and column")
 
 	fOutputFile      = flag.String("o", "", "output file; defaults to stdout")
-	fOutputSeparator = flag.String("os", "", "output separator; defaults to input separator")
+	fAppendOutput    = flag.Bool("append", false, "append to the output file instead of replacing it, without repeating the header")
+	fAtomicOutput    = flag.Bool("atomic", false, "write the output file under a temporary name, renaming it over the -o file only once it is complete")
+	fOutputURL       = flag.String("output-url", "", "output URL to which the output is sent with an HTTP request instead of a file")
+	fOutputURLMethod = flag.String("output-url-method", "POST", "output HTTP method used with -output-url: POST or PUT")
+	fOutputURLHeader common.StringList
+	fOutputSeparator = flag.String("os", "", "output separator, which may be more than one character; defaults to input separator")
+	fOutputQuoteChar = flag.String("oqc", "", "output quote character, instead of the double quote")
+	fOutputTabSep    = flag.Bool("ots", false, "output separator is the tab character (overrides -os)")
 	fOutputCRLF      = flag.Bool("oc", false, "output using CRLF as line ending")
+	fOutputNewline   = flag.String("newline", "lf", "output line ending: lf, crlf or cr")
+	fOutputWidth     = flag.Int("field-width", 0, "output pad or truncate every field to this many characters (0 is unlimited)")
+	fOutputPadChar   = flag.String("pad-char", " ", "output character used to pad fields with -field-width")
+	fOutputJSONLines = flag.Bool("jl", false, "output each row as a JSON object on its own line, keyed by the header")
+	fOutputJSONArray = flag.Bool("jp", false, "output all rows as a single JSON array of objects keyed by the header, indented for reading")
+	fOutputJSONTypes = flag.Bool("jt", false, "with -jl or -jp, output numbers and true/false as JSON numbers and booleans instead of strings")
+	fOutputExcel     = flag.Bool("excel", false, "output for Excel, starting with a UTF-8 byte order mark and using CRLF as line ending")
+	fOutputSafe      = flag.Bool("safe", false, "output fields beginning with =, +, - or @ prefixed with -safe-escape, so spreadsheets do not run them as formulas")
+	fOutputSafeEsc   = flag.String("safe-escape", "'", "prefix written before fields that look like formulas with -safe")
+	fOutputTemplate  = flag.String("output-template", "", "a Go text/template with which each row is output instead of as CSV")
 
 	fIgnoreBeginning = flag.Int("bi", 0, "number of lines to ignore at beginning of file")
 	fIgnoreEnd       = flag.Int("ei", 0, "number of lines to ignore at end of file")
+	fEndPattern      = flag.String("etp", "", "a regular expression; input ends at the first line after the header that matches it, which is dropped with all that follow")
 	fNoHeader        = flag.Bool("h", false, "no header row, will create default headers")
+	fDetectHeader    = flag.Bool("ha", false, "guess whether the input has a header row from its first two rows, unless -h is given")
 	fLineNumbers     = flag.Bool("l", false, "insert a column of line numbers at the front of the output")
+	fLineNumberStart = flag.Int("number-rows-start", 0, "number of the first row with -l (default 1, or 0 with -z)")
+	fLineNumberStep  = flag.Int("number-rows-step", 1, "increment between the numbers of consecutive rows with -l")
+	fLineNumberFmt   = flag.String("number-rows-fmt", "%d", "printf format of the numbers inserted with -l, such as %05d")
 	fZeroBased       = flag.Bool("z", false, "when interpreting or displaying column numbers, use zero-based numbering")
 	fNames           = flag.Bool("n", false, "display column names and indices from the input and exit")
 	fColumns         = flag.String("c", "", "a comma-separated list of column indices or ranges to be used for sort ordering; default is all columns")
 	fReverse         = flag.Bool("r", false, "reverse sort order")
+	fEmptyLast       = flag.Bool("empty-last", false, "put rows with an empty value in any of the sort columns last, even with -r")
+	fHumanSort       = flag.Bool("human-sort", false, "compare columns without a flag in natural order, so that file2 sorts before file10")
+	fLocaleSort      = flag.Bool("locale-sort", false, "compare columns without a flag in dictionary order, ignoring accents and case before comparing them")
+	fDecimalMark     = flag.String("dec", ".", "decimal mark of numbers compared with the n flag, such as , for 1.234,56")
+	fGroupSep        = flag.String("grp", "", "grouping separator of numbers compared with the n flag, such as . for 1.234,56")
+	fOriginalOrder   = flag.Bool("ob", false, "break ties between equal rows by their original order")
+	fStable          = flag.Bool("stable", false, "keep equal rows in their original order by sorting with a stable sort")
+	fRandomTies      = flag.Bool("rt", false, "break ties between equal rows pseudo-randomly, reproducibly for a given -seed")
+	fSeed            = flag.Uint64("seed", 0, "seed for -rt")
+	fKey             = flag.String("key", "", "an expression computing the sort key of each row, used instead of -c")
+	fMaxMemory       = common.ByteSize(0)
+	fVerbose         = flag.Bool("v", false, "report on standard error whether the input was sorted in memory or on disk")
+	fDedupKey        = flag.String("dedup-key", "", "a comma-separated list of column indices or ranges; after sorting, output only the first row of each run with equal values in these columns")
+	fLogFile         = flag.String("log-file", "", "append error and warning messages to this file instead of writing them to standard error")
 )
 
+func init() {
+	flag.Var(&fInputFieldsPerLine, "in", "input expected number of fields per line (-1 is any, strict is the number in the first line)")
+	flag.BoolVar(fInputTabSeparator, "input-tsv", false, "alias for -its")
+	flag.BoolVar(fOutputTabSep, "output-tsv", false, "alias for -ots")
+	flag.BoolVar(fLineNumbers, "number-rows", false, "alias for -l")
+	flag.Var(&fMaxMemory, "maxmem", "memory for holding rows, such as 512MB, beyond which the input is sorted on disk (0 is unlimited)")
+	flag.Var(&fMaxMemory, "max-memory", "alias for -maxmem")
+	flag.Var(&fInputURLHeaders, "input-url-header", "input HTTP header as Key:Value sent with -input-url; may be repeated")
+	flag.Var(&fOutputURLHeader, "output-url-header", "output HTTP header as Key:Value sent with -output-url; may be repeated")
+}
+
 var usage = func() {
-	fmt.Fprintf(os.Stderr, "usage: %s [options] [ <input> ]\n", os.Args[0])
+	fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [options] [ <input> ]\n", os.Args[0])
 	flag.PrintDefaults()
-	fmt.Fprintf(os.Stderr, DESCRIPTION)
+	fmt.Fprintf(flag.CommandLine.Output(), DESCRIPTION)
 	os.Exit(1)
 }
 
 func main() {
 	flag.Usage = usage
 	flag.Parse()
+	if err := common.SetLogFile(*fLogFile); err != nil {
+		fmt.Fprintf(os.Stderr, "%v: error opening log file\n", err)
+		os.Exit(1)
+	}
+	defer common.CloseLogFile()
 	if *fInputTabSeparator {
 		*fInputSeparator = "\t"
 	}
+	if *fOutputTabSep {
+		*fOutputSeparator = "\t"
+	}
 	if *fOutputSeparator == "" {
 		*fOutputSeparator = *fInputSeparator
 	}
+	if !*fOutputSafe {
+		*fOutputSafeEsc = ""
+	}
+	if utf8.RuneCountInString(*fInputQuoteChar) > 1 || utf8.RuneCountInString(*fOutputQuoteChar) > 1 {
+		fmt.Fprintf(os.Stderr, "-iqc and -oqc must be a single character\n")
+		os.Exit(1)
+	}
+	if *fInputMultiline != "" {
+		var err error
+		*fInputMultiline, err = common.ParseEscapes(*fInputMultiline)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v: error parsing -input-multiline\n", err)
+			os.Exit(1)
+		}
+	}
+	var outputTemplate *template.Template
+	if *fOutputTemplate != "" {
+		var err error
+		outputTemplate, err = common.ParseOutputTemplate(*fOutputTemplate)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v: error parsing output template\n", err)
+			os.Exit(1)
+		}
+	}
+	var ignoreEndPattern *regexp.Regexp
+	if *fEndPattern != "" {
+		var err error
+		ignoreEndPattern, err = regexp.Compile(*fEndPattern)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v: error parsing end pattern\n", err)
+			os.Exit(1)
+		}
+	}
+	numberFormat, err := common.NewNumberFormat(*fDecimalMark, *fGroupSep)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v: error parsing -dec or -grp\n", err)
+		os.Exit(1)
+	}
 	fieldRanges, err := common.ParseFieldRanges(*fColumns)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "%v: error parsing columns\n", err)
 		os.Exit(1)
 	}
+	dedupRanges, err := common.ParseFieldRanges(*fDedupKey)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v: error parsing dedup key\n", err)
+		os.Exit(1)
+	}
+	if len(fieldRanges) == 0 {
+		fieldRanges = dedupRanges
+	}
 	if len(fieldRanges) == 0 {
 		fieldRanges = append(fieldRanges, &common.FieldRange{0, -1, 's'})
 	}
+	if *fEmptyLast && *fKey != "" {
+		fmt.Fprintf(os.Stderr, "-empty-last cannot be used with -key\n")
+		os.Exit(1)
+	}
+	if *fHumanSort && *fLocaleSort {
+		fmt.Fprintf(os.Stderr, "-human-sort cannot be used with -locale-sort\n")
+		os.Exit(1)
+	}
+	if *fHumanSort || *fLocaleSort {
+		sortFlag := byte('h')
+		if *fLocaleSort {
+			sortFlag = 'c'
+		}
+		for _, r := range fieldRanges {
+			if r.Flag == 0 || r.Flag == 's' {
+				r.Flag = sortFlag
+			}
+		}
+	}
 
+	var lineNumberStart *int
+	if common.FlagSet("number-rows-start") {
+		lineNumberStart = fLineNumberStart
+	}
 	proc := common.CSVProcessor{
 		InputSeparator:        *fInputSeparator,
 		InputTabSeparator:     *fInputTabSeparator,
 		InputComment:          *fInputComment,
-		InputFieldsPerLine:    *fInputFieldsPerLine,
+		InputFieldsPerLine:    int(fInputFieldsPerLine),
 		InputLazyQuotes:       *fInputLazyQuotes,
 		InputTrimLeadingSpace: *fInputTrimLeadingSpace,
+		InputURL:              *fInputURL,
+		InputURLHeaders:       fInputURLHeaders,
+		InputURLTimeout:       *fInputURLTimeout,
+		InputURLRetries:       *fInputURLRetries,
+		InputJSONPath:         *fInputJSONPath,
+		InputMultiline:        *fInputMultiline,
 
 		OutputFile:      *fOutputFile,
+		AppendOutput:    *fAppendOutput,
+		AtomicOutput:    *fAtomicOutput,
+		OutputURL:       *fOutputURL,
+		OutputURLMethod: *fOutputURLMethod,
+		OutputURLHeader: fOutputURLHeader,
 		OutputSeparator: *fOutputSeparator,
-		OutputCRLF:      *fOutputCRLF,
+		OutputCRLF:      *fOutputCRLF || *fOutputExcel,
+		OutputNewline:   *fOutputNewline,
+		OutputWidth:     *fOutputWidth,
+		OutputPadChar:   *fOutputPadChar,
+		OutputJSONLines: *fOutputJSONLines,
+		OutputJSONArray: *fOutputJSONArray,
+		OutputJSONTypes: *fOutputJSONTypes,
+		OutputBOM:       *fOutputExcel,
+
+		OutputFormulaEscape: *fOutputSafeEsc,
+		OutputTemplate:      outputTemplate,
+		IgnoreEndPattern:    ignoreEndPattern,
+		DetectHeader:        *fDetectHeader && !common.FlagSet("h"),
+		ValidUTF8:           *fInputValidUTF8,
+		HeadSeparator:       *fInputHeadSeparator,
+		InputQuote:          *fInputQuoteChar,
+		InputTrimBOM:        *fInputTrimBOM,
+		OutputQuote:         *fOutputQuoteChar,
 
 		IgnoreBeginning: *fIgnoreBeginning,
 		IgnoreEnd:       *fIgnoreEnd,
 		NoHeader:        *fNoHeader,
 		LineNumbers:     *fLineNumbers,
 		ZeroBased:       *fZeroBased,
+
+		LineNumberStart:  lineNumberStart,
+		LineNumberStep:   *fLineNumberStep,
+		LineNumberFormat: *fLineNumberFmt,
+
+		OriginalOrderTies: *fOriginalOrder,
+		Stable:            *fStable,
+		MaxMemory:         int64(fMaxMemory),
+		Verbose:           *fVerbose,
+		NumberFormat:      numberFormat,
+	}
+	if *fEmptyLast {
+		proc.EmptyLast = fieldRanges
 	}
 
 	err = proc.OpenIO(flag.Args())
@@ -81,80 +261,70 @@ func main() {
 		os.Exit(1)
 	}
 
-	err = proc.Sort(createSortFunc(fieldRanges), *fReverse)
+	sortFunc := numberFormat.FieldsCompareFunc(fieldRanges)
+	if *fKey != "" {
+		key, err := common.ParseExpr(*fKey)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v: error parsing key\n", err)
+			proc.Abort()
+			os.Exit(1)
+		}
+		proc.HeaderFunc = key.Bind
+		sortFunc = createKeySortFunc(key)
+	}
+
+	if *fRandomTies {
+		sortFunc = withHashTiebreak(sortFunc, *fSeed)
+	} else if *fKey == "" {
+		proc.SortRanges = fieldRanges
+	}
+
+	if len(dedupRanges) > 0 {
+		proc.DuplicateFunc = createEqualFunc(numberFormat.FieldsCompareFunc(dedupRanges))
+	}
+
+	err = proc.Sort(sortFunc, *fReverse)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		proc.Abort()
+		os.Exit(1)
+	}
+	err = proc.Close()
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "%v\n", err)
 		os.Exit(1)
 	}
 }
 
-func cmp(a, b string, flag byte) int {
-	switch flag {
-	case 'n':
-		f1, err1 := strconv.ParseFloat(strings.TrimSpace(a), 64)
-		f2, err2 := strconv.ParseFloat(strings.TrimSpace(b), 64)
-		if err1 != nil && err2 != nil {
-			goto strcmp
-		}
-		if err1 != nil {
-			return -1
-		}
-		if err2 != nil {
-			return 1
-		}
-		switch {
-		case f1 < f2:
-			return -1
-		case f2 < f1:
-			return 1
-		default:
-			return 0
-		}
-	default:
-	}
-strcmp:
-	min := len(b)
-	if len(a) < len(b) {
-		min = len(a)
-	}
-	diff := 0
-	for i := 0; i < min && diff == 0; i++ {
-		diff = int(a[i]) - int(b[i])
+// withHashTiebreak orders rows that are equal according to less by a hash of
+// their contents and seed.
+func withHashTiebreak(less common.CSVCompareFunc, seed uint64) common.CSVCompareFunc {
+	return common.ChainCompareFuncs(less, func(r1 []string, r2 []string) bool {
+		return rowHash(r1, seed) < rowHash(r2, seed)
+	})
+}
+
+func rowHash(record []string, seed uint64) uint64 {
+	h := fnv.New64a()
+	binary.Write(h, binary.LittleEndian, seed)
+	for _, field := range record {
+		io.WriteString(h, field)
+		h.Write([]byte{0})
 	}
-	if diff == 0 {
-		diff = len(a) - len(b)
+	return h.Sum64()
+}
+
+// createEqualFunc returns a function reporting whether two rows are equal
+// according to less.
+func createEqualFunc(less common.CSVCompareFunc) func(r1, r2 []string) bool {
+	return func(r1 []string, r2 []string) bool {
+		return !less(r1, r2) && !less(r2, r1)
 	}
-	return diff
-	return 0
 }
 
-func createSortFunc(ranges []*common.FieldRange) common.CSVCompareFunc {
+func createKeySortFunc(key *common.Expr) common.CSVCompareFunc {
 	return func(r1 []string, r2 []string) bool {
-		for _, r := range ranges {
-			if r.End < 0 {
-				c := cmp(r1[r.Start], r2[r.Start], r.Flag)
-				switch {
-				case c < 0:
-					return true
-				case c == 0:
-					// continue
-				case c > 0:
-					return false
-				}
-			}
-			for i := r.Start; i <= r.End; i++ {
-				c := cmp(r1[i], r2[i], r.Flag)
-				switch {
-				case c < 0:
-					return true
-				case c == 0:
-					// continue
-				case c > 0:
-					return false
-				}
-			}
-		}
-		return false
+		return common.CompareValues(key.Eval(r1), key.Eval(r2)) < 0
 	}
 }
 
@@ -179,6 +349,114 @@ If <input> is not specified on the command line, csvsort will read from
 standard in.   If no "-o" flag is provided, csvsort will write to standard
 out.
 
+With "-log-file", error and warning messages are appended to the given file
+instead of being written to standard error.
+
+<input> may also be an "http://" or "https://" URL, which is fetched with an
+HTTP GET.  A URL ending in ".gz" is decompressed.
+
+With "-append", output is added to the end of the "-o" file instead of
+replacing it, so that the output of several runs can be collected in one
+file.  If the file already has content, the header row is not written again,
+nor is a byte order mark.
+
+With "-atomic", the output is written to a temporary file in the directory of
+the "-o" file, which is synced to disk and renamed over the "-o" file only
+once csvsort has succeeded.  Another program never sees a partly written
+file: it sees either the old file or the new one.  If csvsort fails, the
+temporary file is removed and the "-o" file is left as it was, but if csvsort
+is killed, the temporary file, named after the "-o" file with a leading dot,
+may be left behind.  The rename is atomic on Unix file systems, but not
+always on Windows or network file systems.  It cannot be combined with
+"-append".
+
+The "-etp" flag drops a trailer of any length from the end of the input, such
+as the totals at the foot of a report.  The input ends at the first line after
+the header that matches its regular expression, and that line and all that
+follow are ignored; no more of the input is read.  Each line is matched as its
+fields joined by the input separator, so -etp="^TOTAL," drops everything from
+the first line whose first field is "TOTAL".  It may be combined with "-ei",
+which then ignores that many lines before the trailer.
+
+The "-ha" flag is for files that may or may not have a header row.  It
+guesses from the first two rows: if none of the fields of the first row is a
+number, but at least one field of the second row is, the first row is taken
+to be the header.  Otherwise, as when there is only one row, a header is
+created as with "-h".  Files whose columns are all text cannot be told apart
+this way, and are taken to have no header.  Giving "-h", or "-h=false", decides
+explicitly and overrides "-ha".
+
+The "-input-multiline" flag repairs input from exporters that break a field
+across lines without quoting it properly.  A line with an odd number of
+quotes is taken to continue on the next line, and the two are joined with the
+given string in place of the line ending, until the quotes balance.  The
+string may use escapes such as \n.  This is a guess, and a stray quote will
+join lines that should be separate, so a warning is given when any lines are
+joined.
+
+The "-valid-utf8" flag checks that every field of the input is valid UTF-8,
+and fails with the line and column of the first invalid sequence rather than
+passing it on to the output, where it would show as garbled text.
+
+The "-head-sep" flag is for input whose header row uses a different separator
+from its data rows, such as a comma-separated header over tab-separated data.
+The header row is read with the "-head-sep" separator, and the rest with the
+input separator, as in -head-sep=, -its.
+
+The "-iqc" and "-oqc" flags give a quote character other than the double
+quote for the input and output, such as -iqc="'" for fields quoted with
+single quotes.  Within a quoted field, the quote character is written twice
+to stand for itself, and a double quote is an ordinary character.
+
+The "-trim-bom" flag drops the UTF-8 byte order mark that some programs,
+notably Excel, write at the start of a file, and which would otherwise be
+read as part of the first field.  It is dropped from the start of every line,
+so that a mark is also dropped from the start of each file when several are
+concatenated, as in "cat a.csv b.csv | csvsort -trim-bom".  The output only
+begins with a mark with "-excel".
+
+The "-in" flag checks that every line of the input has the given number of
+fields.  With -in=strict, that number is taken from the first line, usually
+the header, and a line with a different number fails with its line number and
+both counts.
+
+With "-input-json-path", the input is a JSON document instead of CSV.  The
+flag gives a JSONPath selecting the objects that are the input rows, using
+".name", ".*", "[N]", "[*]" and "['name']" after a leading "$".  A selected
+array of objects gives a row for each element.  The header row holds every
+member name, in the order they are first seen.  For example, for input of the
+form {"meta":{...},"records":[{...},{...}]}:
+
+  -input-json-path='$.records[*]'
+
+The "-excel" flag writes output that Excel opens correctly: the output begins
+with a UTF-8 byte order mark, and lines end with CRLF.  Excel expects the
+separator of the system's locale, which is often ";", so it may be combined
+with "-os", as in -excel -os=";".
+
+The "-safe" flag guards against formula injection when the output is opened
+in a spreadsheet: every field that begins with "=", "+", "-" or "@" is
+prefixed with a single quote, or with the "-safe-escape" string, so that it is
+not run as a formula.  This changes the data, negative numbers included, so it
+is only done when asked for.
+
+The "-output-template" flag formats each row with a Go text/template instead
+of writing CSV, and the header row is not output.  Fields are available as
+.F0, .F1 and so on, counting from 0, and by their names in the header row, as
+.Name, or as index . "Full Name" for names that are not identifiers.  A line
+ending follows each row.  For example, to write SQL statements:
+
+  -output-template='INSERT INTO t VALUES ("{{.F0}}", {{.Age}});'
+
+With "-jl", each row is output as a JSON object on a line of its own, keyed by
+the names in the header row, which is not itself output.  Values are strings
+unless "-jt" is also given, in which case numbers and "true" or "false" are
+output as JSON numbers and booleans.
+
+With "-jp", the rows are output instead as a single JSON array of such
+objects, indented by two spaces for reading.  The array is only written once
+every row has been read.  "-jt" applies to it as to "-jl".
+
 The "-c" flag allows the user to specify a subset of the input fields
 for sorting, as a comma-separated list of field ranges.  Sort will be performed
 in lexocographic order based on these output columns.
@@ -188,6 +466,27 @@ in lexocographic order based on these output columns.
 will sort first by the fourth column, then by the fifth.  An "n" may be added
 to a columns number to specify a numeric sort.
 
+An "h" specifies a natural sort instead, for values mixing text and numbers
+such as file names or versions.  Runs of digits are compared by their value,
+and the text between them as usual, so that "file2" sorts before "file10",
+which it would follow in a plain string sort.  The "-human-sort" flag sorts
+every column given without "n" or "h" this way.  For example, with
+-c="1h", file1.txt, file2.txt and file10.txt sort in that order.
+
+A "c" specifies a dictionary sort of text with accented letters, as in
+French or German, in which "é" sorts with "e" rather than after "z".  Values
+are compared first by their letters, ignoring accents and case, then by their
+accents, and last by their case, so that "cote", "côte", "Côte" and "coter"
+sort in that order.  The "-locale-sort" flag sorts every column given without
+a flag this way.  The order is the same for every language: letters that a
+language sorts after "z", such as the Swedish "å", are not.
+
+Numbers are written with a point as the decimal mark, and without grouping.
+For numbers written otherwise, such as 1.234,56 in much of Europe, the "-dec"
+flag gives the decimal mark and the "-grp" flag the grouping separator, as in
+-dec=, -grp=.  Grouping separators are ignored wherever they appear.  The
+output is not changed.
+
 Field ranges can be either a single field number, or a start field and end 
 field separated by a hypen.  For example, to sort by the first five
 fields and the "tenth" field:
@@ -196,4 +495,66 @@ fields and the "tenth" field:
 
 Field numbers start at 1.
 
+Empty values sort before all others, or after them with "-r".  The
+"-empty-last" flag puts the rows with an empty value in any of the sort
+columns after all the others, whichever way they are sorted, so that missing
+data does not push the rows of interest down the output.  A value of only
+white space counts as empty.  Among themselves, such rows are sorted as
+usual.
+
+ORDER OF EQUAL ROWS
+
+The order of rows that compare equal is not defined.  The "-ob" flag orders
+such rows by their position in the input, even when the sort is reversed with
+"-r", so that the output is deterministic.  The "-stable" flag gives the same
+order with a stable sort instead, which keeps equal rows in the order they
+were read.  This matters when sorting output that was already sorted on other
+columns, whose order should be kept among rows with equal keys.  It needs no
+memory for the positions of the rows, but may be slower.
+
+The "-rt" flag instead orders equal rows pseudo-randomly, by a hash of their
+contents and the "-seed" value, which is useful for random assignment.  The
+order is reproducible, but only for identical input and the same seed.
+
+REMOVING DUPLICATES
+
+The "-dedup-key" flag gives a list of field ranges, like "-c".  After sorting,
+only the first of each run of rows with equal values in those fields is
+output.  Only the previous row is remembered, so rows are only recognized as
+duplicates when they sort next to each other; the sort columns given with
+"-c" should begin with the key fields, and default to them.  For example, to
+keep the largest order for each customer:
+
+  csvsort -c="1,3n" -r -dedup-key=1 orders.csv
+
+SORT KEY EXPRESSIONS
+
+Instead of sorting on columns, the "-key" flag gives an expression that
+computes a sort key for each row.  Fields are referred to as col(N), where N
+is a field number starting at 1, or col(name), where name is a column name
+from the header.  The functions len(s), lower(s), upper(s), num(s) and
+substr(s, start, length) are available.  For example, to sort by the length of
+the second field, or case-insensitively by the "Name" column:
+
+  csvsort -key="len(col(2))" input.csv
+  csvsort -key="lower(col(Name))" input.csv
+
+Keys that are numbers are compared numerically, and sort before keys that are
+not.
+
+LARGE FILES
+
+csvsort holds the whole input in memory.  For input larger than memory, the
+"-maxmem" flag limits the memory used to hold rows to about the given size,
+such as -maxmem=512MB, where the size may end in K, M or G; "-max-memory" is
+the same flag.  Rows are counted by their bytes and the overhead of holding
+them, so the input takes up more memory than its size on disk.  If all the
+rows fit, they are sorted in memory as usual; otherwise they are sorted in
+runs that fit, each written to a temporary file in the system's temporary
+directory, and the runs are then merged, which needs free disk space about
+the size of the input.  The output is the same either way, except for the
+order of equal rows, which is only defined with "-ob" or "-stable".  With
+"-v", csvsort reports on standard error whether it sorted in memory or on
+disk.
+
 `
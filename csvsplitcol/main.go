@@ -0,0 +1,178 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/laslowh/cursive/common"
+	"os"
+	"strings"
+)
+
+var (
+	fInputSeparator        = flag.String("is", ",", "input separator")
+	fInputTabSeparator     = flag.Bool("its", false, "input separator is the tab character (overrides -is)")
+	fInputComment          = flag.String("ic", "", "input beginning of line comment character")
+	fInputFieldsPerLine    = common.FieldsPerLine(-1)
+	fInputLazyQuotes       = flag.Bool("iq", false, "input allow 'lazy' quotes")
+	fInputTrimLeadingSpace = flag.Bool("it", false, "input trim leading space")
+
+	fOutputFile      = flag.String("o", "", "output file; defaults to stdout")
+	fAppendOutput    = flag.Bool("append", false, "append to the output file instead of replacing it, without repeating the header")
+	fOutputSeparator = flag.String("os", "", "output separator, which may be more than one character; defaults to input separator")
+	fOutputTabSep    = flag.Bool("ots", false, "output separator is the tab character (overrides -os)")
+	fOutputCRLF      = flag.Bool("oc", false, "output using CRLF as line ending")
+	fOutputNewline   = flag.String("newline", "lf", "output line ending: lf, crlf or cr")
+
+	fIgnoreBeginning = flag.Int("bi", 0, "number of lines to ignore at beginning of file")
+	fIgnoreEnd       = flag.Int("ei", 0, "number of lines to ignore at end of file")
+	fNoHeader        = flag.Bool("h", false, "no header row, will create default headers")
+	fColumn          = flag.Int("c", 0, "number of the column to split, starting at 1")
+	fSep             = flag.String("sep", ":", "separator on which the column is split")
+	fInto            = flag.String("into", "", "a comma-separated list of names of the new columns")
+	fStrict          = flag.Bool("strict", false, "fail if a value does not split into exactly as many parts as there are new columns")
+	fPad             = flag.String("pad", "", "value of the new columns for which a value has too few parts")
+	fReplace         = flag.Bool("replace", false, "remove the column that is split, putting the new columns in its place")
+	fLogFile         = flag.String("log-file", "", "append error and warning messages to this file instead of writing them to standard error")
+)
+
+func init() {
+	flag.Var(&fInputFieldsPerLine, "in", "input expected number of fields per line (-1 is any, strict is the number in the first line)")
+	flag.BoolVar(fInputTabSeparator, "input-tsv", false, "alias for -its")
+	flag.BoolVar(fOutputTabSep, "output-tsv", false, "alias for -ots")
+}
+
+var usage = func() {
+	fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [options] [ <input> ]\n", os.Args[0])
+	flag.PrintDefaults()
+	fmt.Fprintf(flag.CommandLine.Output(), DESCRIPTION)
+	os.Exit(1)
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+	if err := common.SetLogFile(*fLogFile); err != nil {
+		fmt.Fprintf(os.Stderr, "%v: error opening log file\n", err)
+		os.Exit(1)
+	}
+	defer common.CloseLogFile()
+	if *fInputTabSeparator {
+		*fInputSeparator = "\t"
+	}
+	if *fOutputTabSep {
+		*fOutputSeparator = "\t"
+	}
+	if *fOutputSeparator == "" {
+		*fOutputSeparator = *fInputSeparator
+	}
+	if *fColumn < 1 || *fInto == "" || *fSep == "" {
+		usage()
+	}
+	names := strings.Split(*fInto, ",")
+
+	procFunc := func(record []string, buffer []string, isHeader bool, lineNo int) ([][]string, error) {
+		output, err := splitField(*fColumn-1, names, record, isHeader, lineNo)
+		if err != nil {
+			return nil, err
+		}
+		return [][]string{append(buffer, output...)}, nil
+	}
+
+	proc := common.CSVProcessor{
+		InputSeparator:        *fInputSeparator,
+		InputTabSeparator:     *fInputTabSeparator,
+		InputComment:          *fInputComment,
+		InputFieldsPerLine:    int(fInputFieldsPerLine),
+		InputLazyQuotes:       *fInputLazyQuotes,
+		InputTrimLeadingSpace: *fInputTrimLeadingSpace,
+
+		OutputFile:      *fOutputFile,
+		AppendOutput:    *fAppendOutput,
+		OutputSeparator: *fOutputSeparator,
+		OutputCRLF:      *fOutputCRLF,
+		OutputNewline:   *fOutputNewline,
+
+		IgnoreBeginning: *fIgnoreBeginning,
+		IgnoreEnd:       *fIgnoreEnd,
+		NoHeader:        *fNoHeader,
+	}
+
+	err := proc.OpenIO(flag.Args())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v: error opening file\n", err)
+		os.Exit(1)
+	}
+
+	err = proc.Process(procFunc, false)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+	err = proc.Close()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+}
+
+// splitField splits the given field of record on -sep into one new field for
+// each of names, inserted after it or, with -replace, in its place.  In the
+// header, the new fields are the names themselves.  A value with too few
+// parts is padded with -pad, and the last new field holds any parts beyond
+// the number of names, unless -strict is set, in which case either is an
+// error.
+func splitField(field int, names []string, record []string, isHeader bool, lineNo int) ([]string, error) {
+	if field >= len(record) {
+		return nil, fmt.Errorf("%d: no such field in record of length %d", field+1, len(record))
+	}
+	values := names
+	if !isHeader {
+		parts := strings.Split(record[field], *fSep)
+		if *fStrict && len(parts) != len(names) {
+			return nil, fmt.Errorf("row %d: %q splits into %d parts, not %d", lineNo, record[field], len(parts), len(names))
+		}
+		values = strings.SplitN(record[field], *fSep, len(names))
+		for len(values) < len(names) {
+			values = append(values, *fPad)
+		}
+	}
+	if *fReplace {
+		record = common.RemoveFields(record, []int{field})
+		return common.InsertFields(record, field, values...), nil
+	}
+	return common.InsertFields(record, field+1, values...), nil
+}
+
+const DESCRIPTION = `
+csvsplitcol - split a CSV column into several
+
+csvsplitcol is part of the Cursive toolkit.  Cursive is a set of utilities for
+reading and writing "separated value" formats like CSV and TSV.
+
+csvsplitcol splits each value of the column given with "-c", by number
+starting at 1, on the "-sep" separator, a colon unless given, into new columns
+named with "-into".  The new columns follow the one that is split, or replace
+it with "-replace".  For example, to split a date into its parts:
+
+  csvsplitcol -c=3 -sep=/ -into=year,month,day input.csv
+
+If a value has fewer parts than there are new columns, the remaining columns
+are given the "-pad" value, empty unless given.  If it has more, the last new
+column holds the rest of the value, separators and all.  With "-strict", a
+value that does not split into exactly as many parts as there are new columns
+is an error instead.
+
+csvcut can also split a column, with "-split-col", alongside its other
+transformations; csvcoalesce does the opposite, merging several columns into
+one.
+
+INPUT AND OUTPUT
+
+If <input> is not specified on the command line, csvsplitcol will read from
+standard in.   If no "-o" flag is provided, csvsplitcol will write to standard
+out.
+
+With "-log-file", error and warning messages are appended to the given file
+instead of being written to standard error.
+
+`
@@ -0,0 +1,326 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/laslowh/cursive/common"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+)
+
+var (
+	fInputSeparator        = flag.String("is", ",", "input separator")
+	fInputTabSeparator     = flag.Bool("its", false, "input separator is the tab character (overrides -is)")
+	fInputComment          = flag.String("ic", "", "input beginning of line comment character")
+	fInputFieldsPerLine    = common.FieldsPerLine(-1)
+	fInputLazyQuotes       = flag.Bool("iq", false, "input allow 'lazy' quotes")
+	fInputTrimLeadingSpace = flag.Bool("it", false, "input trim leading space")
+
+	fOutputFile      = flag.String("o", "", "output file; defaults to stdout")
+	fAppendOutput    = flag.Bool("append", false, "append to the output file instead of replacing it, without repeating the header")
+	fOutputSeparator = flag.String("os", "", "output separator, which may be more than one character; defaults to input separator")
+	fOutputTabSep    = flag.Bool("ots", false, "output separator is the tab character (overrides -os)")
+	fOutputCRLF      = flag.Bool("oc", false, "output using CRLF as line ending")
+	fOutputNewline   = flag.String("newline", "lf", "output line ending: lf, crlf or cr")
+
+	fIgnoreBeginning = flag.Int("bi", 0, "number of lines to ignore at beginning of file")
+	fIgnoreEnd       = flag.Int("ei", 0, "number of lines to ignore at end of file")
+	fNoHeader        = flag.Bool("h", false, "no header row, will create default headers")
+	fZeroBased       = flag.Bool("z", false, "when displaying column numbers, use zero-based numbering")
+	fUniqueCols      = flag.Bool("unique-cols", false, "output only the columns whose non-empty values are all different, which may be keys")
+	fApprox          = flag.Bool("approx", false, "estimate the number of distinct values with HyperLogLog, in fixed memory, instead of counting them")
+	fApproxPrecision = flag.Int("approx-precision", 14, "precision of -approx, from 4 to 18; each column uses 2^N bytes")
+	fDecimalMark     = flag.String("dec", ".", "decimal mark of numbers in the input, such as , for 1.234,56")
+	fGroupSep        = flag.String("grp", "", "grouping separator of numbers in the input, such as . for 1.234,56")
+	fLogFile         = flag.String("log-file", "", "append error and warning messages to this file instead of writing them to standard error")
+)
+
+func init() {
+	flag.Var(&fInputFieldsPerLine, "in", "input expected number of fields per line (-1 is any, strict is the number in the first line)")
+	flag.BoolVar(fInputTabSeparator, "input-tsv", false, "alias for -its")
+	flag.BoolVar(fOutputTabSep, "output-tsv", false, "alias for -ots")
+}
+
+var usage = func() {
+	fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [options] [ <input> ]\n", os.Args[0])
+	flag.PrintDefaults()
+	fmt.Fprintf(flag.CommandLine.Output(), DESCRIPTION)
+	os.Exit(1)
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+	if err := common.SetLogFile(*fLogFile); err != nil {
+		fmt.Fprintf(os.Stderr, "%v: error opening log file\n", err)
+		os.Exit(1)
+	}
+	defer common.CloseLogFile()
+	if *fInputTabSeparator {
+		*fInputSeparator = "\t"
+	}
+	if *fOutputTabSep {
+		*fOutputSeparator = "\t"
+	}
+	if *fOutputSeparator == "" {
+		*fOutputSeparator = *fInputSeparator
+	}
+
+	if *fApprox && *fUniqueCols {
+		fmt.Fprintf(os.Stderr, "-approx cannot be used with -unique-cols\n")
+		os.Exit(1)
+	}
+	if _, err := common.NewHyperLogLog(*fApproxPrecision); *fApprox && err != nil {
+		fmt.Fprintf(os.Stderr, "%v: error parsing -approx-precision\n", err)
+		os.Exit(1)
+	}
+
+	numberFormat, err := common.NewNumberFormat(*fDecimalMark, *fGroupSep)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v: error parsing -dec or -grp\n", err)
+		os.Exit(1)
+	}
+
+	s := &stats{
+		values:  make(map[int]map[string]struct{}),
+		dups:    make(map[int]bool),
+		approx:  *fApprox,
+		numbers: numberFormat,
+	}
+	procFunc := func(record []string, buffer []string, isHeader bool, lineNo int) ([][]string, error) {
+		if isHeader {
+			s.setHeader(record)
+		} else {
+			s.add(record)
+		}
+		return nil, nil
+	}
+	endFunc := s.report
+	if *fUniqueCols {
+		endFunc = s.uniqueColumns
+	}
+
+	proc := common.CSVProcessor{
+		InputSeparator:        *fInputSeparator,
+		InputTabSeparator:     *fInputTabSeparator,
+		InputComment:          *fInputComment,
+		InputFieldsPerLine:    int(fInputFieldsPerLine),
+		InputLazyQuotes:       *fInputLazyQuotes,
+		InputTrimLeadingSpace: *fInputTrimLeadingSpace,
+
+		OutputFile:      *fOutputFile,
+		AppendOutput:    *fAppendOutput,
+		OutputSeparator: *fOutputSeparator,
+		OutputCRLF:      *fOutputCRLF,
+		OutputNewline:   *fOutputNewline,
+
+		IgnoreBeginning: *fIgnoreBeginning,
+		IgnoreEnd:       *fIgnoreEnd,
+		NoHeader:        *fNoHeader,
+
+		EndFunc: endFunc,
+	}
+
+	err = proc.OpenIO(flag.Args())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v: error opening file\n", err)
+		os.Exit(1)
+	}
+
+	err = proc.Process(procFunc, false)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+	err = proc.Close()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+}
+
+// stats accumulates statistics for each column of the header in a single
+// pass over the input.  The distinct non-empty values of each column are
+// kept in values, keyed by column index, unless approx is set, in which case
+// they are only estimated.  Numbers are parsed in the format numbers.
+type stats struct {
+	header  []string
+	columns []*column
+	values  map[int]map[string]struct{}
+	dups    map[int]bool
+	approx  bool
+	numbers common.NumberFormat
+}
+
+// column holds the statistics of a single column.  The minimum, maximum and
+// total are numeric as long as every non-empty value is a number.
+type column struct {
+	count   int
+	empty   int
+	numeric bool
+	minNum  float64
+	maxNum  float64
+	total   float64
+	minStr  string
+	maxStr  string
+	hll     *common.HyperLogLog
+}
+
+func (s *stats) setHeader(header []string) {
+	s.header = append([]string{}, header...)
+	s.columns = make([]*column, len(header))
+	for i := range s.columns {
+		s.columns[i] = &column{numeric: true}
+		if s.approx {
+			s.columns[i].hll, _ = common.NewHyperLogLog(*fApproxPrecision)
+		} else {
+			s.values[i] = make(map[string]struct{})
+		}
+	}
+}
+
+// add adds the fields of record to the statistics of their columns.  Fields
+// beyond the header are ignored, and missing fields count as empty.
+func (s *stats) add(record []string) {
+	for i, c := range s.columns {
+		v := ""
+		if i < len(record) {
+			v = record[i]
+		}
+		if strings.TrimSpace(v) == "" {
+			c.empty++
+			continue
+		}
+		c.add(v, s.numbers)
+		if s.approx {
+			c.hll.Add(v)
+		} else if _, ok := s.values[i][v]; ok {
+			s.dups[i] = true
+		} else {
+			s.values[i][v] = struct{}{}
+		}
+	}
+}
+
+func (c *column) add(v string, numbers common.NumberFormat) {
+	if c.count == 0 || v < c.minStr {
+		c.minStr = v
+	}
+	if c.count == 0 || v > c.maxStr {
+		c.maxStr = v
+	}
+	if c.numeric {
+		f, err := numbers.Parse(v)
+		if err != nil {
+			c.numeric = false
+		} else {
+			if c.count == 0 || f < c.minNum {
+				c.minNum = f
+			}
+			if c.count == 0 || f > c.maxNum {
+				c.maxNum = f
+			}
+			c.total += f
+		}
+	}
+	c.count++
+}
+
+func (s *stats) index(i int) string {
+	if *fZeroBased {
+		return strconv.Itoa(i)
+	}
+	return strconv.Itoa(i + 1)
+}
+
+// report outputs a row of statistics for each column.  When the distinct
+// values are estimated, the standard error of the estimate follows them.
+func (s *stats) report() ([][]string, error) {
+	header := []string{"column_index", "column_name", "count", "empty", "distinct", "min", "max", "mean"}
+	if s.approx {
+		header = append(header[:5], "distinct_error", "min", "max", "mean")
+	}
+	output := [][]string{header}
+	for i, c := range s.columns {
+		min, max, mean := c.minStr, c.maxStr, ""
+		if c.count > 0 && c.numeric {
+			min = formatNumber(c.minNum)
+			max = formatNumber(c.maxNum)
+			mean = formatNumber(c.total / float64(c.count))
+		}
+		row := []string{s.index(i), s.header[i], strconv.Itoa(c.count), strconv.Itoa(c.empty)}
+		if s.approx {
+			estimate := c.hll.Estimate()
+			row = append(row, formatNumber(math.Round(estimate)), formatNumber(math.Ceil(estimate*c.hll.StandardError())))
+		} else {
+			row = append(row, strconv.Itoa(len(s.values[i])))
+		}
+		output = append(output, append(row, min, max, mean))
+	}
+	return output, nil
+}
+
+// uniqueColumns outputs the index and name of each column in which no
+// non-empty value occurs more than once.
+func (s *stats) uniqueColumns() ([][]string, error) {
+	output := [][]string{{"column_index", "column_name"}}
+	for i := range s.columns {
+		if !s.dups[i] {
+			output = append(output, []string{s.index(i), s.header[i]})
+		}
+	}
+	return output, nil
+}
+
+func formatNumber(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+const DESCRIPTION = `
+csvstat - summarize the columns of a CSV file
+
+csvstat is part of the Cursive toolkit.  Cursive is a set of utilities for
+reading and writing "separated value" formats like CSV and TSV.
+
+csvstat reads the input in a single pass and outputs a row for each column,
+with its index and name, the number of non-empty and empty values, the number
+of distinct non-empty values, and the minimum and maximum values.  If every
+non-empty value of a column is a number, they are compared as numbers and the
+mean is also given; otherwise they are compared as strings.  A value that is
+only white space counts as empty.
+
+The "-unique-cols" flag outputs instead only the index and name of each
+column in which no non-empty value occurs twice.  Such columns are candidates
+for a primary key.  For example:
+
+  csvstat -unique-cols input.csv
+
+Columns are numbered from 1, or from 0 with "-z".  The distinct values of every
+column are kept in memory.
+
+For columns with too many distinct values to keep in memory, the "-approx"
+flag estimates the number of distinct values with a HyperLogLog instead, which
+takes a fixed 2^N bytes per column, where N is "-approx-precision", 14 unless
+given.  A "distinct_error" column follows the estimate, giving its standard
+error, which is about 1.04/sqrt(2^N) of the estimate, or 0.008 by default.  The
+true count is within one standard error of the estimate about two times in
+three, and within three nearly always.
+
+Numbers are taken to be written with a point as the decimal mark, and without
+grouping.  For numbers written otherwise, such as 1.234,56 in much of Europe,
+the "-dec" flag gives the decimal mark and the "-grp" flag the grouping
+separator, as in -dec=, -grp=.  The minimum, maximum and mean are still
+output with a point as the decimal mark.
+
+INPUT AND OUTPUT
+
+If <input> is not specified on the command line, csvstat will read from
+standard in.   If no "-o" flag is provided, csvstat will write to standard
+out.
+
+With "-log-file", error and warning messages are appended to the given file
+instead of being written to standard error.
+
+`
@@ -0,0 +1,395 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/laslowh/cursive/common"
+	"os"
+	"strconv"
+	"strings"
+)
+
+var (
+	fInputSeparator        = flag.String("is", ",", "input separator")
+	fInputTabSeparator     = flag.Bool("its", false, "input separator is the tab character (overrides -is)")
+	fInputComment          = flag.String("ic", "", "input beginning of line comment character")
+	fInputFieldsPerLine    = common.FieldsPerLine(-1)
+	fInputLazyQuotes       = flag.Bool("iq", false, "input allow 'lazy' quotes")
+	fInputTrimLeadingSpace = flag.Bool("it", false, "input trim leading space")
+
+	fOutputFile      = flag.String("o", "", "output file; defaults to stdout")
+	fAppendOutput    = flag.Bool("append", false, "append to the output file instead of replacing it, without repeating the header")
+	fOutputSeparator = flag.String("os", "", "output separator, which may be more than one character; defaults to input separator")
+	fOutputTabSep    = flag.Bool("ots", false, "output separator is the tab character (overrides -os)")
+	fOutputCRLF      = flag.Bool("oc", false, "output using CRLF as line ending")
+	fOutputNewline   = flag.String("newline", "lf", "output line ending: lf, crlf or cr")
+
+	fIgnoreBeginning = flag.Int("bi", 0, "number of lines to ignore at beginning of file")
+	fIgnoreEnd       = flag.Int("ei", 0, "number of lines to ignore at end of file")
+	fNoHeader        = flag.Bool("h", false, "no header row, will create default headers")
+	fMaxRows         = flag.Int("max", 0, "output at most this many data rows, then stop (0 is unlimited)")
+	fLineNumbers     = flag.Bool("l", false, "insert a column of line numbers at the front of the output")
+	fLineNumberStart = flag.Int("number-rows-start", 0, "number of the first row with -l (default 1, or 0 with -z)")
+	fLineNumberStep  = flag.Int("number-rows-step", 1, "increment between the numbers of consecutive rows with -l")
+	fLineNumberFmt   = flag.String("number-rows-fmt", "%d", "printf format of the numbers inserted with -l, such as %05d")
+	fZeroBased       = flag.Bool("z", false, "when interpreting or displaying column numbers, use zero-based numbering")
+	fColumns         = flag.String("c", "", "a comma-separated list of column indices or ranges that make up the key; default is all columns")
+	fAdjacent        = flag.Bool("a", false, "only remove duplicates that immediately follow each other, like Unix uniq")
+	fCount           = flag.Bool("count", false, "add a column counting the rows with each key")
+	fKeepOrder       = flag.String("keep-order", "first", "which of the rows with each key is output: first or last")
+	fDuplicates      = flag.Bool("d", false, "output only the keys that appear more than once, with one row for each")
+	fAllDuplicates   = flag.Bool("D", false, "output every row whose key appears more than once")
+	fLogFile         = flag.String("log-file", "", "append error and warning messages to this file instead of writing them to standard error")
+)
+
+func init() {
+	flag.Var(&fInputFieldsPerLine, "in", "input expected number of fields per line (-1 is any, strict is the number in the first line)")
+	flag.BoolVar(fInputTabSeparator, "input-tsv", false, "alias for -its")
+	flag.BoolVar(fOutputTabSep, "output-tsv", false, "alias for -ots")
+	flag.BoolVar(fLineNumbers, "number-rows", false, "alias for -l")
+}
+
+var usage = func() {
+	fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [options] [ <input> ]\n", os.Args[0])
+	flag.PrintDefaults()
+	fmt.Fprintf(flag.CommandLine.Output(), DESCRIPTION)
+	os.Exit(1)
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+	if err := common.SetLogFile(*fLogFile); err != nil {
+		fmt.Fprintf(os.Stderr, "%v: error opening log file\n", err)
+		os.Exit(1)
+	}
+	defer common.CloseLogFile()
+	if *fInputTabSeparator {
+		*fInputSeparator = "\t"
+	}
+	if *fOutputTabSep {
+		*fOutputSeparator = "\t"
+	}
+	if *fOutputSeparator == "" {
+		*fOutputSeparator = *fInputSeparator
+	}
+	fieldRanges, err := common.ParseFieldRanges(*fColumns)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v: error parsing columns\n", err)
+		os.Exit(1)
+	}
+
+	if *fKeepOrder != "first" && *fKeepOrder != "last" {
+		fmt.Fprintf(os.Stderr, "%s: -keep-order must be first or last\n", *fKeepOrder)
+		os.Exit(1)
+	}
+	keepLast := *fKeepOrder == "last"
+	if *fDuplicates && *fAllDuplicates {
+		fmt.Fprintf(os.Stderr, "-d and -D cannot be combined\n")
+		os.Exit(1)
+	}
+
+	var u uniquer = &globalUniquer{keys: fieldRanges, seen: make(map[string]*run)}
+	if *fAdjacent {
+		u = &adjacentUniquer{keys: fieldRanges, keepLast: keepLast, all: *fAllDuplicates}
+	} else if *fAllDuplicates {
+		u = duplicatesUniquer{&lastUniquer{keys: fieldRanges, counts: make(map[string]int)}}
+	} else if keepLast {
+		u = &lastUniquer{keys: fieldRanges, counts: make(map[string]int)}
+	}
+	procFunc := func(record []string, buffer []string, isHeader bool, lineNo int) ([][]string, error) {
+		output := append(buffer, record...)
+		if isHeader {
+			if *fCount {
+				output = append(output, "count")
+			}
+			return [][]string{output}, nil
+		}
+		return u.add(output, record)
+	}
+
+	var lineNumberStart *int
+	if common.FlagSet("number-rows-start") {
+		lineNumberStart = fLineNumberStart
+	}
+	proc := common.CSVProcessor{
+		InputSeparator:        *fInputSeparator,
+		InputTabSeparator:     *fInputTabSeparator,
+		InputComment:          *fInputComment,
+		InputFieldsPerLine:    int(fInputFieldsPerLine),
+		InputLazyQuotes:       *fInputLazyQuotes,
+		InputTrimLeadingSpace: *fInputTrimLeadingSpace,
+
+		OutputFile:      *fOutputFile,
+		AppendOutput:    *fAppendOutput,
+		OutputSeparator: *fOutputSeparator,
+		OutputCRLF:      *fOutputCRLF,
+		OutputNewline:   *fOutputNewline,
+
+		IgnoreBeginning: *fIgnoreBeginning,
+		IgnoreEnd:       *fIgnoreEnd,
+		NoHeader:        *fNoHeader,
+		MaxRows:         *fMaxRows,
+		LineNumbers:     *fLineNumbers,
+		ZeroBased:       *fZeroBased,
+
+		LineNumberStart:  lineNumberStart,
+		LineNumberStep:   *fLineNumberStep,
+		LineNumberFormat: *fLineNumberFmt,
+
+		EndFunc: u.end,
+	}
+
+	err = proc.OpenIO(flag.Args())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v: error opening file\n", err)
+		os.Exit(1)
+	}
+
+	err = proc.Process(procFunc, false)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+	err = proc.Close()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+}
+
+// uniquer removes duplicate rows.  add is called with each output row and the
+// input record it came from, and returns the rows that can be written so far;
+// end returns the remaining rows.
+type uniquer interface {
+	add(output []string, record []string) ([][]string, error)
+	end() ([][]string, error)
+}
+
+// run is a row together with the number of times its key has been seen.
+type run struct {
+	output []string
+	count  int
+}
+
+func (r *run) record() []string {
+	if !*fCount {
+		return r.output
+	}
+	return append(r.output, strconv.Itoa(r.count))
+}
+
+// keep reports whether the rows of a key seen count times are output, which
+// with -d or -D is only if the key is duplicated.
+func keep(count int) bool {
+	return count > 1 || !(*fDuplicates || *fAllDuplicates)
+}
+
+// globalUniquer removes every row whose key has been seen before, keeping a
+// set of all keys.  When counting, or with -d, no row can be written until
+// the end.
+type globalUniquer struct {
+	keys  []*common.FieldRange
+	seen  map[string]*run
+	order []*run
+}
+
+func (gu *globalUniquer) add(output []string, record []string) ([][]string, error) {
+	k, err := key(gu.keys, record)
+	if err != nil {
+		return nil, err
+	}
+	if r, ok := gu.seen[k]; ok {
+		r.count++
+		return nil, nil
+	}
+	r := &run{output, 1}
+	gu.seen[k] = r
+	if *fCount || *fDuplicates {
+		gu.order = append(gu.order, r)
+		return nil, nil
+	}
+	return [][]string{r.record()}, nil
+}
+
+func (gu *globalUniquer) end() ([][]string, error) {
+	records := make([][]string, 0, len(gu.order))
+	for _, r := range gu.order {
+		if keep(r.count) {
+			records = append(records, r.record())
+		}
+	}
+	return records, nil
+}
+
+// lastUniquer outputs the last row with each key rather than the first.
+// Since any row may be followed by a duplicate, every row is buffered until
+// the end, when the rows are scanned in reverse and only the first seen with
+// each key is kept.  The rows are output in their original order.
+type lastUniquer struct {
+	keys   []*common.FieldRange
+	counts map[string]int
+	rows   [][]string
+	rowKey []string
+}
+
+func (lu *lastUniquer) add(output []string, record []string) ([][]string, error) {
+	k, err := key(lu.keys, record)
+	if err != nil {
+		return nil, err
+	}
+	lu.counts[k]++
+	lu.rows = append(lu.rows, output)
+	lu.rowKey = append(lu.rowKey, k)
+	return nil, nil
+}
+
+func (lu *lastUniquer) end() ([][]string, error) {
+	kept := make([]*run, 0, len(lu.counts))
+	seen := make(map[string]bool, len(lu.counts))
+	for i := len(lu.rows) - 1; i >= 0; i-- {
+		k := lu.rowKey[i]
+		if seen[k] {
+			continue
+		}
+		seen[k] = true
+		if keep(lu.counts[k]) {
+			kept = append(kept, &run{lu.rows[i], lu.counts[k]})
+		}
+	}
+	records := make([][]string, 0, len(kept))
+	for i := len(kept) - 1; i >= 0; i-- {
+		records = append(records, kept[i].record())
+	}
+	return records, nil
+}
+
+// duplicatesUniquer outputs, for -D, every row whose key appears more than
+// once, in the order of the input.  Like lastUniquer, which it buffers the
+// rows with, it cannot know that a row has no duplicate until the end.
+type duplicatesUniquer struct {
+	*lastUniquer
+}
+
+func (du duplicatesUniquer) end() ([][]string, error) {
+	var records [][]string
+	for i, output := range du.rows {
+		if count := du.counts[du.rowKey[i]]; count > 1 {
+			records = append(records, (&run{output, count}).record())
+		}
+	}
+	return records, nil
+}
+
+// adjacentUniquer only collapses runs of consecutive rows with the same key,
+// remembering nothing but the current run.  With keepLast, the last row of
+// each run is output instead of the first, and with all, for -D, every row
+// of each run is.
+type adjacentUniquer struct {
+	keys     []*common.FieldRange
+	keepLast bool
+	all      bool
+	current  *run
+	rows     [][]string
+	lastKey  string
+}
+
+func (au *adjacentUniquer) add(output []string, record []string) ([][]string, error) {
+	k, err := key(au.keys, record)
+	if err != nil {
+		return nil, err
+	}
+	if au.current != nil && k == au.lastKey {
+		au.current.count++
+		if au.keepLast {
+			au.current.output = output
+		}
+		if au.all {
+			au.rows = append(au.rows, output)
+		}
+		return nil, nil
+	}
+	finished, _ := au.end()
+	au.current = &run{output, 1}
+	if au.all {
+		au.rows = [][]string{output}
+	}
+	au.lastKey = k
+	return finished, nil
+}
+
+func (au *adjacentUniquer) end() ([][]string, error) {
+	if au.current == nil || !keep(au.current.count) {
+		return nil, nil
+	}
+	if au.all {
+		records := make([][]string, 0, len(au.rows))
+		for _, output := range au.rows {
+			records = append(records, (&run{output, au.current.count}).record())
+		}
+		return records, nil
+	}
+	return [][]string{au.current.record()}, nil
+}
+
+// key joins the fields of record selected by ranges into a single string.
+func key(ranges []*common.FieldRange, record []string) (string, error) {
+	if len(ranges) == 0 {
+		return strings.Join(record, "\x00"), nil
+	}
+	indices := common.FieldIndices(ranges)
+	fields := make([]string, 0, len(indices))
+	for _, i := range indices {
+		if i >= len(record) {
+			return "", fmt.Errorf("%d: no such field in record of length %d", i+1, len(record))
+		}
+		fields = append(fields, record[i])
+	}
+	return strings.Join(fields, "\x00"), nil
+}
+
+const DESCRIPTION = `
+csvuniq - remove duplicate lines from a CSV file
+
+csvuniq is part of the Cursive toolkit, and is analogous to the Unix 'uniq'
+command.  Cursive is a set of utilities for reading and writing "separated
+value" formats like CSV and TSV.
+
+By default, csvuniq outputs the first row with each distinct key, wherever the
+duplicates occur in the input.  This requires remembering every key seen.  The
+key is made up of the fields given with "-c", or of the whole row.
+
+With the "-a" flag, only duplicates that immediately follow each other are
+removed, exactly like Unix 'uniq'.  This needs to remember only the current
+row, and gives the same result as the default when the input is sorted on the
+key.
+
+The "-keep-order" flag chooses which of the rows with each key is output:
+"first", the default, or "last".  Either way, rows are output in the order in
+which they appear in the input.  Keeping the last row means that any row may
+yet be replaced by a later duplicate, so every row of the input is kept in
+memory until the end, rather than just the keys.  With "-a", the last row of
+each run is output, which needs no more memory.
+
+Like Unix 'uniq', csvuniq can instead output just the duplicates.  With "-d",
+only keys that appear more than once are output, with one row for each,
+chosen by "-keep-order" as usual.  With "-D", every row of such keys is
+output, in the order of the input, and "-keep-order" has no effect.  Either
+way, whether a key is duplicated is only known at the end of the input, so
+"-d" keeps one row for each key in memory, and "-D" every row of the input.
+With "-a", a key is duplicated if its rows follow each other, and "-D" only
+keeps the rows of the current run.
+
+The "-count" flag adds a "count" column giving the number of rows that had
+each key (or, with "-a", the length of each run).
+
+INPUT AND OUTPUT
+
+If <input> is not specified on the command line, csvuniq will read from
+standard in.   If no "-o" flag is provided, csvuniq will write to standard
+out.
+
+With "-log-file", error and warning messages are appended to the given file
+instead of being written to standard error.
+
+`
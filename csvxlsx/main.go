@@ -0,0 +1,364 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"encoding/xml"
+	"flag"
+	"fmt"
+	"github.com/laslowh/cursive/common"
+	"io"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+var (
+	fOutputFile      = flag.String("o", "", "output file; defaults to stdout")
+	fOutputSeparator = flag.String("os", ",", "output separator")
+	fOutputTabSep    = flag.Bool("ots", false, "output separator is the tab character (overrides -os)")
+	fOutputCRLF      = flag.Bool("oc", false, "output using CRLF as line ending")
+
+	fSheet      = flag.String("sheet", "", "name of the sheet to convert; defaults to the first")
+	fSheetIndex = flag.Int("sheet-index", -1, "index of the sheet to convert, starting at 0, instead of its name")
+	fListSheets = flag.Bool("list-sheets", false, "output the index and name of each sheet, and exit")
+	fLogFile    = flag.String("log-file", "", "append error and warning messages to this file instead of writing them to standard error")
+)
+
+func init() {
+	flag.BoolVar(fOutputTabSep, "output-tsv", false, "alias for -ots")
+}
+
+var usage = func() {
+	fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [options] [ <input> ]\n", os.Args[0])
+	flag.PrintDefaults()
+	fmt.Fprintf(flag.CommandLine.Output(), DESCRIPTION)
+	os.Exit(1)
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+	if err := common.SetLogFile(*fLogFile); err != nil {
+		fmt.Fprintf(os.Stderr, "%v: error opening log file\n", err)
+		os.Exit(1)
+	}
+	defer common.CloseLogFile()
+	if *fOutputTabSep {
+		*fOutputSeparator = "\t"
+	}
+	if flag.NArg() > 1 || (*fSheet != "" && *fSheetIndex >= 0) {
+		usage()
+	}
+
+	book, err := openWorkbook(flag.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v: error opening file\n", err)
+		os.Exit(1)
+	}
+
+	var records [][]string
+	if *fListSheets {
+		records = [][]string{{"index", "name"}}
+		for i, s := range book.sheets {
+			records = append(records, []string{strconv.Itoa(i), s.Name})
+		}
+	} else {
+		records, err = book.readSheet(*fSheet, *fSheetIndex)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	output := os.Stdout
+	if *fOutputFile != "" {
+		output, err = os.Create(*fOutputFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v: error opening file\n", err)
+			os.Exit(1)
+		}
+	}
+	w := csv.NewWriter(output)
+	w.Comma, _ = utf8.DecodeRuneInString(*fOutputSeparator)
+	w.UseCRLF = *fOutputCRLF
+	err = w.WriteAll(records)
+	if err == nil {
+		err = output.Close()
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+}
+
+// workbook is an XLSX file, which is a zip archive of XML parts: the
+// workbook, which lists the sheets, the relationships, which give the part
+// holding each sheet, the shared strings, and the sheets themselves.
+type workbook struct {
+	files   map[string]*zip.File
+	sheets  []xlsxSheet
+	strings []string
+}
+
+type xlsxSheet struct {
+	Name string `xml:"name,attr"`
+	ID   string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+	Part string `xml:"-"`
+}
+
+type xlsxWorkbook struct {
+	Sheets []xlsxSheet `xml:"sheets>sheet"`
+}
+
+type xlsxRelationships struct {
+	Relationships []struct {
+		ID     string `xml:"Id,attr"`
+		Target string `xml:"Target,attr"`
+	} `xml:"Relationship"`
+}
+
+// xlsxText is a string, which is either plain text or rich text made up of
+// runs of text.
+type xlsxText struct {
+	T    string `xml:"t"`
+	Runs []struct {
+		T string `xml:"t"`
+	} `xml:"r"`
+}
+
+func (t xlsxText) String() string {
+	if len(t.Runs) == 0 {
+		return t.T
+	}
+	var b strings.Builder
+	for _, r := range t.Runs {
+		b.WriteString(r.T)
+	}
+	return b.String()
+}
+
+type xlsxSharedStrings struct {
+	Items []xlsxText `xml:"si"`
+}
+
+type xlsxWorksheet struct {
+	Rows []struct {
+		R     int `xml:"r,attr"`
+		Cells []struct {
+			R      string   `xml:"r,attr"`
+			T      string   `xml:"t,attr"`
+			V      string   `xml:"v"`
+			Inline xlsxText `xml:"is"`
+		} `xml:"c"`
+	} `xml:"sheetData>row"`
+}
+
+// openWorkbook reads the list of sheets and the shared strings of the XLSX
+// file called name, or of standard in if name is empty.
+func openWorkbook(name string) (*workbook, error) {
+	var data []byte
+	var err error
+	if name == "" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(name)
+	}
+	if err != nil {
+		return nil, err
+	}
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+	book := &workbook{files: make(map[string]*zip.File)}
+	for _, f := range archive.File {
+		book.files[f.Name] = f
+	}
+
+	var wb xlsxWorkbook
+	if err := book.decode("xl/workbook.xml", &wb); err != nil {
+		return nil, err
+	}
+	var rels xlsxRelationships
+	if err := book.decode("xl/_rels/workbook.xml.rels", &rels); err != nil {
+		return nil, err
+	}
+	targets := make(map[string]string)
+	for _, r := range rels.Relationships {
+		if strings.HasPrefix(r.Target, "/") {
+			targets[r.ID] = strings.TrimPrefix(r.Target, "/")
+		} else {
+			targets[r.ID] = path.Join("xl", r.Target)
+		}
+	}
+	for _, s := range wb.Sheets {
+		s.Part = targets[s.ID]
+		book.sheets = append(book.sheets, s)
+	}
+
+	if _, ok := book.files["xl/sharedStrings.xml"]; ok {
+		var sst xlsxSharedStrings
+		if err := book.decode("xl/sharedStrings.xml", &sst); err != nil {
+			return nil, err
+		}
+		for _, si := range sst.Items {
+			book.strings = append(book.strings, si.String())
+		}
+	}
+	return book, nil
+}
+
+func (book *workbook) decode(name string, v interface{}) error {
+	f, ok := book.files[name]
+	if !ok {
+		return fmt.Errorf("%s: missing from XLSX file", name)
+	}
+	r, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	return xml.NewDecoder(r).Decode(v)
+}
+
+// readSheet returns the cells of the sheet with the given name or, if name is
+// empty, the given index, or else the first sheet.  Every record has as many
+// fields as the widest row, and rows missing from the sheet are empty.
+func (book *workbook) readSheet(name string, index int) ([][]string, error) {
+	if index < 0 {
+		index = 0
+	}
+	if name != "" {
+		index = -1
+		for i, s := range book.sheets {
+			if s.Name == name {
+				index = i
+				break
+			}
+		}
+		if index < 0 {
+			return nil, fmt.Errorf("%s: no such sheet", name)
+		}
+	}
+	if index >= len(book.sheets) {
+		return nil, fmt.Errorf("%d: no such sheet; there are %d", index, len(book.sheets))
+	}
+
+	var ws xlsxWorksheet
+	if err := book.decode(book.sheets[index].Part, &ws); err != nil {
+		return nil, err
+	}
+	var records [][]string
+	width := 0
+	for _, row := range ws.Rows {
+		if row.R == 0 {
+			row.R = len(records) + 1
+		}
+		for len(records) < row.R {
+			records = append(records, nil)
+		}
+		var record []string
+		for _, c := range row.Cells {
+			column := len(record)
+			if c.R != "" {
+				column = columnIndex(c.R)
+			}
+			for len(record) <= column {
+				record = append(record, "")
+			}
+			value, err := book.cellValue(c.T, c.V, c.Inline)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", c.R, err)
+			}
+			record[column] = value
+		}
+		records[row.R-1] = record
+		if len(record) > width {
+			width = len(record)
+		}
+	}
+	for i := range records {
+		for len(records[i]) < width {
+			records[i] = append(records[i], "")
+		}
+	}
+	return records, nil
+}
+
+// cellValue returns the text of a cell of type t, whose value is v or, for
+// inline strings, inline.  Numbers are written in their shortest form,
+// which drops the rounding errors that Excel stores.
+func (book *workbook) cellValue(t, v string, inline xlsxText) (string, error) {
+	switch t {
+	case "s":
+		i, err := strconv.Atoi(v)
+		if err != nil || i < 0 || i >= len(book.strings) {
+			return "", fmt.Errorf("%s: no such shared string", v)
+		}
+		return book.strings[i], nil
+	case "inlineStr":
+		return inline.String(), nil
+	case "b":
+		if v == "1" {
+			return "TRUE", nil
+		}
+		return "FALSE", nil
+	case "", "n":
+		if f, err := strconv.ParseFloat(v, 64); err == nil {
+			return strconv.FormatFloat(f, 'f', -1, 64), nil
+		}
+	}
+	return v, nil
+}
+
+// columnIndex returns the index, starting at 0, of the column of a cell
+// reference such as "AB12".
+func columnIndex(ref string) int {
+	column := 0
+	for _, r := range ref {
+		if r < 'A' || r > 'Z' {
+			break
+		}
+		column = column*26 + int(r-'A') + 1
+	}
+	return column - 1
+}
+
+const DESCRIPTION = `
+csvxlsx - convert a sheet of an Excel XLSX file to CSV
+
+csvxlsx is part of the Cursive toolkit.  Cursive is a set of utilities for
+reading and writing "separated value" formats like CSV and TSV.
+
+csvxlsx outputs the cells of one sheet of an XLSX workbook as CSV, so that it
+can be used with the other tools.  The sheet is given by name with "-sheet",
+or by position, starting at 0, with "-sheet-index"; otherwise the first sheet
+is converted.  The "-list-sheets" flag outputs the index and name of each
+sheet instead.  For example:
+
+  csvxlsx -list-sheets input.xlsx
+  csvxlsx -sheet=Sheet1 input.xlsx | csvcut -c=1-3
+
+Every row has as many fields as the widest row of the sheet, and empty rows
+are kept, so that cells stay in their rows and columns.  Cells are output as
+their stored values, not as Excel displays them: formulas give their last
+computed value, booleans are TRUE or FALSE, and dates and times are numbers
+of days since 1900, as Excel keeps them.  Numbers are written in their
+shortest form.
+
+Only XLSX files are read, not the older binary XLS format.
+
+INPUT AND OUTPUT
+
+If <input> is not specified on the command line, csvxlsx will read from
+standard in.   If no "-o" flag is provided, csvxlsx will write to standard
+out.
+
+With "-log-file", error and warning messages are appended to the given file
+instead of being written to standard error.
+
+`